@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const (
+	// defaultBackfillSearches is how many missing identity keys a feed
+	// searches for per backfill run when Backfill.MaxSearches is unset.
+	defaultBackfillSearches = 5
+	// maxBackfillKeys bounds the expected key set, so a typo in a range
+	// cannot turn into a million-entry product.
+	maxBackfillKeys = 10000
+)
+
+// Backfill is a feed's expected content and the Torznab search used to find
+// what is missing from it. RSS only shows the last N items, so anything
+// published while the daemon was down never appears in the feed again.
+type Backfill struct {
+	// Expect lists the values each Identity label should take. A value of
+	// the form "RD01..RD20" is a numeric range, zero-padded to the width of
+	// its first bound.
+	Expect map[string][]string `koanf:"Expect"`
+	// URL is the Torznab API endpoint to search. It defaults to the feed's
+	// own URL for a Type: torznab feed.
+	URL string `koanf:"URL"`
+	// HTTP is the client profile for URL. A search against the feed's own
+	// URL uses the feed's profile.
+	HTTP HTTPProfile `koanf:"HTTP"`
+	// Torznab is the search. Its Query is a text/template over the missing
+	// key's labels, e.g. "MotoGP {{.round}} {{.session}}"; it defaults to the
+	// label values in Identity order.
+	Torznab     TorznabQuery `koanf:"Torznab"`
+	MaxSearches int          `koanf:"MaxSearches"`
+}
+
+// Enabled reports whether the feed declares what it expects.
+func (b *Backfill) Enabled() bool {
+	return len(b.Expect) > 0
+}
+
+// Validate checks the block against the feed it belongs to.
+func (b *Backfill) Validate(feedCfg *Feed) error {
+	for label, values := range b.Expect {
+		if !slices.Contains(feedCfg.Identity, label) {
+			return fmt.Errorf("Backfill.Expect label %q is not in Identity", label)
+		}
+		if len(values) == 0 {
+			return fmt.Errorf("Backfill.Expect label %q lists no values", label)
+		}
+	}
+	for _, label := range feedCfg.Identity {
+		if _, ok := b.Expect[label]; !ok {
+			return fmt.Errorf("Backfill.Expect must list values for Identity label %q", label)
+		}
+	}
+	if _, err := b.expectedKeys(feedCfg.Identity); err != nil {
+		return err
+	}
+	if b.URL == "" && feedCfg.Type != FeedTypeTorznab {
+		return fmt.Errorf("Backfill.URL is required unless the feed is Type: %s", FeedTypeTorznab)
+	}
+	if err := b.Torznab.Validate(); err != nil {
+		return fmt.Errorf("Backfill.%w", err)
+	}
+	if b.MaxSearches < 0 {
+		return fmt.Errorf("Backfill.MaxSearches must not be negative, got %d", b.MaxSearches)
+	}
+	return nil
+}
+
+// parseQuery parses Torznab.Query as a template over a missing key's labels.
+func (b *Backfill) parseQuery() (*template.Template, error) {
+	tmpl, err := template.New("query").Option("missingkey=error").Parse(b.Torznab.Query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse Backfill.Torznab.Query: %w", err)
+	}
+	return tmpl, nil
+}
+
+var backfillRange = regexp.MustCompile(`^(\D*)(\d+)\.\.(\D*)(\d+)$`)
+
+// expandExpectValue expands a "RD01..RD20" range into its members. Anything
+// else is a single literal value.
+func expandExpectValue(value string) ([]string, error) {
+	m := backfillRange.FindStringSubmatch(value)
+	if m == nil {
+		return []string{value}, nil
+	}
+	prefix, loStr, prefix2, hiStr := m[1], m[2], m[3], m[4]
+	if prefix != prefix2 {
+		return nil, fmt.Errorf("Backfill.Expect range %q: both bounds need the same prefix", value)
+	}
+	lo, err := strconv.Atoi(loStr)
+	if err != nil {
+		return nil, fmt.Errorf("Backfill.Expect range %q: %w", value, err)
+	}
+	hi, err := strconv.Atoi(hiStr)
+	if err != nil {
+		return nil, fmt.Errorf("Backfill.Expect range %q: %w", value, err)
+	}
+	if hi < lo {
+		return nil, fmt.Errorf("Backfill.Expect range %q runs backwards", value)
+	}
+	if hi-lo >= maxBackfillKeys {
+		return nil, fmt.Errorf("Backfill.Expect range %q has more than %d values", value, maxBackfillKeys)
+	}
+	values := make([]string, 0, hi-lo+1)
+	for n := lo; n <= hi; n++ {
+		values = append(values, fmt.Sprintf("%s%0*d", prefix, len(loStr), n))
+	}
+	return values, nil
+}
+
+// expectedKeys returns every label set Expect describes, in Identity order
+// with each label's values in the order they were listed.
+func (b *Backfill) expectedKeys(identity []string) ([]map[string]string, error) {
+	sets := []map[string]string{{}}
+	for _, label := range identity {
+		var values []string
+		for _, v := range b.Expect[label] {
+			expanded, err := expandExpectValue(v)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, expanded...)
+		}
+		if len(sets)*len(values) > maxBackfillKeys {
+			return nil, fmt.Errorf("Backfill.Expect describes more than %d identity keys", maxBackfillKeys)
+		}
+		next := make([]map[string]string, 0, len(sets)*len(values))
+		for _, set := range sets {
+			for _, v := range values {
+				labels := maps.Clone(set)
+				labels[label] = v
+				next = append(next, labels)
+			}
+		}
+		sets = next
+	}
+	return sets, nil
+}
+
+// missingKeys returns the expected label sets whose identity key the cache
+// has never seen. Keys of records SaveCache has since pruned stay covered.
+func (m *Feed) missingKeys(cache *CacheFile) []map[string]string {
+	// Validated at load, so an error here means a feed built directly.
+	expected, err := m.Backfill.expectedKeys(m.Identity)
+	if err != nil {
+		log.WithError(err).Errorf("Unable to expand Backfill.Expect for feed %q", m.Name)
+		return nil
+	}
+	covered := cache.CoveredKeys()
+	var missing []map[string]string
+	for _, labels := range expected {
+		key, _ := IdentityKey(labels, m.Identity)
+		if !covered[key] {
+			missing = append(missing, labels)
+		}
+	}
+	return missing
+}
+
+// backfillRequest builds the search URL for one missing label set.
+func (m *Feed) backfillRequest(labels map[string]string) (string, error) {
+	m.compile()
+	q := m.Backfill.Torznab
+	base := m.Backfill.URL
+	if base == "" {
+		base = m.URL
+		if q.APIKey == "" {
+			q.APIKey = m.Torznab.APIKey
+		}
+	}
+
+	if q.Query == "" || m.backfillQuery == nil {
+		values := make([]string, len(m.Identity))
+		for i, label := range m.Identity {
+			values[i] = labels[label]
+		}
+		q.Query = strings.Join(values, " ")
+	} else {
+		var buf bytes.Buffer
+		if err := m.backfillQuery.Execute(&buf, labels); err != nil {
+			return "", fmt.Errorf("unable to render Backfill.Torznab.Query: %w", err)
+		}
+		q.Query = buf.String()
+	}
+	return q.requestURL(base)
+}
+
+// BackfillClient is the HTTP client for backfill searches: the feed's own
+// client when the search goes to the feed's URL, else one built from
+// Backfill.HTTP.
+func (m *Feed) BackfillClient() *FeedClient {
+	m.compile()
+	if m.Backfill.URL == "" || m.backfillClient == nil {
+		return m.Client()
+	}
+	return m.backfillClient
+}
+
+// backfillTracker remembers when each missing key was last searched, so a
+// feed with more missing keys than MaxSearches works through all of them over
+// successive runs rather than repeating the first few. watch keeps one for
+// the life of the process; the backfill command starts with an empty one.
+type backfillTracker struct {
+	searched map[string]time.Time
+}
+
+func newBackfillTracker() *backfillTracker {
+	return &backfillTracker{searched: map[string]time.Time{}}
+}
+
+// pick returns up to n of missing, least recently searched first. Keys never
+// searched keep their Expect order.
+func (t *backfillTracker) pick(feedName string, identity []string, missing []map[string]string, n int) []map[string]string {
+	trackerKey := func(labels map[string]string) string {
+		key, _ := IdentityKey(labels, identity)
+		return feedName + "\x00" + key
+	}
+	picked := slices.Clone(missing)
+	sort.SliceStable(picked, func(i, j int) bool {
+		return t.searched[trackerKey(picked[i])].Before(t.searched[trackerKey(picked[j])])
+	})
+	if len(picked) > n {
+		picked = picked[:n]
+	}
+	now := time.Now()
+	for _, labels := range picked {
+		t.searched[trackerKey(labels)] = now
+	}
+	return picked
+}
+
+type BackfillCmd struct {
+	Feed            []string `kong:"help='Limit backfill to the given feed(s)'"`
+	NoAction        bool     `kong:"short='n',help='Just print results and take no action',xor='action'"`
+	Skip            bool     `kong:"short='s',help='Just skip any matching torrents',xor='action'"`
+	HistoryFile     string   `kong:"help='Path to history JSON file'"`
+	TorrentCacheDir string   `kong:"help='Directory to cache fetched .torrent files across runs'"`
+}
+
+func (cmd *BackfillCmd) Run(ctx *RunContext) error {
+	if cmd.HistoryFile != "" {
+		var err error
+		if ctx.History, err = OpenHistory(cmd.HistoryFile); err != nil {
+			log.WithError(err).Warnf("Unable to open history file: %s", cmd.HistoryFile)
+			ctx.History = nil
+		}
+	}
+	once := OnceCmd{
+		Feed:            cmd.Feed,
+		NoAction:        cmd.NoAction,
+		Skip:            cmd.Skip,
+		TorrentCacheDir: cmd.TorrentCacheDir,
+	}
+	return once.Backfill(ctx, newBackfillTracker())
+}
+
+// Backfill searches for the identity keys each feed with a Backfill block
+// expects but has never seen, and runs the results through the same
+// selection and dispatch as the feed itself. Like Run, it dispatches up to
+// MaxDispatchPerRun and defers the rest.
+func (cmd *OnceCmd) Backfill(ctx *RunContext, tracker *backfillTracker) error {
+	cmd.pool = newFetchPool(ctx.Config.Fetch)
+	cmd.budget = newDispatchBudget(ctx.Config.MaxDispatchPerRun)
+	cmd.quit = false
+	cmd.txHashes = nil
+	for _, feedCfg := range ctx.Config.Feeds {
+		if !cmd.feedAllowed(feedCfg.Name) || !feedCfg.Backfill.Enabled() {
+			continue
+		}
+		extractor, ok := ctx.Config.Extractors[feedCfg.Extractor]
+		if !ok {
+			log.Errorf("Feed %q references unknown Extractor %q, skipping", feedCfg.Name, feedCfg.Extractor)
+			continue
+		}
+		if cmd.backfillFeed(ctx, feedCfg, extractor, tracker) {
+			break
+		}
+	}
+
+	if n := cmd.budget.Deferred(); n > 0 {
+		log.Infof("Backfill deferred %d item(s) to a later run: MaxDispatchPerRun reached", n)
+	}
+
+	// Every configured feed counts as "not checked this run": a search
+	// result says nothing about what is still in the feed, so pruning by
+	// GUID presence is left to the next regular run.
+	activeGUIDs := collectActiveGUIDs(Feeds{}, ctx.Config.Feeds)
+	cacheTime := time.Duration(ctx.Config.SeenCacheDays) * 24 * time.Hour
+	if err := ctx.Cache.SaveCache(cacheTime, activeGUIDs); err != nil {
+		return fmt.Errorf("unable to save seen cache: %w", err)
+	}
+	if ctx.History != nil {
+		if err := ctx.History.SaveHistory(cacheTime); err != nil {
+			log.WithError(err).Warn("Unable to save history file")
+		}
+	}
+	return nil
+}
+
+// backfillFeed searches for one feed's missing keys. Returns true when the
+// user quit at an interactive prompt and the run should stop.
+func (cmd *OnceCmd) backfillFeed(ctx *RunContext, feedCfg Feed, extractor *ExtractorSet, tracker *backfillTracker) bool {
+	missing := feedCfg.missingKeys(ctx.Cache)
+	if len(missing) == 0 {
+		log.Debugf("Backfill %s: nothing missing", feedCfg.Name)
+		return false
+	}
+	limit := feedCfg.Backfill.MaxSearches
+	if limit == 0 {
+		limit = defaultBackfillSearches
+	}
+	picked := tracker.pick(feedCfg.Name, feedCfg.Identity, missing, limit)
+	log.Infof("Backfill %s: %d identity key(s) missing, searching for %d", feedCfg.Name, len(missing), len(picked))
+
+	// The searches run concurrently. Their results are pooled in pick order
+	// so selection sees them side by side, just as it sees a feed's items.
+	reqURLs := make([]string, len(picked))
+	for i, labels := range picked {
+		reqURL, err := feedCfg.backfillRequest(labels)
+		if err != nil {
+			log.WithError(err).Errorf("Backfill %s: unable to build search", feedCfg.Name)
+			continue
+		}
+		reqURLs[i] = reqURL
+	}
+	found := make([]*gofeed.Feed, len(picked))
+	pool := cmd.pool
+	if pool == nil {
+		pool = newFetchPool(ctx.Config.Fetch)
+	}
+	pool.Run(len(picked), func(i int) string { return reqURLs[i] }, func(i int) {
+		if reqURLs[i] == "" {
+			return
+		}
+		rss, err := fetchFeed(feedCfg.BackfillClient(), reqURLs[i])
+		if err != nil {
+			key, _ := IdentityKey(picked[i], feedCfg.Identity)
+			log.WithError(err).Warnf("Backfill %s: search for %s failed", feedCfg.Name, key)
+			return
+		}
+		found[i] = rss
+	})
+
+	results := &gofeed.Feed{}
+	seen := map[string]bool{}
+	for _, rss := range found {
+		if rss == nil {
+			continue
+		}
+		for _, item := range rss.Items {
+			if !seen[item.GUID] {
+				seen[item.GUID] = true
+				results.Items = append(results.Items, item)
+			}
+		}
+	}
+	if len(results.Items) == 0 {
+		return false
+	}
+
+	// The results are a Torznab response whatever the feed's own Type, so
+	// their attrs become labels the same way a Torznab feed's do.
+	searchCfg := feedCfg
+	searchCfg.Type = FeedTypeTorznab
+	cmd.backfill = true
+	defer func() { cmd.backfill = false }()
+	return cmd.processFeed(ctx, feedCfg.Name, searchCfg, results, extractor)
+}
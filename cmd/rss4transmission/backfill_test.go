@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandExpectValue(t *testing.T) {
+	values, err := expandExpectValue("RD01..RD20")
+	require.NoError(t, err)
+	require.Len(t, values, 20)
+	assert.Equal(t, "RD01", values[0])
+	assert.Equal(t, "RD20", values[19])
+
+	values, err = expandExpectValue("8..10")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"8", "9", "10"}, values)
+
+	values, err = expandExpectValue("Race")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Race"}, values)
+
+	_, err = expandExpectValue("RD01..R20")
+	assert.Error(t, err, "bounds with different prefixes")
+	_, err = expandExpectValue("RD20..RD01")
+	assert.Error(t, err, "a range that runs backwards")
+}
+
+func backfillFeed(url string) Feed {
+	return Feed{
+		Name:      "MotoGP",
+		URL:       "https://tracker.example/rss",
+		Extractor: "motogp",
+		Identity:  []string{"round", "session"},
+		Groups:    []Group{{Require: map[string][]string{"resolution": {"1080p"}}}},
+		Backfill: Backfill{
+			URL:     url,
+			Expect:  map[string][]string{"round": {"05..06"}, "session": {"Race"}},
+			Torznab: TorznabQuery{APIKey: "secret", Query: "MotoGP Round{{.round}} {{.session}}"},
+		},
+	}
+}
+
+func TestBackfillValidate(t *testing.T) {
+	f := backfillFeed("http://jackett/api")
+	assert.NoError(t, f.Backfill.Validate(&f))
+
+	f = backfillFeed("http://jackett/api")
+	delete(f.Backfill.Expect, "session")
+	assert.Error(t, f.Backfill.Validate(&f), "every Identity label needs expected values")
+
+	f = backfillFeed("http://jackett/api")
+	f.Backfill.Expect["class"] = []string{"MotoGP"}
+	assert.Error(t, f.Backfill.Validate(&f), "a label outside Identity cannot form a key")
+
+	f = backfillFeed("")
+	assert.Error(t, f.Backfill.Validate(&f), "an RSS feed has no Torznab endpoint to fall back on")
+	f.Type = FeedTypeTorznab
+	assert.NoError(t, f.Backfill.Validate(&f))
+}
+
+func TestFeedMissingKeys(t *testing.T) {
+	f := backfillFeed("http://jackett/api")
+	cache := emptyCache()
+	cache.AddItem(&FeedItem{Feed: "MotoGP", Item: &gofeed.Item{GUID: "g5"}},
+		map[string]string{"round": "05", "session": "Race"}, []string{"round=05|session=Race"})
+
+	missing := f.missingKeys(cache)
+	require.Len(t, missing, 1)
+	assert.Equal(t, map[string]string{"round": "06", "session": "Race"}, missing[0])
+}
+
+// A key stays covered after SaveCache prunes the record that covered it, so
+// an old round is not searched for and dispatched again; forgetting the
+// record uncovers it.
+func TestFeedMissingKeys_SurvivesPruning(t *testing.T) {
+	f := backfillFeed("http://jackett/api")
+	cache := emptyCache()
+	cache.filename = filepath.Join(t.TempDir(), "cache.json")
+	item := &FeedItem{Feed: "MotoGP", Item: &gofeed.Item{GUID: "g5"}}
+	cache.AddItem(item, map[string]string{"round": "05", "session": "Race"}, []string{"round=05|session=Race"})
+	cache.Seen[0].AddTime = time.Now().Add(-60 * 24 * time.Hour)
+
+	require.NoError(t, cache.SaveCache(30*24*time.Hour, map[string]map[string]bool{"MotoGP": {}}))
+	require.Empty(t, cache.Seen)
+	assert.Len(t, f.missingKeys(cache), 1, "round 05 is still covered")
+
+	reopened, err := OpenCache(cache.filename)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"MotoGP": {"round=05|session=Race"}}, reopened.Covered)
+
+	cache.AddItem(item, map[string]string{"round": "05", "session": "Race"}, []string{"round=05|session=Race"})
+	cache.RemoveEntry("MotoGP", "g5")
+	assert.Len(t, f.missingKeys(cache), 2, "a forgotten record is searched for again")
+}
+
+func TestBackfillTracker_RotatesThroughMissingKeys(t *testing.T) {
+	identity := []string{"round"}
+	missing := []map[string]string{{"round": "01"}, {"round": "02"}, {"round": "03"}}
+	tracker := newBackfillTracker()
+
+	first := tracker.pick("F", identity, missing, 2)
+	assert.Equal(t, []map[string]string{{"round": "01"}, {"round": "02"}}, first)
+	second := tracker.pick("F", identity, missing, 2)
+	assert.Equal(t, "03", second[0]["round"], "the key never searched goes first")
+}
+
+// The backfill run searches only for what the cache is missing, and the
+// results go through the same selection and dispatch as the feed's own items.
+func TestOnceBackfill_SearchesMissingKeysAndDispatches(t *testing.T) {
+	var mu sync.Mutex
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query().Get("q"))
+		mu.Unlock()
+		assert.Equal(t, "secret", r.URL.Query().Get("apikey"))
+		_, _ = w.Write([]byte(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:torznab="http://torznab.com/schemas/2015/feed"><channel><title>t</title>
+<item><title>MotoGP.2026.Round06.Race.1080p</title><guid>r6-1080</guid>
+  <torznab:attr name="seeders" value="12"/></item>
+<item><title>MotoGP.2026.Round06.Race.720p</title><guid>r6-720</guid></item>
+</channel></rss>`))
+	}))
+	defer srv.Close()
+
+	cache, err := OpenCache(filepath.Join(t.TempDir(), "seen.json"))
+	require.NoError(t, err)
+	cache.AddItem(&FeedItem{Feed: "MotoGP", Item: &gofeed.Item{GUID: "g5"}},
+		map[string]string{"round": "05", "session": "Race"}, []string{"round=05|session=Race"})
+
+	ctx := &RunContext{
+		Config: Config{
+			Feeds: []Feed{backfillFeed(srv.URL + "/api")},
+			Extractors: map[string]*ExtractorSet{"motogp": {Labels: map[string]LabelDef{
+				"round":      {Regexp: `Round(\d+)`},
+				"session":    {Regexp: `\.(Race)\.`},
+				"resolution": {Regexp: `(1080p|720p)`},
+			}}},
+			SeenCacheDays: 1,
+		},
+		Cache:   cache,
+		History: &HistoryFile{guidIndex: map[string]int{}},
+	}
+
+	require.NoError(t, (&OnceCmd{NoAction: true}).Backfill(ctx, newBackfillTracker()))
+
+	assert.Equal(t, []string{"MotoGP Round06 Race"}, queries, "only the missing round is searched")
+	byGUID := map[string]HistoryRecord{}
+	for _, r := range ctx.History.GetRecords() {
+		byGUID[r.GUID] = r
+	}
+	assert.Equal(t, "no-action mode", byGUID["r6-1080"].Reason)
+	assert.Equal(t, "12", byGUID["r6-1080"].Labels["seeders"], "search results carry their torznab attrs")
+	assert.Equal(t, "skipped", byGUID["r6-720"].Outcome)
+}
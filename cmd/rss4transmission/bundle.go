@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// BundlePolicy decides what becomes of a winner covering several identity
+// keys when the seen cache already has some of them at equal or better
+// preference. Without one, such a bundle is downloaded in full.
+type BundlePolicy struct {
+	// SkipCovered leaves the files of the already covered keys out of the
+	// download.
+	SkipCovered bool `koanf:"SkipCovered"`
+	// MinNewKeys skips a bundle that adds fewer new keys than this. 0 means
+	// no minimum.
+	MinNewKeys int `koanf:"MinNewKeys"`
+}
+
+// Enabled reports whether the policy changes anything.
+func (b *BundlePolicy) Enabled() bool {
+	return b.SkipCovered || b.MinNewKeys > 0
+}
+
+// Validate checks the policy's values.
+func (b *BundlePolicy) Validate() error {
+	if b.MinNewKeys < 0 {
+		return fmt.Errorf("Bundle: MinNewKeys %d must not be negative", b.MinNewKeys)
+	}
+	return nil
+}
+
+// bundleCoverage splits w's identity keys, among those of its coverages that
+// some Group matches, into the ones it would add and the ones the cache
+// already has at equal or better preference, or at the Upgrade Cutoff. Winners dispatched earlier in
+// the run are in the cache by now, so they count as covering.
+func bundleCoverage(feedCfg Feed, w *candidate, cache *CacheFile) (newKeys, coveredKeys []string) {
+	for _, cov := range w.coverages(feedCfg.Identity) {
+		if !slices.ContainsFunc(feedCfg.Groups, func(g Group) bool { return g.Matches(cov.labels) }) {
+			continue
+		}
+		rank := PreferenceRank(cov.labels, feedCfg.Prefer)
+		if cacheBlocks(feedCfg, cache, cov.identityKey, rank) != "" {
+			coveredKeys = append(coveredKeys, cov.identityKey)
+		} else {
+			newKeys = append(newKeys, cov.identityKey)
+		}
+	}
+	return newKeys, coveredKeys
+}
+
+// applyBundlePolicy runs the feed's bundle policy on w before dispatch. It
+// returns a skip reason when w is not to be dispatched at all; otherwise,
+// with SkipCovered, it marks w's covered keys for selectFiles to leave out.
+func applyBundlePolicy(feedCfg Feed, w *candidate, cache *CacheFile) string {
+	policy := feedCfg.Bundle
+	if !policy.Enabled() {
+		return ""
+	}
+	newKeys, coveredKeys := bundleCoverage(feedCfg, w, cache)
+	if len(newKeys) == 0 && len(coveredKeys) > 0 {
+		return skipReasonCacheBetter
+	}
+	if total := len(newKeys) + len(coveredKeys); total > 1 && len(newKeys) < policy.MinNewKeys {
+		return fmt.Sprintf("bundle adds %d of %d identity keys, MinNewKeys is %d", len(newKeys), total, policy.MinNewKeys)
+	}
+	if policy.SkipCovered && len(coveredKeys) > 0 {
+		w.coveredKeys = map[string]bool{}
+		for _, key := range coveredKeys {
+			w.coveredKeys[key] = true
+		}
+	}
+	return ""
+}
+
+// coveredNote is the history reason for a bundle dispatched without the
+// files of keys the cache already had.
+func coveredNote(files int, keys map[string]bool) string {
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	slices.Sort(sorted)
+	return fmt.Sprintf("bundle: %d file(s) not downloaded, already have %s", files, strings.Join(sorted, ", "))
+}
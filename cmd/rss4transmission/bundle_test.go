@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hekmon/transmissionrpc/v3"
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bundleRun processes one 720p MotoGP+Moto2+Moto3 bundle for RD01 against a
+// cache that already has MotoGP and Moto2 at 1080p, and returns what was
+// sent to Transmission, if anything.
+func bundleRun(t *testing.T, policy BundlePolicy) (*RunContext, map[string]any) {
+	t.Helper()
+	torrentSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(buildMultiFileTorrent("RD01", [][]string{
+			{"MotoGP.RD01.mkv"}, {"Moto2.RD01.mkv"}, {"Moto3.RD01.mkv"},
+		}))
+	}))
+	t.Cleanup(torrentSrv.Close)
+	var added map[string]any
+	txSrv := recordingTransmissionServer(t, func(args map[string]any) { added = args })
+	t.Cleanup(txSrv.Close)
+	endpoint, err := url.Parse(txSrv.URL)
+	require.NoError(t, err)
+	client, err := transmissionrpc.New(endpoint, nil)
+	require.NoError(t, err)
+
+	feedCfg := Feed{
+		Name:     "F",
+		Identity: []string{"round", "class"},
+		Prefer:   []PreferDimension{{Label: "resolution", Order: []string{"1080p", "720p"}}},
+		Groups:   []Group{{Require: map[string][]string{}}},
+		Bundle:   policy,
+	}
+	cache := emptyCache()
+	for _, class := range []string{"MotoGP", "Moto2"} {
+		labels := map[string]string{"round": "RD01", "class": class, "resolution": "1080p"}
+		cache.AddItem(&FeedItem{Feed: "F", Item: &gofeed.Item{GUID: "earlier-" + class}}, labels,
+			[]string{"round=RD01|class=" + class})
+	}
+	ctx := &RunContext{
+		Cache:        cache,
+		History:      &HistoryFile{guidIndex: map[string]int{}},
+		transmission: client,
+	}
+	rss := &gofeed.Feed{Items: []*gofeed.Item{
+		makeGofeedItemWithEnclosure("RD01.Bundle.720p", "bundle", torrentSrv.URL+"/b.torrent"),
+	}}
+	extractor := &ExtractorSet{Labels: map[string]LabelDef{
+		"round":      {Regexp: `(RD\d+)`},
+		"class":      {Regexp: `(MotoGP|Moto2|Moto3)`},
+		"resolution": {Regexp: `(1080p|720p)`},
+	}}
+	(&OnceCmd{TorrentCacheDir: t.TempDir()}).processFeed(ctx, "F", feedCfg, rss, extractor)
+	return ctx, added
+}
+
+func TestBundlePolicy_None_DownloadsInFull(t *testing.T) {
+	_, added := bundleRun(t, BundlePolicy{})
+	require.NotNil(t, added)
+	assert.NotContains(t, added, "files-unwanted")
+}
+
+func TestBundlePolicy_SkipCovered(t *testing.T) {
+	ctx, added := bundleRun(t, BundlePolicy{SkipCovered: true})
+	require.NotNil(t, added)
+	assert.Equal(t, []any{float64(2)}, added["files-wanted"])
+	assert.Equal(t, []any{float64(0), float64(1)}, added["files-unwanted"])
+
+	records := ctx.History.GetRecords()
+	require.Len(t, records, 1)
+	assert.Equal(t, "dispatched", records[0].Outcome)
+	assert.Equal(t, "bundle: 2 file(s) not downloaded, already have round=RD01|class=Moto2, round=RD01|class=MotoGP",
+		records[0].Reason)
+}
+
+func TestBundlePolicy_MinNewKeysSkipsBundle(t *testing.T) {
+	ctx, added := bundleRun(t, BundlePolicy{MinNewKeys: 2})
+	assert.Nil(t, added)
+
+	records := ctx.History.GetRecords()
+	require.Len(t, records, 1)
+	assert.Equal(t, "skipped", records[0].Outcome)
+	assert.Equal(t, "bundle adds 1 of 3 identity keys, MinNewKeys is 2", records[0].Reason)
+	assert.True(t, ctx.Cache.Exists("F", &FeedItem{Item: &gofeed.Item{GUID: "bundle"}}),
+		"a skipped bundle is cached so it is not re-evaluated every run")
+}
+
+// A single-key winner is not a bundle, so MinNewKeys leaves it alone.
+func TestApplyBundlePolicy_SingleKeyIgnoresMinNewKeys(t *testing.T) {
+	feedCfg := Feed{
+		Identity: []string{"round"},
+		Groups:   []Group{{Require: map[string][]string{}}},
+		Bundle:   BundlePolicy{MinNewKeys: 2},
+	}
+	c := makeCandidate("g", map[string]string{"round": "RD01"}, nil)
+	assert.Empty(t, applyBundlePolicy(feedCfg, c, emptyCache()))
+}
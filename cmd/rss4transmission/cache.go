@@ -21,6 +21,8 @@ package main
 import (
 	"encoding/json"
 	"os"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -30,11 +32,31 @@ const (
 )
 
 type CacheFile struct {
-	Version  int              `json:"Version"`
-	Errors   map[string]int64 `json:"Errors"`
-	Seen     []CacheRecord    `json:"Seen"`
-	filename string
-	needSave bool
+	Version int              `json:"Version"`
+	Errors  map[string]int64 `json:"Errors"`
+	Seen    []CacheRecord    `json:"Seen"`
+	// Validators are the HTTP cache validators each feed was last processed
+	// against, by feed name.
+	Validators map[string]FeedValidators `json:"Validators,omitempty"`
+	// Backoff holds, by feed URL, when a tracker that answered 429 may be
+	// fetched again.
+	Backoff map[string]time.Time `json:"Backoff,omitempty"`
+	// Upgrades are dispatched upgrades waiting to complete before the
+	// torrents they supersede are removed.
+	Upgrades []PendingUpgrade `json:"Upgrades,omitempty"`
+	// Pending are winners held back by their feed's Delay.
+	Pending []PendingItem `json:"Pending,omitempty"`
+	// PostJobs are OnComplete actions waiting to run or to be tried again.
+	PostJobs []PostJob `json:"PostJobs,omitempty"`
+	// Covered are, by feed name, the identity keys its records have
+	// covered. They outlive the records SaveCache prunes, so Backfill does
+	// not search for those keys again.
+	Covered map[string][]string `json:"Covered,omitempty"`
+	// CompletionsSince is when watch first tracked completions. A torrent
+	// that finished before then gets no notification or OnComplete actions.
+	CompletionsSince time.Time `json:"CompletionsSince,omitzero"`
+	filename         string
+	needSave         bool
 
 	// identityIndex maps identity key → all label maps seen for that key.
 	// Rebuilt from Seen on load; never persisted.
@@ -46,9 +68,16 @@ type CacheRecord struct {
 	Published    time.Time         `json:"Published"`
 	AddTime      time.Time         `json:"AddTime"`
 	GUID         string            `json:"GUID"`
+	Title        string            `json:"Title,omitempty"`
 	Complete     bool              `json:"Complete"`
 	Labels       map[string]string `json:"Labels,omitempty"`
 	IdentityKeys []string          `json:"IdentityKeys,omitempty"`
+	InfoHash     string            `json:"InfoHash,omitempty"`
+	TorrentID    int64             `json:"TorrentID,omitempty"`
+	// Completed is when Transmission finished downloading the torrent.
+	Completed time.Time `json:"Completed,omitzero"`
+	// Removed is when Retention removed the torrent from Transmission.
+	Removed time.Time `json:"Removed,omitzero"`
 }
 
 func OpenCache(path string) (*CacheFile, error) {
@@ -69,6 +98,10 @@ func OpenCache(path string) (*CacheFile, error) {
 	}
 	cache.filename = cacheFile
 	cache.rebuildIdentityIndex()
+	// A cache written before Covered was kept starts it from its records.
+	for _, r := range cache.Seen {
+		cache.addCovered(r.Feed, r.IdentityKeys)
+	}
 	return &cache, nil
 }
 
@@ -84,6 +117,41 @@ func (c *CacheFile) rebuildIdentityIndex() {
 	}
 }
 
+// HasIdentityKey reports whether any cached record covers key.
+func (c *CacheFile) HasIdentityKey(key string) bool {
+	_, ok := c.identityIndex[key]
+	return ok
+}
+
+// CoveredKeys returns every identity key a record of any feed has covered,
+// including those of records since pruned.
+func (c *CacheFile) CoveredKeys() map[string]bool {
+	covered := make(map[string]bool, len(c.identityIndex))
+	for key := range c.identityIndex {
+		covered[key] = true
+	}
+	for _, keys := range c.Covered {
+		for _, key := range keys {
+			covered[key] = true
+		}
+	}
+	return covered
+}
+
+// addCovered adds keys to the identity keys feedName has covered.
+func (c *CacheFile) addCovered(feedName string, keys []string) {
+	for _, key := range keys {
+		if slices.Contains(c.Covered[feedName], key) {
+			continue
+		}
+		if c.Covered == nil {
+			c.Covered = map[string][]string{}
+		}
+		c.Covered[feedName] = append(c.Covered[feedName], key)
+		c.needSave = true
+	}
+}
+
 // BestRankForKey returns the best (lowest) preference rank seen for the given
 // identity key, or (nil, false) if the key has never been cached.
 func (c *CacheFile) BestRankForKey(key string, prefer []PreferDimension) ([]int, bool) {
@@ -101,6 +169,234 @@ func (c *CacheFile) BestRankForKey(key string, prefer []PreferDimension) ([]int,
 	return best, true
 }
 
+// Superseded returns the records of feedName's torrents that a torrent
+// ranked ranks, by identity key, makes obsolete: every key a record covers is
+// in ranks, at a strictly better rank than the record's. A bundle with a key
+// the new torrent does not cover is not superseded. Only torrents this tool
+// added, and has not removed since, are returned: a record without a torrent
+// ID was skipped, added by hand or already in Transmission.
+func (c *CacheFile) Superseded(feedName string, ranks map[string][]int, prefer []PreferDimension) []CacheRecord {
+	var out []CacheRecord
+	for _, r := range c.Seen {
+		if r.Feed != feedName || len(r.IdentityKeys) == 0 || r.TorrentID == 0 || !r.Removed.IsZero() {
+			continue
+		}
+		rank := PreferenceRank(r.Labels, prefer)
+		superseded := true
+		for _, key := range r.IdentityKeys {
+			if newRank, ok := ranks[key]; !ok || !IsBetter(newRank, rank) {
+				superseded = false
+				break
+			}
+		}
+		if superseded {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Supersedes returns the records counts accepts that rank better than r on
+// one of the identity keys r covers, and whether every key r covers has one:
+// whether r is superseded.
+func (c *CacheFile) Supersedes(r CacheRecord, prefer []PreferDimension, counts func(CacheRecord) bool) ([]CacheRecord, bool) {
+	if len(r.IdentityKeys) == 0 {
+		return nil, false
+	}
+	rank := PreferenceRank(r.Labels, prefer)
+	var better []CacheRecord
+	for _, key := range r.IdentityKeys {
+		found := false
+		for _, o := range c.Seen {
+			if (o.Feed == r.Feed && o.GUID == r.GUID) || !slices.Contains(o.IdentityKeys, key) ||
+				!IsBetter(PreferenceRank(o.Labels, prefer), rank) || !counts(o) {
+				continue
+			}
+			found = true
+			if !slices.ContainsFunc(better, func(b CacheRecord) bool { return b.Feed == o.Feed && b.GUID == o.GUID }) {
+				better = append(better, o)
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return better, true
+}
+
+// MarkRemoved records that the torrent of feedName/guid was removed from
+// Transmission at when.
+func (c *CacheFile) MarkRemoved(feedName, guid string, when time.Time) {
+	for i, r := range c.Seen {
+		if r.Feed == feedName && r.GUID == guid {
+			c.Seen[i].Removed = when
+			c.needSave = true
+		}
+	}
+}
+
+// MarkComplete records that the torrent of feedName/guid finished
+// downloading at when.
+func (c *CacheFile) MarkComplete(feedName, guid string, when time.Time) {
+	for i, r := range c.Seen {
+		if r.Feed == feedName && r.GUID == guid {
+			c.Seen[i].Complete = true
+			c.Seen[i].Completed = when
+			c.needSave = true
+		}
+	}
+}
+
+// TrackCompletionsSince returns CompletionsSince, setting it to now the
+// first time.
+func (c *CacheFile) TrackCompletionsSince(now time.Time) time.Time {
+	if c.CompletionsSince.IsZero() {
+		c.CompletionsSince = now
+		c.needSave = true
+	}
+	return c.CompletionsSince
+}
+
+// AddPostJob queues an OnComplete action.
+func (c *CacheFile) AddPostJob(job PostJob) {
+	c.PostJobs = append(c.PostJobs, job)
+	c.needSave = true
+}
+
+// PostJobsDue reports whether any queued action is due at now.
+func (c *CacheFile) PostJobsDue(now time.Time) bool {
+	return slices.ContainsFunc(c.PostJobs, func(job PostJob) bool { return !now.Before(job.NextTry) })
+}
+
+// FinishPostJob records a run of a queued action: it stays queued as job,
+// with its attempts and next try, when retry is set, and is dropped when not.
+// An action no longer queued is left out.
+func (c *CacheFile) FinishPostJob(job PostJob, retry bool) {
+	i := slices.IndexFunc(c.PostJobs, func(q PostJob) bool {
+		return q.Feed == job.Feed && q.GUID == job.GUID && q.Action == job.Action
+	})
+	if i < 0 {
+		return
+	}
+	if retry {
+		c.PostJobs[i] = job
+	} else {
+		c.PostJobs = slices.Delete(c.PostJobs, i, i+1)
+	}
+	c.needSave = true
+}
+
+// AddUpgrade records an upgrade waiting for its torrent to complete.
+func (c *CacheFile) AddUpgrade(u PendingUpgrade) {
+	c.Upgrades = append(c.Upgrades, u)
+	c.needSave = true
+}
+
+// SetUpgrades replaces the pending upgrades with those still waiting.
+func (c *CacheFile) SetUpgrades(pending []PendingUpgrade) {
+	if len(pending) != len(c.Upgrades) {
+		c.needSave = true
+	}
+	c.Upgrades = pending
+}
+
+// PendingSince returns when feedName first held the item guid, or another
+// item covering one of its identity keys: a better release that turns up
+// during the wait carries on from the first one's window, rather than
+// starting one of its own.
+func (c *CacheFile) PendingSince(feedName, guid string, keys []string) (time.Time, bool) {
+	var since time.Time
+	found := false
+	for _, p := range c.Pending {
+		if p.Feed != feedName {
+			continue
+		}
+		if p.GUID != guid && !slices.ContainsFunc(p.Keys, func(k string) bool { return slices.Contains(keys, k) }) {
+			continue
+		}
+		if !found || p.FirstSeen.Before(since) {
+			since, found = p.FirstSeen, true
+		}
+	}
+	return since, found
+}
+
+// PendingItems returns feedName's pending items.
+func (c *CacheFile) PendingItems(feedName string) []PendingItem {
+	var out []PendingItem
+	for _, p := range c.Pending {
+		if p.Feed == feedName {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// SetPending replaces feedName's pending items with items.
+func (c *CacheFile) SetPending(feedName string, items []PendingItem) {
+	kept := slices.DeleteFunc(slices.Clone(c.Pending), func(p PendingItem) bool { return p.Feed == feedName })
+	if len(kept) == len(c.Pending) && len(items) == 0 {
+		return
+	}
+	c.Pending = append(kept, items...)
+	c.needSave = true
+}
+
+// FindInfoHash returns the cached record of a torrent with infoHash, which
+// may have come from another feed under another GUID.
+func (c *CacheFile) FindInfoHash(infoHash string) (CacheRecord, bool) {
+	if infoHash == "" {
+		return CacheRecord{}, false
+	}
+	for _, r := range c.Seen {
+		if strings.EqualFold(r.InfoHash, infoHash) {
+			return r, true
+		}
+	}
+	return CacheRecord{}, false
+}
+
+// FeedValidators returns the validators stored for feedName if they belong to
+// fetchURL, and the zero value otherwise.
+func (c *CacheFile) FeedValidators(feedName, fetchURL string) FeedValidators {
+	v, ok := c.Validators[feedName]
+	if !ok || v.Fingerprint != urlFingerprint(fetchURL) {
+		return FeedValidators{}
+	}
+	return v
+}
+
+// SetFeedValidators records the validators feedName was processed against. A
+// response without validators clears the entry.
+func (c *CacheFile) SetFeedValidators(feedName string, v FeedValidators) {
+	if c.Validators[feedName] == v {
+		return
+	}
+	if v.Empty() {
+		delete(c.Validators, feedName)
+	} else {
+		if c.Validators == nil {
+			c.Validators = map[string]FeedValidators{}
+		}
+		c.Validators[feedName] = v
+	}
+	c.needSave = true
+}
+
+// BackoffUntil returns when feedURL may next be fetched, or the zero time.
+func (c *CacheFile) BackoffUntil(feedURL string) time.Time {
+	return c.Backoff[feedURL]
+}
+
+// SetBackoff holds off fetching feedURL until until.
+func (c *CacheFile) SetBackoff(feedURL string, until time.Time) {
+	if c.Backoff == nil {
+		c.Backoff = map[string]time.Time{}
+	}
+	c.Backoff[feedURL] = until
+	c.needSave = true
+}
+
 // SaveCache updates the cache and removes any entries older than the specified
 // duration.
 // SaveCache prunes records and writes to disk. A record is kept if it is within
@@ -130,6 +426,35 @@ func (c *CacheFile) SaveCache(d time.Duration, activeGUIDs map[string]map[string
 		}
 	}
 
+	// Validators, pending items and covered keys of a feed no longer
+	// configured would only grow the file, and an expired backoff says
+	// nothing.
+	if activeGUIDs != nil {
+		for name := range c.Validators {
+			if _, ok := activeGUIDs[name]; !ok {
+				delete(c.Validators, name)
+				c.needSave = true
+			}
+		}
+		for name := range c.Covered {
+			if _, ok := activeGUIDs[name]; !ok {
+				delete(c.Covered, name)
+				c.needSave = true
+			}
+		}
+		for _, p := range c.Pending {
+			if _, ok := activeGUIDs[p.Feed]; !ok {
+				c.SetPending(p.Feed, nil)
+			}
+		}
+	}
+	for u, until := range c.Backoff {
+		if time.Now().After(until) {
+			delete(c.Backoff, u)
+			c.needSave = true
+		}
+	}
+
 	if !deletedRecord && !c.needSave {
 		log.Debugf("no changes, so skipping cache saving")
 		return nil
@@ -177,9 +502,12 @@ func (c *CacheFile) AddItem(item *FeedItem, labels map[string]string, identityKe
 		Feed:         item.Feed,
 		AddTime:      now,
 		GUID:         item.Item.GUID,
+		Title:        item.Item.Title,
 		Complete:     item.Complete,
 		Labels:       labels,
 		IdentityKeys: identityKeys,
+		InfoHash:     item.InfoHash(),
+		TorrentID:    item.TorrentID,
 	}
 	if item.Item.PublishedParsed != nil {
 		cr.Published = *item.Item.PublishedParsed
@@ -193,13 +521,15 @@ func (c *CacheFile) AddItem(item *FeedItem, labels map[string]string, identityKe
 	for _, key := range identityKeys {
 		c.identityIndex[key] = append(c.identityIndex[key], labels)
 	}
+	c.addCovered(item.Feed, identityKeys)
 
 	c.needSave = true
 }
 
 // RemoveEntry removes the Seen record(s) matching feedName+guid, letting the
-// item be re-evaluated on the next run (e.g. after a config change). Returns
-// true if anything was removed.
+// item be re-evaluated on the next run (e.g. after a config change), and the
+// identity keys they covered from the feed's covered keys, so Backfill
+// searches for them again. Returns true if anything was removed.
 func (c *CacheFile) RemoveEntry(feedName, guid string) bool {
 	removed := false
 	rebuildIndex := false
@@ -210,6 +540,11 @@ func (c *CacheFile) RemoveEntry(feedName, guid string) bool {
 			if len(s.Labels) > 0 {
 				rebuildIndex = true
 			}
+			if covered, ok := c.Covered[feedName]; ok {
+				c.Covered[feedName] = slices.DeleteFunc(covered, func(key string) bool {
+					return slices.Contains(s.IdentityKeys, key)
+				})
+			}
 			continue
 		}
 		newSeen = append(newSeen, s)
@@ -653,3 +653,27 @@ func TestSaveCache_SkipsWhenUnchanged(t *testing.T) {
 		t.Error("SaveCache should not write file when needSave=false and no pruning")
 	}
 }
+
+// A Multi label is stored as its joined string, so a cache written before
+// Multi existed reads the same, and one written after ranks on the best value.
+func TestBestRankForKey_MultiLabelSurvivesReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	c, err := OpenCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.AddItem(makeFeedItem("g1"), map[string]string{"round": "RD01", "audio": "de,en"}, []string{"round=RD01"})
+	if err = c.SaveCache(24*time.Hour, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefer := []PreferDimension{{Label: "audio", Order: []string{"en", "de"}, multi: true}}
+	rank, ok := reopened.BestRankForKey("round=RD01", prefer)
+	if !ok || rank[0] != 0 {
+		t.Errorf("rank = %v, %v; want [0] from the en member", rank, ok)
+	}
+}
@@ -30,11 +30,13 @@ func formatGB(bytes int64) string {
 // CancelMetadata holds display information about a torrent that is stored
 // alongside the Transmission torrent ID in the cancel Store.
 type CancelMetadata struct {
-	Title     string
-	FeedName  string
-	Files     []string
-	Labels    map[string]string
-	SizeBytes int64
+	Title    string
+	FeedName string
+	Files    []string
+	// SkippedFiles are the paths file rules left out of the download.
+	SkippedFiles []string
+	Labels       map[string]string
+	SizeBytes    int64
 }
 
 type storeEntry struct {
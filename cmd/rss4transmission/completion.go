@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hekmon/transmissionrpc/v3"
+)
+
+// completionFields are the torrent-get fields checkCompletions needs.
+var completionFields = []string{"id", "hashString", "name", "percentDone", "doneDate", "downloadDir", "totalSize", "files"}
+
+// Completions marks the torrents the seen cache says were dispatched complete
+// once Transmission has finished them, sends the completed notification for
+// each unless notify is false, and starts their OnComplete actions. Then it
+// saves the cache and history.
+//
+// A torrent that finished before completions were first tracked is only
+// marked, so turning tracking on does not announce every torrent in the cache.
+func (cmd *OnceCmd) Completions(ctx *RunContext, notify bool) error {
+	if ctx.Tx() != nil {
+		checkCompletions(ctx, ctx.Cache.TrackCompletionsSince(time.Now()), notify)
+	}
+	cmd.startPostJobs(ctx)
+	return saveAfterPass(ctx)
+}
+
+// startPostJobs runs the OnComplete actions that are due or, under watch,
+// wakes its worker to run them outside the reload lock.
+func (cmd *OnceCmd) startPostJobs(ctx *RunContext) {
+	if cmd.postWork == nil {
+		runPostJobs(ctx, time.Now())
+		return
+	}
+	if ctx.Cache.PostJobsDue(time.Now()) {
+		select {
+		case cmd.postWork <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// saveAfterPass saves the cache and history after a pass that is not a
+// regular run.
+func saveAfterPass(ctx *RunContext) error {
+	// Like Backfill, such a pass says nothing about what is still in the
+	// feeds, so pruning by GUID presence is left to the next regular run.
+	activeGUIDs := collectActiveGUIDs(Feeds{}, ctx.Config.Feeds)
+	cacheTime := time.Duration(ctx.Config.SeenCacheDays) * 24 * time.Hour
+	if err := ctx.Cache.SaveCache(cacheTime, activeGUIDs); err != nil {
+		return fmt.Errorf("unable to save seen cache: %w", err)
+	}
+	if ctx.History != nil {
+		if err := ctx.History.SaveHistory(cacheTime); err != nil {
+			log.WithError(err).Warn("Unable to save history file")
+		}
+	}
+	return nil
+}
+
+// checkCompletions polls Transmission for the torrents dispatched and not yet
+// complete, and queues the OnComplete actions of those that are. A torrent no
+// longer in Transmission is left alone: it may have been removed by hand, and
+// it will not complete now.
+func checkCompletions(ctx *RunContext, since time.Time, notify bool) {
+	if !slices.ContainsFunc(ctx.Cache.Seen, tracksCompletion) {
+		return
+	}
+	torrents, err := ctx.Tx().TorrentGet(context.TODO(), completionFields, nil)
+	if err != nil {
+		log.WithError(err).Warn("Unable to list Transmission's torrents, checking completions next time")
+		return
+	}
+	for _, r := range slices.Clone(ctx.Cache.Seen) {
+		if !tracksCompletion(r) {
+			continue
+		}
+		t := findTorrent(torrents, r.InfoHash, r.TorrentID)
+		if t == nil || t.PercentDone == nil || *t.PercentDone < 1 {
+			continue
+		}
+		finished := time.Now()
+		if t.DoneDate != nil && t.DoneDate.Unix() > 0 {
+			finished = *t.DoneDate
+		}
+		log.Infof("%s: completed %s", r.Feed, r.Title)
+		ctx.Cache.MarkComplete(r.Feed, r.GUID, finished)
+		if ctx.History != nil {
+			ctx.History.MarkComplete(r.Feed, r.GUID, finished)
+		}
+		if finished.Before(since) {
+			continue
+		}
+		if notify && !ctx.announced.take(t) {
+			sendNtfyCompleted(ctx, r, t)
+		}
+		if i := slices.IndexFunc(ctx.Config.Feeds, func(f Feed) bool { return f.Name == r.Feed }); i >= 0 {
+			queuePostJobs(ctx, ctx.Config.Feeds[i], newCompletedTorrent(r, t, finished))
+		}
+	}
+}
+
+// hookAnnouncements are the torrents /notify-complete has sent the completed
+// notification for, by Transmission ID and by name, so polling does not send
+// it a second time. The hook runs for every torrent, not only the ones this
+// tool tracks, so an entry polling never takes is dropped after
+// announcementTTL.
+type hookAnnouncements struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+// announcementTTL is how long an announcement waits to be taken.
+const announcementTTL = 24 * time.Hour
+
+func (a *hookAnnouncements) add(id int64, name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	for k, at := range a.entries {
+		if now.Sub(at) > announcementTTL {
+			delete(a.entries, k)
+		}
+	}
+	if a.entries == nil {
+		a.entries = map[string]time.Time{}
+	}
+	if id != 0 {
+		a.entries[fmt.Sprintf("id:%d", id)] = now
+	}
+	if name != "" {
+		a.entries["name:"+name] = now
+	}
+}
+
+// take reports whether t was announced, by its ID or failing that its name,
+// and forgets it.
+func (a *hookAnnouncements) take(t *transmissionrpc.Torrent) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var keys []string
+	if t.ID != nil {
+		keys = append(keys, fmt.Sprintf("id:%d", *t.ID))
+	}
+	if t.Name != nil {
+		keys = append(keys, "name:"+*t.Name)
+	}
+	found := false
+	for _, k := range keys {
+		if _, ok := a.entries[k]; ok {
+			found = true
+			delete(a.entries, k)
+		}
+	}
+	return found
+}
+
+// newCompletedTorrent describes t, the torrent of r, as it finished. Only the
+// files it has downloaded in full are listed: the rest were not wanted.
+func newCompletedTorrent(r CacheRecord, t *transmissionrpc.Torrent, finished time.Time) completedTorrent {
+	ct := completedTorrent{
+		Feed:      r.Feed,
+		Title:     r.Title,
+		GUID:      r.GUID,
+		ID:        r.TorrentID,
+		InfoHash:  r.InfoHash,
+		Labels:    r.Labels,
+		Published: r.Published,
+		Completed: finished,
+		Files:     []string{},
+	}
+	if t.ID != nil {
+		ct.ID = *t.ID
+	}
+	if t.HashString != nil {
+		ct.InfoHash = *t.HashString
+	}
+	if t.DownloadDir != nil {
+		ct.Dir = *t.DownloadDir
+	}
+	if ct.Title == "" && t.Name != nil {
+		ct.Title = *t.Name
+	}
+	for _, f := range t.Files {
+		if f.BytesCompleted >= f.Length {
+			ct.Files = append(ct.Files, f.Name)
+		}
+	}
+	return ct
+}
+
+// tracksCompletion reports whether r is a torrent this tool added to
+// Transmission and has not seen complete or removed yet.
+func tracksCompletion(r CacheRecord) bool {
+	return r.TorrentID != 0 && !r.Complete && r.Removed.IsZero()
+}
+
+// sendNtfyCompleted sends the completed notification for t, the torrent of r,
+// unless its feed has NoNotify or ntfy has no Topic.
+func sendNtfyCompleted(ctx *RunContext, r CacheRecord, t *transmissionrpc.Torrent) {
+	if ctx.Config.Ntfy.BaseURL == "" || ctx.Config.Ntfy.Topic == "" {
+		return
+	}
+	if i := slices.IndexFunc(ctx.Config.Feeds, func(f Feed) bool { return f.Name == r.Feed }); i >= 0 && ctx.Config.Feeds[i].NoNotify {
+		return
+	}
+	ntfyCtx := &NtfyTemplateContext{
+		Title:     r.Title,
+		FeedName:  r.Feed,
+		Labels:    r.Labels,
+		GUID:      r.GUID,
+		TorrentID: r.TorrentID,
+	}
+	if ntfyCtx.Title == "" && t.Name != nil {
+		ntfyCtx.Title = *t.Name
+	}
+	if t.ID != nil {
+		ntfyCtx.TorrentID = *t.ID
+	}
+	if t.DownloadDir != nil {
+		ntfyCtx.Dir = *t.DownloadDir
+	}
+	if t.TotalSize != nil {
+		ntfyCtx.SizeBytes = int64(t.TotalSize.Byte())
+	}
+	ntfyCtx.Size = formatGB(ntfyCtx.SizeBytes)
+	for _, f := range t.Files {
+		ntfyCtx.Files = append(ntfyCtx.Files, f.Name)
+	}
+	if err := NewNtfyClient(ctx.Config.Ntfy).SendTorrentCompleted(ntfyCtx); err != nil {
+		log.WithError(err).Warnf("%s: unable to send the completed notification of %s", r.Feed, r.Title)
+	}
+}
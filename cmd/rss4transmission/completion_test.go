@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// completionSetup tracks two dispatched torrents of tx, 1 of feed F and 2 of
+// the NoNotify feed Quiet, and returns the bodies of the ntfy notifications
+// sent.
+func completionSetup(t *testing.T) (*upgradeTransmission, *RunContext, *[]string) {
+	t.Helper()
+	tx := &upgradeTransmission{torrents: []map[string]any{
+		{"id": 1, "hashString": hash720, "name": "RD01.720p", "percentDone": 0.5, "doneDate": 0,
+			"downloadDir": "/d/motogp", "totalSize": 1 << 30, "files": []map[string]any{{"name": "RD01.720p.mkv"}}},
+		{"id": 2, "hashString": hash1080, "name": "RD01.1080p", "percentDone": 0.5, "doneDate": 0,
+			"downloadDir": "/d/quiet", "totalSize": 1 << 30, "files": []map[string]any{{"name": "RD01.1080p.mkv"}}},
+	}}
+	ctx := tx.serve(t)
+
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, r.Header.Get("Title")+"|"+string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	ctx.Config.Ntfy = mustValidateNtfyConfig(t, NtfyConfig{BaseURL: srv.URL, Topic: "torrents"})
+	ctx.Config.Feeds = []Feed{{Name: "F"}, {Name: "Quiet", NoNotify: true}}
+
+	for i, v := range []struct{ feed, res, hash string }{{"F", "720p", hash720}, {"Quiet", "1080p", hash1080}} {
+		ctx.Cache.Seen = append(ctx.Cache.Seen, CacheRecord{
+			Feed: v.feed, GUID: "guid-" + v.res, Title: "MotoGP.RD01.Race." + v.res, AddTime: time.Now(),
+			InfoHash: v.hash, TorrentID: int64(i + 1),
+		})
+		ctx.History.AddOrUpdateRecord(HistoryRecord{Feed: v.feed, GUID: "guid-" + v.res, Outcome: "dispatched"})
+	}
+	return tx, ctx, &bodies
+}
+
+func TestCheckCompletions(t *testing.T) {
+	tx, ctx, bodies := completionSetup(t)
+	since := time.Now().Add(-time.Hour)
+
+	checkCompletions(ctx, since, true)
+	assert.Empty(t, *bodies, "nothing has completed")
+	assert.False(t, ctx.Cache.Seen[0].Complete)
+
+	done := time.Now().Truncate(time.Second)
+	tx.complete(1)
+	tx.complete(2)
+	tx.torrents[0]["doneDate"] = done.Unix()
+	checkCompletions(ctx, since, true)
+	assert.Equal(t, []string{"Torrent Complete|MotoGP.RD01.Race.720p\n/d/motogp"}, *bodies, "Quiet has NoNotify")
+
+	for _, r := range ctx.Cache.Seen {
+		assert.True(t, r.Complete, r.GUID)
+		assert.False(t, r.Completed.IsZero(), r.GUID)
+	}
+	assert.True(t, done.Equal(ctx.Cache.Seen[0].Completed), "the finish time is Transmission's doneDate")
+	idx := ctx.History.guidIndex[historyKey("F", "guid-720p")]
+	assert.True(t, done.Equal(ctx.History.Records[idx].Completed))
+	assert.Equal(t, "dispatched", ctx.History.Records[idx].Outcome)
+
+	checkCompletions(ctx, since, true)
+	assert.Len(t, *bodies, 1, "a completed torrent is not announced again")
+}
+
+// A torrent that finished before tracking started is marked complete without
+// a notification, and one removed by Retention is no longer tracked.
+func TestCheckCompletions_BeforeSinceAndRemoved(t *testing.T) {
+	tx, ctx, bodies := completionSetup(t)
+	tx.complete(1)
+	tx.complete(2)
+	tx.torrents[0]["doneDate"] = time.Now().Add(-2 * time.Hour).Unix()
+	ctx.Cache.Seen[1].Removed = time.Now()
+
+	checkCompletions(ctx, time.Now().Add(-time.Hour), true)
+	assert.Empty(t, *bodies)
+	assert.True(t, ctx.Cache.Seen[0].Complete)
+	assert.False(t, ctx.Cache.Seen[1].Complete, "a removed torrent is left alone")
+}
+
+// A torrent /notify-complete has announced, matched by ID or by name, is not
+// announced again by polling; its OnComplete actions still run.
+func TestCheckCompletions_HookAnnounced(t *testing.T) {
+	tx, ctx, bodies := completionSetup(t)
+	ctx.Config.Feeds[1].NoNotify = false
+	ctx.announced.add(1, "")
+	ctx.announced.add(0, "RD01.1080p")
+	tx.complete(1)
+	tx.complete(2)
+
+	checkCompletions(ctx, time.Now().Add(-time.Hour), true)
+	assert.Empty(t, *bodies)
+	assert.True(t, ctx.Cache.Seen[0].Complete)
+	assert.True(t, ctx.Cache.Seen[1].Complete)
+	assert.Empty(t, ctx.announced.entries, "an announcement is taken once")
+}
+
+func TestTracksCompletion(t *testing.T) {
+	assert.True(t, tracksCompletion(CacheRecord{TorrentID: 3}))
+	assert.False(t, tracksCompletion(CacheRecord{InfoHash: hash720}), "not added by this tool")
+	assert.False(t, tracksCompletion(CacheRecord{TorrentID: 3, Complete: true}))
+	assert.False(t, tracksCompletion(CacheRecord{TorrentID: 3, Removed: time.Now()}))
+	assert.False(t, tracksCompletion(CacheRecord{}))
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const (
+	// defaultRateLimitBackoff is how long a URL is left alone after a 429
+	// that names no Retry-After.
+	defaultRateLimitBackoff = 15 * time.Minute
+	// maxRateLimitBackoff caps a Retry-After, so a typo on the tracker's end
+	// cannot silence a feed for a month.
+	maxRateLimitBackoff = 24 * time.Hour
+)
+
+// FeedValidators are the cache validators from the last response a feed was
+// fully processed against. Sending them back lets the server answer 304 Not
+// Modified instead of the whole feed.
+type FeedValidators struct {
+	// Fingerprint identifies the fetch URL the validators belong to, so a
+	// changed URL or Torznab query starts over with a full fetch. It is a
+	// hash rather than the URL so that no API key is written to the cache.
+	Fingerprint  string `json:"Fingerprint"`
+	ETag         string `json:"ETag,omitempty"`
+	LastModified string `json:"LastModified,omitempty"`
+}
+
+// Empty reports whether there is nothing to send.
+func (v FeedValidators) Empty() bool {
+	return v.ETag == "" && v.LastModified == ""
+}
+
+// feedResponse is the outcome of a conditional fetch.
+type feedResponse struct {
+	// Feed is nil when NotModified is set.
+	Feed        *gofeed.Feed
+	NotModified bool
+	// Validators are the response's own, to be stored once the feed has
+	// been processed.
+	Validators FeedValidators
+}
+
+// rateLimitedError is a 429, or a 503 with Retry-After: the server asked to
+// be left alone until Until.
+type rateLimitedError struct {
+	Status int
+	Until  time.Time
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("HTTP status %d, backing off until %s", e.Status, e.Until.Format(time.RFC3339))
+}
+
+// fetchFeedConditional fetches feedURL, sending validators as If-None-Match and
+// If-Modified-Since. A 304 comes back as NotModified with no feed. A 429, or a
+// 503 naming a Retry-After, comes back as a *rateLimitedError.
+func fetchFeedConditional(client *FeedClient, feedURL string, validators FeedValidators) (*feedResponse, error) {
+	if client == nil {
+		client = defaultFeedClient
+	}
+	req, err := client.NewRequest(feedURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch %s: %w", feedURL, err)
+	}
+	if validators.ETag != "" {
+		req.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.LastModified)
+	}
+	resp, err := client.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch %s: %w", feedURL, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	now := time.Now()
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return &feedResponse{NotModified: true, Validators: validators}, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now)
+		if !ok {
+			wait = defaultRateLimitBackoff
+		}
+		return nil, &rateLimitedError{Status: resp.StatusCode, Until: now.Add(wait)}
+	case resp.StatusCode == http.StatusServiceUnavailable:
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now); ok {
+			return nil, &rateLimitedError{Status: resp.StatusCode, Until: now.Add(wait)}
+		}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected HTTP status %d fetching %s", resp.StatusCode, feedURL)
+	}
+
+	rss, err := gofeed.NewParser().Parse(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &feedResponse{
+		Feed: rss,
+		Validators: FeedValidators{
+			Fingerprint:  urlFingerprint(feedURL),
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		},
+	}, nil
+}
+
+// urlFingerprint is the FeedValidators.Fingerprint of feedURL.
+func urlFingerprint(feedURL string) string {
+	sum := sha256.Sum256([]byte(feedURL))
+	return hex.EncodeToString(sum[:8])
+}
+
+// parseRetryAfter reads a Retry-After header, either delay-seconds or an
+// HTTP-date, as a wait from now. The wait is capped at maxRateLimitBackoff.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	var wait time.Duration
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		wait = time.Duration(secs) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		wait = max(at.Sub(now), 0)
+	} else {
+		return 0, false
+	}
+	return min(wait, maxRateLimitBackoff), true
+}
+
+// isRateLimited reports whether err is a server asking to be left alone, and
+// until when.
+func isRateLimited(err error) (time.Time, bool) {
+	var rl *rateLimitedError
+	if errors.As(err, &rl) {
+		return rl.Until, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	d, ok := parseRetryAfter("120", now)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, d)
+
+	d, ok = parseRetryAfter("Fri, 01 May 2026 12:05:00 GMT", now)
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Minute, d)
+
+	d, ok = parseRetryAfter("999999", now)
+	assert.True(t, ok)
+	assert.Equal(t, maxRateLimitBackoff, d, "a huge Retry-After is capped")
+
+	_, ok = parseRetryAfter("", now)
+	assert.False(t, ok)
+	_, ok = parseRetryAfter("soon", now)
+	assert.False(t, ok)
+	_, ok = parseRetryAfter("-5", now)
+	assert.False(t, ok)
+}
+
+// conditionalServer serves testRSS with an ETag, answering 304 to a request
+// that sends it back, and records what each request sent.
+type conditionalServer struct {
+	mu          sync.Mutex
+	ifNoneMatch []string
+	status      int
+	retryAfter  string
+}
+
+func (s *conditionalServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ifNoneMatch = append(s.ifNoneMatch, r.Header.Get("If-None-Match"))
+	if s.status != 0 {
+		if s.retryAfter != "" {
+			w.Header().Set("Retry-After", s.retryAfter)
+		}
+		w.WriteHeader(s.status)
+		return
+	}
+	if r.Header.Get("If-None-Match") == `"v1"` {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", `"v1"`)
+	_, _ = w.Write([]byte(testRSS))
+}
+
+func conditionalContext(t *testing.T, url string) *RunContext {
+	cache, err := OpenCache(filepath.Join(t.TempDir(), "seen.json"))
+	require.NoError(t, err)
+	return &RunContext{
+		Config: Config{
+			Feeds: []Feed{{
+				Name: "F", URL: url, Extractor: "e", Identity: []string{"round"},
+				Groups: []Group{{Require: map[string][]string{"round": {"never"}}}},
+			}},
+			Extractors: map[string]*ExtractorSet{"e": {Labels: map[string]LabelDef{
+				"round": {Regexp: `(RD\d+)`},
+			}}},
+			SeenCacheDays: 1,
+		},
+		Cache:   cache,
+		History: &HistoryFile{guidIndex: map[string]int{}},
+	}
+}
+
+// The ETag of a processed response is sent back next run, and the 304 that
+// answers it leaves the feed unprocessed.
+func TestOnceRun_ConditionalGet(t *testing.T) {
+	s := &conditionalServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	ctx := conditionalContext(t, srv.URL)
+	cmd := &OnceCmd{NoAction: true}
+
+	require.NoError(t, cmd.Run(ctx))
+	processed := len(ctx.History.GetRecords())
+	require.NotZero(t, processed)
+	assert.Equal(t, `"v1"`, ctx.Cache.Validators["F"].ETag)
+
+	require.NoError(t, cmd.Run(ctx))
+	assert.Equal(t, []string{"", `"v1"`}, s.ifNoneMatch)
+	assert.Len(t, ctx.History.GetRecords(), processed, "a 304 skips parsing and extraction")
+
+	// The validators survive a reload of the cache file.
+	reopened, err := OpenCache(ctx.Cache.filename)
+	require.NoError(t, err)
+	assert.Equal(t, `"v1"`, reopened.FeedValidators("F", srv.URL).ETag)
+	assert.Empty(t, reopened.FeedValidators("F", srv.URL+"/other").ETag,
+		"validators for another URL are not sent")
+}
+
+// A feed that shares its URL with one never processed against the stored
+// response must not be skipped by a 304.
+func TestSharedValidators_RequireAgreement(t *testing.T) {
+	ctx := conditionalContext(t, "http://tracker/rss")
+	second := ctx.Config.Feeds[0]
+	second.Name = "G"
+	ctx.Config.Feeds = append(ctx.Config.Feeds, second)
+	ctx.Cache.SetFeedValidators("F", FeedValidators{Fingerprint: urlFingerprint("http://tracker/rss"), ETag: `"v1"`})
+	cmd := &OnceCmd{}
+
+	assert.True(t, cmd.sharedValidators(ctx, "http://tracker/rss").Empty())
+
+	ctx.Cache.SetFeedValidators("G", ctx.Cache.Validators["F"])
+	assert.Equal(t, `"v1"`, cmd.sharedValidators(ctx, "http://tracker/rss").ETag)
+}
+
+// A 429 backs the URL off for Retry-After: the next run does not fetch it.
+func TestOnceRun_RateLimitedBacksOff(t *testing.T) {
+	s := &conditionalServer{status: http.StatusTooManyRequests, retryAfter: "600"}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	ctx := conditionalContext(t, srv.URL)
+	cmd := &OnceCmd{NoAction: true}
+
+	require.NoError(t, cmd.Run(ctx))
+	until := ctx.Cache.BackoffUntil(srv.URL)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), until, time.Minute)
+
+	require.NoError(t, cmd.Run(ctx))
+	assert.Len(t, s.ifNoneMatch, 1, "the backed-off URL is not fetched")
+
+	ctx.Cache.SetBackoff(srv.URL, time.Now().Add(-time.Second))
+	s.status = 0
+	require.NoError(t, cmd.Run(ctx))
+	assert.Len(t, s.ifNoneMatch, 2)
+	assert.Empty(t, ctx.Cache.Backoff, "an expired backoff is dropped on save")
+}
@@ -39,6 +39,10 @@ var ConfigDefaults = map[string]interface{}{
 	"Transmission.WebUI":      true,
 	"SeenCacheDays":           30,
 	"Notifications.TokenTTLH": 24,
+	"Fetch.Concurrency":       defaultFetchConcurrency,
+	"Fetch.PerHost":           defaultFetchPerHost,
+	"MaxDispatchPerRun":       1,
+	"DiskSpace.Reserve":       defaultDiskReserve,
 
 	"SpeedTest.Enabled":         false,
 	"SpeedTest.Interval":        "1h",
@@ -68,6 +72,14 @@ type Config struct {
 	SpeedTest     SpeedTestConfig          `koanf:"SpeedTest"`
 	SeenFile      string                   `koanf:"SeenFile"`
 	SeenCacheDays int                      `koanf:"SeenCacheDays"`
+	Fetch         FetchConfig              `koanf:"Fetch"`
+	DiskSpace     DiskSpaceConfig          `koanf:"DiskSpace"`
+	// MaxDispatchPerRun caps how many items one run dispatches across all
+	// feeds; the rest wait for a later run. 0 means unlimited.
+	MaxDispatchPerRun int `koanf:"MaxDispatchPerRun"`
+	// Quota and Schedule limit what every feed together dispatches.
+	Quota    QuotaPolicy      `koanf:"Quota"`
+	Schedule DispatchSchedule `koanf:"Schedule"`
 }
 
 type NtfyConfig struct {
@@ -103,6 +115,9 @@ type NtfyConfig struct {
 	VpnRotatedTitle        string `koanf:"VpnRotatedTitle"`
 	VpnRotatedBody         string `koanf:"VpnRotatedBody"`
 	VpnRotatedPriority     string `koanf:"VpnRotatedPriority"`
+	LowSpaceTitle          string `koanf:"LowSpaceTitle"`
+	LowSpaceBody           string `koanf:"LowSpaceBody"`
+	LowSpacePriority       string `koanf:"LowSpacePriority"`
 
 	startedTitleTmpl        *template.Template
 	startedBodyTmpl         *template.Template
@@ -122,6 +137,8 @@ type NtfyConfig struct {
 	vpnRotatedTitleTmpl     *template.Template
 	vpnRotatedBodyTmpl      *template.Template
 	portOpenedBodyTmpl      *template.Template
+	lowSpaceTitleTmpl       *template.Template
+	lowSpaceBodyTmpl        *template.Template
 }
 
 type PortCheckConfig struct {
@@ -256,6 +273,25 @@ func (t *Transmission) URL() string {
 	return fmt.Sprintf("%s://%s:%d%s", proto, t.Host, t.Port, t.Path)
 }
 
+// FetchConfig caps how many RSS and .torrent fetches a run makes at once.
+type FetchConfig struct {
+	// Concurrency is the most fetches in flight overall.
+	Concurrency int `koanf:"Concurrency"`
+	// PerHost is the most fetches in flight against any one host.
+	PerHost int `koanf:"PerHost"`
+}
+
+// Validate rejects negative caps. Zero means the default.
+func (f *FetchConfig) Validate() error {
+	if f.Concurrency < 0 {
+		return fmt.Errorf("Fetch.Concurrency %d must not be negative", f.Concurrency)
+	}
+	if f.PerHost < 0 {
+		return fmt.Errorf("Fetch.PerHost %d must not be negative", f.PerHost)
+	}
+	return nil
+}
+
 type GluetunConfig struct {
 	Host             string `koanf:"Host"`
 	Port             int    `koanf:"Port"`
@@ -309,6 +345,7 @@ func (g *GluetunConfig) RotateDuration() time.Duration {
 
 type Feed struct {
 	Name           string   `koanf:"Name"`
+	Type           string   `koanf:"Type"`
 	URL            string   `koanf:"URL"`
 	Exclude        []string `koanf:"Exclude"`
 	DownloadPath   string   `koanf:"DownloadPath"`
@@ -319,6 +356,60 @@ type Feed struct {
 	MaxSize        string   `koanf:"MaxSize"`
 	MinSize        string   `koanf:"MinSize"`
 
+	// TransmissionLabels names the labels given to each torrent in
+	// Transmission, as label:value.
+	TransmissionLabels []string `koanf:"TransmissionLabels"`
+
+	// Interval is how often watch fetches this feed; it defaults to --sleep.
+	// Jitter adds a random delay of up to its value to each interval.
+	Interval string `koanf:"Interval"`
+	Jitter   string `koanf:"Jitter"`
+
+	// MaxDispatchPerRun caps how many of this feed's winners one run
+	// dispatches, within the global MaxDispatchPerRun. 0 means no cap of
+	// its own.
+	MaxDispatchPerRun int `koanf:"MaxDispatchPerRun"`
+
+	// HTTP is the client profile for the RSS fetch and the .torrent download.
+	HTTP HTTPProfile `koanf:"HTTP"`
+
+	// Torznab is the search a Type: torznab feed runs against URL.
+	Torznab TorznabQuery `koanf:"Torznab"`
+
+	// Backfill is what the feed expects to see and how to search for what
+	// is missing.
+	Backfill Backfill `koanf:"Backfill"`
+
+	// Files narrows the download of every winner to the files it wants.
+	Files FileRules `koanf:"Files"`
+
+	// Torrent is set on every torrent the feed adds to Transmission.
+	Torrent TorrentSettings `koanf:"Torrent"`
+
+	// Bundle is what to do with a winner covering keys the cache already
+	// has.
+	Bundle BundlePolicy `koanf:"Bundle"`
+
+	// Upgrade is when to stop upgrading a key, and what to do with the
+	// version an upgrade replaces.
+	Upgrade UpgradePolicy `koanf:"Upgrade"`
+
+	// Delay holds winners back for a while in case a better release
+	// follows.
+	Delay DelayPolicy `koanf:"Delay"`
+
+	// Retention is when to remove the feed's torrents from Transmission.
+	Retention RetentionPolicy `koanf:"Retention"`
+
+	// OnComplete is what to do with the feed's torrents once they complete.
+	OnComplete OnComplete `koanf:"OnComplete"`
+
+	// Quota caps what the feed dispatches over a rolling period, within
+	// the global Quota.
+	Quota QuotaPolicy `koanf:"Quota"`
+	// Schedule is when the feed dispatches, within the global Schedule.
+	Schedule DispatchSchedule `koanf:"Schedule"`
+
 	// Label-mode fields
 	Extractor string            `koanf:"Extractor"`
 	Identity  []string          `koanf:"Identity"`
@@ -330,6 +421,16 @@ type Feed struct {
 	exclude  []*regexp.Regexp
 	minSize  uint64
 	maxSize  uint64
+	client   *FeedClient
+	interval time.Duration
+	jitter   time.Duration
+
+	downloadPath   *template.Template
+	backfillQuery  *template.Template
+	backfillClient *FeedClient
+
+	// multi holds the extractor's Multi labels, set by Validate.
+	multi map[string]bool
 }
 
 // validateFeedNames ensures every feed has a non-empty, unique Name. Since
@@ -369,13 +470,99 @@ func (f *Feed) Validate(name string, extractors map[string]*ExtractorSet) error
 	if f.Action == "notify" && f.NoNotify {
 		return fmt.Errorf("feed %q: NoNotify cannot be combined with Action: notify", name)
 	}
+	switch f.Type {
+	case "", FeedTypeRSS:
+	case FeedTypeTorznab:
+		if err := f.Torznab.Validate(); err != nil {
+			return fmt.Errorf("feed %q: %w", name, err)
+		}
+	default:
+		return fmt.Errorf("feed %q: Type must be %q or %q, got %q", name, FeedTypeRSS, FeedTypeTorznab, f.Type)
+	}
+	if f.MaxDispatchPerRun < 0 {
+		return fmt.Errorf("feed %q: MaxDispatchPerRun %d must not be negative", name, f.MaxDispatchPerRun)
+	}
+	f.setMultiLabels(extractors[f.Extractor])
+	if err := f.validateDestination(extractors[f.Extractor]); err != nil {
+		return fmt.Errorf("feed %q: %w", name, err)
+	}
+	if err := f.Files.Validate(); err != nil {
+		return fmt.Errorf("feed %q: %w", name, err)
+	}
+	if err := f.Torrent.Validate(); err != nil {
+		return fmt.Errorf("feed %q: %w", name, err)
+	}
+	if err := f.Bundle.Validate(); err != nil {
+		return fmt.Errorf("feed %q: %w", name, err)
+	}
+	for i := range f.Prefer {
+		if err := f.Prefer[i].Validate(); err != nil {
+			return fmt.Errorf("feed %q: Prefer[%d]: %w", name, i, err)
+		}
+	}
+	if err := f.Upgrade.Validate(f.Prefer); err != nil {
+		return fmt.Errorf("feed %q: %w", name, err)
+	}
+	if err := f.Delay.Validate(f.Prefer); err != nil {
+		return fmt.Errorf("feed %q: %w", name, err)
+	}
+	if err := f.Retention.Validate(); err != nil {
+		return fmt.Errorf("feed %q: %w", name, err)
+	}
+	if err := f.Quota.Validate(); err != nil {
+		return fmt.Errorf("feed %q: %w", name, err)
+	}
+	if err := f.Schedule.Validate(); err != nil {
+		return fmt.Errorf("feed %q: %w", name, err)
+	}
+	known := func(label string) bool { return f.knownField(extractors[f.Extractor], label) }
+	if err := f.OnComplete.Validate(known); err != nil {
+		return fmt.Errorf("feed %q: %w", name, err)
+	}
+	for i := range f.Groups {
+		if err := f.Groups[i].Validate(); err != nil {
+			return fmt.Errorf("feed %q: Groups[%d]: %w", name, i, err)
+		}
+		if err := f.Groups[i].Files.Validate(); err != nil {
+			return fmt.Errorf("feed %q: Groups[%d]: %w", name, i, err)
+		}
+		if err := f.Groups[i].OnComplete.Validate(known); err != nil {
+			return fmt.Errorf("feed %q: Groups[%d]: %w", name, i, err)
+		}
+	}
+	if f.Backfill.Enabled() {
+		if err := f.Backfill.Validate(f); err != nil {
+			return fmt.Errorf("feed %q: %w", name, err)
+		}
+	}
 	return nil
 }
 
+// setMultiLabels records which of es's labels are Multi on the feed, its
+// Groups and its Prefer, which match and rank those labels value by value.
+// Any other label's value is one value, whatever commas it has.
+func (f *Feed) setMultiLabels(es *ExtractorSet) {
+	f.multi = es.multiLabels()
+	for i := range f.Groups {
+		f.Groups[i].multi = f.multi
+	}
+	for i := range f.Prefer {
+		f.Prefer[i].multi = f.multi[f.Prefer[i].Label]
+	}
+}
+
 // Check is the pre-filter applied before label extraction. It returns false and
 // a human-readable reason if the item matches any Exclude pattern or falls
 // outside the MinSize/MaxSize bounds. All other items return (true, "").
 func (f *Feed) Check(item *gofeed.Item) (bool, string) {
+	if ok, reason := f.CheckTitle(item); !ok {
+		return false, reason
+	}
+	return f.CheckSize(item, claimedSize(item))
+}
+
+// CheckTitle is the Exclude half of Check.
+func (f *Feed) CheckTitle(item *gofeed.Item) (bool, string) {
 	f.compile()
 
 	for _, r := range f.exclude {
@@ -383,16 +570,14 @@ func (f *Feed) Check(item *gofeed.Item) (bool, string) {
 			return false, "matched exclude filter"
 		}
 	}
+	return true, ""
+}
 
-	var totalSize uint64
-	for _, e := range item.Enclosures {
-		size, err := strconv.ParseUint(e.Length, 10, 64)
-		if err != nil {
-			log.WithError(err).Errorf("Unable to parse enclosure length: %s", e.Length)
-			continue
-		}
-		totalSize += size
-	}
+// CheckSize is the MinSize/MaxSize half of Check, against totalSize. processFeed
+// passes the .torrent's own total when it has one, since the feed's claim is
+// only a guess.
+func (f *Feed) CheckSize(item *gofeed.Item, totalSize uint64) (bool, string) {
+	f.compile()
 
 	if f.minSize > 0 && totalSize < f.minSize {
 		log.Debugf("Too small: %s [%d]", item.Title, totalSize)
@@ -406,3 +591,28 @@ func (f *Feed) Check(item *gofeed.Item) (bool, string) {
 
 	return true, ""
 }
+
+// HasSizeLimits reports whether MinSize or MaxSize is set.
+func (f *Feed) HasSizeLimits() bool {
+	f.compile()
+	return f.minSize > 0 || f.maxSize > 0
+}
+
+// claimedSize is the size the feed gives for item. An indexer's size attr is
+// the content size. Enclosure lengths are only a guess at it, and some indexers
+// put the .torrent file's own size there.
+func claimedSize(item *gofeed.Item) uint64 {
+	if size, ok := torznabSize(item); ok {
+		return size
+	}
+	var totalSize uint64
+	for _, e := range item.Enclosures {
+		size, err := strconv.ParseUint(e.Length, 10, 64)
+		if err != nil {
+			log.WithError(err).Errorf("Unable to parse enclosure length: %s", e.Length)
+			continue
+		}
+		totalSize += size
+	}
+	return totalSize
+}
@@ -584,6 +584,79 @@ Feeds:
     Groups:
       - Require:
           series: [X]
+`,
+		},
+		{
+			name: "bad HTTP Timeout",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    HTTP:
+      Timeout: whenever
+    Groups:
+      - Require:
+          series: [X]
+`,
+		},
+		{
+			name: "HTTP Proxy without a scheme",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    HTTP:
+      Proxy: gluetun:8888
+    Groups:
+      - Require:
+          series: [X]
+`,
+		},
+		{
+			name: "missing HTTP CookieFile",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    HTTP:
+      CookieFile: /nonexistent/cookies.txt
+    Groups:
+      - Require:
+          series: [X]
+`,
+		},
+		{
+			name: "zero Interval",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    Interval: 0s
+    Groups:
+      - Require:
+          series: [X]
+`,
+		},
+		{
+			name: "bad Jitter",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    Jitter: a bit
+    Groups:
+      - Require:
+          series: [X]
 `,
 		},
 		{
@@ -616,6 +689,264 @@ Extractors:
         Regexp: '(.+)'
         Normalize:
           '[unterminated': canonical
+`,
+		},
+		{
+			name: "negative MaxDispatchPerRun",
+			yaml: validExtractorYAML + `
+MaxDispatchPerRun: -1
+`,
+		},
+		{
+			name: "negative feed MaxDispatchPerRun",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    MaxDispatchPerRun: -2
+    Groups:
+      - Require:
+          series: [X]
+`,
+		},
+		{
+			name: "bad Files Include regexp",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    Files:
+      Include: ['(mkv']
+    Groups:
+      - Require:
+          series: [X]
+`,
+		},
+		{
+			name: "bad group Files Exclude regexp",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    Groups:
+      - Require:
+          series: [X]
+        Files:
+          Exclude: ['[sample']
+`,
+		},
+		{
+			name: "negative Bundle.MinNewKeys",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    Bundle:
+      MinNewKeys: -1
+    Groups:
+      - Require:
+          series: [X]
+`,
+		},
+		{
+			name: "unknown group MultiMatch",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    Groups:
+      - Require:
+          series: [X]
+        MultiMatch: most
+`,
+		},
+		{
+			name: "bad group Rule",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    Groups:
+      - Require:
+          series: [X]
+        Rule: "round in 5.."
+`,
+		},
+		{
+			name: "Prefer with both order and direction",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    Prefer:
+      - label: series
+        order: [X]
+        direction: higher
+    Groups:
+      - Require:
+          series: [X]
+`,
+		},
+		{
+			name: "Upgrade Cutoff not in Prefer",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    Upgrade:
+      Cutoff:
+        resolution: 1080p
+    Groups:
+      - Require:
+          series: [X]
+`,
+		},
+		{
+			name: "DownloadPath names an unknown label",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    DownloadPath: /media/{{.series}}/{{.season}}
+    Groups:
+      - Require:
+          series: [X]
+`,
+		},
+		{
+			name: "bad group Torrent Priority",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    Groups:
+      - Require:
+          series: [X]
+        Torrent:
+          Priority: urgent
+`,
+		},
+		{
+			name: "bad Retention SeedTime",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    Retention:
+      SeedTime: forever
+    Groups:
+      - Require:
+          series: [X]
+`,
+		},
+		{
+			name: "bad group OnComplete Organize label",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    Groups:
+      - Require:
+          series: [X]
+        OnComplete:
+          Organize:
+            Path: /library/{{.season}}/{{.File}}{{.Ext}}
+`,
+		},
+		{
+			name: "bad Delay Wait",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    Delay:
+      Wait: later
+    Groups:
+      - Require:
+          series: [X]
+`,
+		},
+		{
+			name: "negative Fetch.PerHost",
+			yaml: validExtractorYAML + `
+Fetch:
+  PerHost: -1
+`,
+		},
+		{
+			name: "bad DiskSpace Reserve",
+			yaml: validExtractorYAML + `
+DiskSpace:
+  Reserve: lots
+`,
+		},
+		{
+			name: "bad global Schedule",
+			yaml: validExtractorYAML + `
+Schedule:
+  Allow:
+    - From: "25:00"
+      To: "07:00"
+`,
+		},
+		{
+			name: "feed Quota without Period",
+			yaml: validExtractorYAML + `
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    Quota:
+      Torrents: 20
+`,
+		},
+		{
+			name: "feed Quota Period beyond SeenCacheDays",
+			yaml: validExtractorYAML + `
+SeenCacheDays: 7
+Feeds:
+  - Name: F
+    URL: https://example.com/f
+    Extractor: demo
+    Identity: [series]
+    Quota:
+      Torrents: 20
+      Period: 30d
+`,
+		},
+		{
+			name: "global Quota Period beyond SeenCacheDays",
+			yaml: validExtractorYAML + `
+Quota:
+  Size: 1TB
+  Period: 60d
 `,
 		},
 		{
@@ -0,0 +1,85 @@
+package main
+
+/*
+ * RSS4Transmission
+ * Copyright (c) 2023 Aaron Turner  <aturner at synfin dot net>
+ *
+ * This program is free software: you can redistribute it
+ * and/or modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or with the authors permission any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// skipReasonAlreadyHave prefixes the history reason for a winner whose
+// infohash is already in the seen cache or in Transmission.
+const skipReasonAlreadyHave = "already have"
+
+// alreadyHave reports where a torrent with item's infohash already is: a
+// seen cache record, which may be another feed's copy of the same release, or
+// Transmission, which also holds torrents added by hand. It returns "" when
+// neither has it or the item's infohash is unknown.
+func (cmd *OnceCmd) alreadyHave(ctx *RunContext, item *FeedItem) string {
+	hash := item.InfoHash()
+	if hash == "" {
+		return ""
+	}
+	if r, ok := ctx.Cache.FindInfoHash(hash); ok {
+		return fmt.Sprintf("seen cache (feed %s)", r.Feed)
+	}
+	if cmd.transmissionHashes(ctx)[strings.ToLower(hash)] {
+		return "Transmission"
+	}
+	return ""
+}
+
+// transmissionHashes returns the infohashes of the torrents in Transmission,
+// asked for once per run. If Transmission cannot be asked, the set is empty
+// and its own duplicate rejection in addTorrent is the only guard left.
+func (cmd *OnceCmd) transmissionHashes(ctx *RunContext) map[string]bool {
+	if cmd.txHashes != nil {
+		return cmd.txHashes
+	}
+	cmd.txHashes = map[string]bool{}
+	if ctx.Tx() == nil {
+		return cmd.txHashes
+	}
+	torrents, err := ctx.Tx().TorrentGet(context.TODO(), []string{"hashString"}, nil)
+	if err != nil {
+		log.WithError(err).Warn("Unable to list Transmission's torrents, relying on its duplicate check")
+		return cmd.txHashes
+	}
+	for _, t := range torrents {
+		if t.HashString != nil {
+			cmd.txHashes[strings.ToLower(*t.HashString)] = true
+		}
+	}
+	return cmd.txHashes
+}
+
+// skipAlreadyHave records w as already had, and caches it so its identity
+// keys get the credit, when its infohash is found by alreadyHave. It returns
+// whether it did, in which case nothing is to be submitted.
+func (cmd *OnceCmd) skipAlreadyHave(ctx *RunContext, feedName string, w *candidate, labels map[string]string, keys []string) bool {
+	source := cmd.alreadyHave(ctx, w.item)
+	if source == "" {
+		return false
+	}
+	log.Infof("%s already have: %s (in %s)", feedName, w.item.Item.Title, source)
+	ctx.Cache.AddItem(w.item, labels, keys)
+	ctx.recordItemHistory(feedName, w.item, "skipped", fmt.Sprintf("%s: in %s", skipReasonAlreadyHave, source), labels)
+	return true
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hekmon/transmissionrpc/v3"
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dedupTransmission is a fake Transmission holding torrents with the given
+// hashes. It counts torrent-get and torrent-add calls.
+type dedupTransmission struct {
+	hashes []string
+	gets   int
+	adds   int
+}
+
+func (d *dedupTransmission) serve(t *testing.T) *RunContext {
+	t.Helper()
+	const sessionID = "test-session-id"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Transmission-Session-Id") != sessionID {
+			w.Header().Set("X-Transmission-Session-Id", sessionID)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		var req struct {
+			Method string `json:"method"`
+			Tag    int    `json:"tag"`
+		}
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &req))
+
+		args := map[string]any{}
+		switch req.Method {
+		case "torrent-get":
+			d.gets++
+			var torrents []map[string]any
+			for _, h := range d.hashes {
+				torrents = append(torrents, map[string]any{"hashString": h})
+			}
+			args["torrents"] = torrents
+		case "torrent-add":
+			d.adds++
+			args["torrent-added"] = map[string]any{"id": d.adds}
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]any{
+			"result": "success", "tag": req.Tag, "arguments": args,
+		}))
+	}))
+	t.Cleanup(srv.Close)
+	endpoint, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	client, err := transmissionrpc.New(endpoint, nil)
+	require.NoError(t, err)
+	return &RunContext{
+		Cache:        emptyCache(),
+		History:      &HistoryFile{guidIndex: map[string]int{}},
+		transmission: client,
+	}
+}
+
+func dedupFeed(name, title string, guids ...string) (Feed, *gofeed.Feed) {
+	rss := &gofeed.Feed{}
+	for _, guid := range guids {
+		rss.Items = append(rss.Items, &gofeed.Item{
+			Title: title,
+			GUID:  guid,
+			Link:  "magnet:?xt=urn:btih:" + testInfoHash + "&dn=RD01",
+		})
+	}
+	return Feed{
+		Name: name, Identity: []string{"round"},
+		Groups: []Group{{Require: map[string][]string{}}},
+	}, rss
+}
+
+var dedupExtractor = &ExtractorSet{Labels: map[string]LabelDef{"round": {Regexp: `(RD\d+|Round \d+)`}}}
+
+// The same release on a second tracker, under another GUID and a title that
+// yields another identity key, is not added again: the first feed's cache
+// record has its infohash.
+func TestDispatch_AlreadyHave_CrossFeed(t *testing.T) {
+	tx := &dedupTransmission{}
+	ctx := tx.serve(t)
+	cmd := &OnceCmd{}
+
+	feedF, rssF := dedupFeed("F", "MotoGP.RD01.Race", "tracker-a-1")
+	cmd.processFeed(ctx, "F", feedF, rssF, dedupExtractor)
+	feedG, rssG := dedupFeed("G", "MotoGP 2026 Round 1 Race", "tracker-b-9")
+	cmd.processFeed(ctx, "G", feedG, rssG, dedupExtractor)
+
+	assert.Equal(t, 1, tx.adds)
+	rec := ctx.History.GetRecords()[1]
+	assert.Equal(t, "tracker-b-9", rec.GUID)
+	assert.Equal(t, "skipped", rec.Outcome)
+	assert.Equal(t, "already have: in seen cache (feed F)", rec.Reason)
+
+	// G's identity key is credited, so the item is not re-evaluated.
+	assert.Len(t, ctx.Cache.Seen, 2)
+	assert.Equal(t, []string{"round=Round 1"}, ctx.Cache.Seen[1].IdentityKeys)
+}
+
+// A torrent added to Transmission by hand is found by its hashString, which
+// is asked for once per run.
+func TestDispatch_AlreadyHave_InTransmission(t *testing.T) {
+	tx := &dedupTransmission{hashes: []string{strings.ToUpper(testInfoHash)}}
+	ctx := tx.serve(t)
+	cmd := &OnceCmd{}
+
+	feedF, rssF := dedupFeed("F", "MotoGP.RD01.Race", "guid-1")
+	cmd.processFeed(ctx, "F", feedF, rssF, dedupExtractor)
+
+	assert.Zero(t, tx.adds)
+	records := ctx.History.GetRecords()
+	require.Len(t, records, 1)
+	assert.Equal(t, "already have: in Transmission", records[0].Reason)
+	assert.True(t, ctx.Cache.HasIdentityKey("round=RD01"))
+
+	feedG, rssG := dedupFeed("G", "MotoGP.RD01.Race", "guid-2")
+	ctx.Cache = emptyCache()
+	cmd.processFeed(ctx, "G", feedG, rssG, dedupExtractor)
+	assert.Zero(t, tx.adds)
+	assert.Equal(t, 1, tx.gets, "Transmission's torrents are listed once per run")
+}
+
+func TestCacheFile_FindInfoHash(t *testing.T) {
+	c := emptyCache()
+	c.Seen = append(c.Seen, CacheRecord{Feed: "F", GUID: "g", InfoHash: testInfoHash})
+
+	r, ok := c.FindInfoHash(strings.ToUpper(testInfoHash))
+	assert.True(t, ok)
+	assert.Equal(t, "F", r.Feed)
+	_, ok = c.FindInfoHash("")
+	assert.False(t, ok, "an unknown infohash matches nothing")
+}
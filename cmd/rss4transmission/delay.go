@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	str2duration "github.com/xhit/go-str2duration/v2"
+)
+
+// DelayPolicy holds a feed's winners back for a while in case a better
+// release of the same thing turns up, as the 1080p one often does some
+// minutes after the 720p. A winner that already ranks at the top, or at
+// Unless, is dispatched at once.
+type DelayPolicy struct {
+	// Wait is how long after a winner is first seen it is held, e.g. 30m.
+	// Empty means no delay.
+	Wait string `koanf:"Wait"`
+	// Unless is a value for some of the feed's Prefer labels that is good
+	// enough to dispatch without waiting. Without it, only a winner at the
+	// head of every Prefer order is.
+	Unless map[string]string `koanf:"Unless"`
+}
+
+// waitingOutcome is the history outcome of a held winner.
+const waitingOutcome = "waiting"
+
+// Validate parses Wait and checks the Unless values.
+func (d *DelayPolicy) Validate(prefer []PreferDimension) error {
+	if d.Wait == "" {
+		if len(d.Unless) > 0 {
+			return fmt.Errorf("Delay: Unless needs a Wait")
+		}
+		return nil
+	}
+	wait, err := str2duration.ParseDuration(d.Wait)
+	if err != nil {
+		return fmt.Errorf("Delay: unable to parse Wait %q: %w", d.Wait, err)
+	}
+	if wait <= 0 {
+		return fmt.Errorf("Delay: Wait %q must be positive", d.Wait)
+	}
+	return validatePreferValues("Delay: Unless", d.Unless, prefer)
+}
+
+// window returns the parsed Wait, or 0 when there is none or it does not
+// parse, which loadConfig has already rejected.
+func (d *DelayPolicy) window() time.Duration {
+	if d.Wait == "" {
+		return 0
+	}
+	wait, err := str2duration.ParseDuration(d.Wait)
+	if err != nil {
+		return 0
+	}
+	return wait
+}
+
+// releaseRank is the rank a winner must reach to skip the wait: Unless, or
+// the head of every Order dimension. A numeric dimension has no head, so
+// without Unless it never holds a winner back.
+func (d *DelayPolicy) releaseRank(prefer []PreferDimension) []int {
+	release := d.Unless
+	if len(release) == 0 {
+		release = map[string]string{}
+		for _, dim := range prefer {
+			if len(dim.Order) > 0 {
+				release[dim.Label] = dim.Order[0]
+			}
+		}
+	}
+	return PreferenceRank(release, prefer)
+}
+
+// bestRank returns the best rank among w's coverages that some Group
+// matches.
+func bestRank(feedCfg Feed, w *candidate) []int {
+	var best []int
+	for _, cov := range w.coverages(feedCfg.Identity) {
+		if !slices.ContainsFunc(feedCfg.Groups, func(g Group) bool { return g.Matches(cov.labels) }) {
+			continue
+		}
+		if rank := PreferenceRank(w.rankLabels(cov.labels), feedCfg.Prefer); best == nil || IsBetter(rank, best) {
+			best = rank
+		}
+	}
+	return best
+}
+
+// holdUntil reports whether w, first seen at firstSeen, is to be held back
+// by the feed's Delay at now, and until when.
+func holdUntil(feedCfg Feed, w *candidate, firstSeen, now time.Time) (time.Time, bool) {
+	wait := feedCfg.Delay.window()
+	if wait == 0 {
+		return time.Time{}, false
+	}
+	if rank := bestRank(feedCfg, w); rank != nil && !IsBetter(feedCfg.Delay.releaseRank(feedCfg.Prefer), rank) {
+		return time.Time{}, false
+	}
+	until := firstSeen.Add(wait)
+	return until, now.Before(until)
+}
+
+// PendingItem is a winner held back by its feed's Delay. The item is kept
+// whole, so it is evaluated again even after it drops off the feed. FirstSeen
+// is when the first winner of its identity keys was held.
+type PendingItem struct {
+	Feed      string       `json:"Feed"`
+	GUID      string       `json:"GUID"`
+	Keys      []string     `json:"Keys,omitempty"`
+	FirstSeen time.Time    `json:"FirstSeen"`
+	Item      *gofeed.Item `json:"Item"`
+}
+
+// withPendingItems returns items followed by the feed's pending items that
+// are not among them.
+func withPendingItems(items []*gofeed.Item, pending []PendingItem) []*gofeed.Item {
+	if len(pending) == 0 {
+		return items
+	}
+	out := slices.Clone(items)
+	for _, p := range pending {
+		if p.Item != nil && !slices.ContainsFunc(items, func(item *gofeed.Item) bool { return item.GUID == p.GUID }) {
+			out = append(out, p.Item)
+		}
+	}
+	return out
+}
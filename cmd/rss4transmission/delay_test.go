@@ -0,0 +1,184 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func delayFeed(delay DelayPolicy) Feed {
+	feed := upgradeFeed(UpgradePolicy{})
+	feed.Delay = delay
+	return feed
+}
+
+// A 720p winner waits; once its window is over it is dispatched even though
+// the feed no longer lists it.
+func TestDelay_HoldsThenReleasesAfterWindow(t *testing.T) {
+	tx := &upgradeTransmission{}
+	ctx := tx.serve(t)
+	cmd := &OnceCmd{}
+	feed := delayFeed(DelayPolicy{Wait: "30m"})
+
+	cmd.processFeed(ctx, "F", feed, upgradeItem("720p", hash720), upgradeExtractor)
+	assert.Empty(t, tx.torrents)
+	require.Len(t, ctx.Cache.Pending, 1)
+	assert.Equal(t, "guid-720p", ctx.Cache.Pending[0].GUID)
+	assert.False(t, ctx.Cache.Exists("F", &FeedItem{Item: &gofeed.Item{GUID: "guid-720p"}}),
+		"a held item must not be marked seen")
+	rec, ok := ctx.History.FindRecord("F", "guid-720p")
+	require.True(t, ok)
+	assert.Equal(t, waitingOutcome, rec.Outcome)
+	assert.True(t, strings.HasPrefix(rec.Reason, "waiting until "), rec.Reason)
+
+	// Still inside the window: held again, with the same first-seen time.
+	firstSeen := ctx.Cache.Pending[0].FirstSeen
+	cmd.processFeed(ctx, "F", feed, &gofeed.Feed{}, upgradeExtractor)
+	assert.Empty(t, tx.torrents)
+	require.Len(t, ctx.Cache.Pending, 1)
+	assert.Equal(t, firstSeen, ctx.Cache.Pending[0].FirstSeen)
+
+	ctx.Cache.Pending[0].FirstSeen = time.Now().Add(-31 * time.Minute)
+	cmd.processFeed(ctx, "F", feed, &gofeed.Feed{}, upgradeExtractor)
+	require.Len(t, tx.torrents, 1)
+	assert.Equal(t, hash720, tx.torrents[0]["hashString"])
+	assert.Empty(t, ctx.Cache.Pending)
+	rec, _ = ctx.History.FindRecord("F", "guid-720p")
+	assert.Equal(t, "dispatched", rec.Outcome)
+}
+
+// A top-ranked release ends the wait at once, and outranks the held one.
+func TestDelay_TopRankReleasesAtOnce(t *testing.T) {
+	tx := &upgradeTransmission{}
+	ctx := tx.serve(t)
+	cmd := &OnceCmd{}
+	feed := delayFeed(DelayPolicy{Wait: "30m"})
+
+	cmd.processFeed(ctx, "F", feed, upgradeItem("1080p", hash1080), upgradeExtractor)
+	require.Len(t, ctx.Cache.Pending, 1, "1080p is not the head of the order")
+
+	cmd.processFeed(ctx, "F", feed, upgradeItem("2160p", hash2160), upgradeExtractor)
+	require.Len(t, tx.torrents, 1)
+	assert.Equal(t, hash2160, tx.torrents[0]["hashString"])
+	assert.Empty(t, ctx.Cache.Pending)
+	rec, _ := ctx.History.FindRecord("F", "guid-1080p")
+	assert.Equal(t, "skipped", rec.Outcome)
+}
+
+func TestDelay_Unless(t *testing.T) {
+	tx := &upgradeTransmission{}
+	ctx := tx.serve(t)
+	cmd := &OnceCmd{}
+	feed := delayFeed(DelayPolicy{Wait: "30m", Unless: map[string]string{"resolution": "1080p"}})
+
+	cmd.processFeed(ctx, "F", feed, upgradeItem("1080p", hash1080), upgradeExtractor)
+	assert.Len(t, tx.torrents, 1, "1080p meets Unless")
+	assert.Empty(t, ctx.Cache.Pending)
+
+	cmd.processFeed(ctx, "F", feed, &gofeed.Feed{Items: []*gofeed.Item{{
+		Title: "MotoGP.RD02.Race.720p", GUID: "guid-rd02", Link: "magnet:?xt=urn:btih:" + hash720,
+	}}}, upgradeExtractor)
+	assert.Len(t, tx.torrents, 1, "720p is below Unless")
+	assert.Len(t, ctx.Cache.Pending, 1)
+}
+
+// A better release arriving during the wait carries on from the window of
+// the first release of its key, rather than starting a full wait of its own.
+func TestDelay_WindowFollowsIdentityKey(t *testing.T) {
+	tx := &upgradeTransmission{}
+	ctx := tx.serve(t)
+	cmd := &OnceCmd{}
+	feed := delayFeed(DelayPolicy{Wait: "30m"})
+
+	cmd.processFeed(ctx, "F", feed, upgradeItem("720p", hash720), upgradeExtractor)
+	require.Len(t, ctx.Cache.Pending, 1)
+	firstSeen := time.Now().Add(-20 * time.Minute)
+	ctx.Cache.Pending[0].FirstSeen = firstSeen
+
+	cmd.processFeed(ctx, "F", feed, upgradeItem("1080p", hash1080), upgradeExtractor)
+	assert.Empty(t, tx.torrents, "1080p is not the top rank, so it waits too")
+	require.Len(t, ctx.Cache.Pending, 1)
+	assert.Equal(t, "guid-1080p", ctx.Cache.Pending[0].GUID)
+	assert.Equal(t, []string{"round=RD01"}, ctx.Cache.Pending[0].Keys)
+	assert.True(t, ctx.Cache.Pending[0].FirstSeen.Equal(firstSeen), "the 720p's window carries over")
+
+	ctx.Cache.Pending[0].FirstSeen = time.Now().Add(-31 * time.Minute)
+	cmd.processFeed(ctx, "F", feed, &gofeed.Feed{}, upgradeExtractor)
+	assert.Len(t, tx.torrents, 1)
+	assert.Empty(t, ctx.Cache.Pending)
+}
+
+// A backfill pass leaves the items the feed holds to its regular runs: it
+// neither evaluates them nor drops them from the pending set.
+func TestDelay_BackfillKeepsFeedPending(t *testing.T) {
+	tx := &upgradeTransmission{}
+	ctx := tx.serve(t)
+	cmd := &OnceCmd{}
+	feed := delayFeed(DelayPolicy{Wait: "30m"})
+
+	cmd.processFeed(ctx, "F", feed, upgradeItem("720p", hash720), upgradeExtractor)
+	require.Len(t, ctx.Cache.Pending, 1)
+	ctx.Cache.Pending[0].FirstSeen = time.Now().Add(-time.Hour)
+	held := ctx.Cache.Pending[0]
+
+	results := upgradeItem("720p", hash1080)
+	results.Items[0].Title = "MotoGP.RD02.Race.720p"
+	results.Items[0].GUID = "guid-rd02"
+	cmd.backfill = true
+	cmd.processFeed(ctx, "F", feed, results, upgradeExtractor)
+	cmd.backfill = false
+
+	assert.Empty(t, tx.torrents, "the held item is not dispatched by backfill")
+	require.Len(t, ctx.Cache.Pending, 2)
+	assert.Equal(t, "guid-rd02", ctx.Cache.Pending[0].GUID)
+	assert.Equal(t, held, ctx.Cache.Pending[1])
+
+	cmd.processFeed(ctx, "F", feed, &gofeed.Feed{}, upgradeExtractor)
+	assert.Len(t, tx.torrents, 1, "the feed's own run releases it")
+}
+
+func TestCacheFile_PendingSurvivesReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen.json")
+	c, err := OpenCache(path)
+	require.NoError(t, err)
+	published := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	c.SetPending("F", []PendingItem{{Feed: "F", GUID: "g", FirstSeen: published, Item: &gofeed.Item{
+		Title: "MotoGP.RD01.Race.720p", GUID: "g", PublishedParsed: &published,
+		Enclosures: []*gofeed.Enclosure{{URL: "https://example.com/a.torrent", Type: "application/x-bittorrent"}},
+	}}})
+	require.NoError(t, c.SaveCache(24*time.Hour, map[string]map[string]bool{"F": nil}))
+
+	c, err = OpenCache(path)
+	require.NoError(t, err)
+	items := c.PendingItems("F")
+	require.Len(t, items, 1)
+	assert.Equal(t, "MotoGP.RD01.Race.720p", items[0].Item.Title)
+	assert.Equal(t, "https://example.com/a.torrent", items[0].Item.Enclosures[0].URL)
+	since, ok := c.PendingSince("F", "g", nil)
+	assert.True(t, ok)
+	assert.True(t, since.Equal(published))
+
+	// A feed no longer configured loses its pending items.
+	require.NoError(t, c.SaveCache(24*time.Hour, map[string]map[string]bool{"G": nil}))
+	assert.Empty(t, c.Pending)
+}
+
+func TestDelayPolicy_Validate(t *testing.T) {
+	prefer := []PreferDimension{{Label: "resolution", Order: []string{"1080p", "720p"}}}
+	for _, d := range []DelayPolicy{{}, {Wait: "30m"}, {Wait: "1h", Unless: map[string]string{"resolution": "720p"}}} {
+		assert.NoError(t, d.Validate(prefer), "%+v", d)
+	}
+	for _, d := range []DelayPolicy{
+		{Wait: "soon"},
+		{Wait: "0s"},
+		{Unless: map[string]string{"resolution": "720p"}},
+		{Wait: "30m", Unless: map[string]string{"resolution": "480p"}},
+	} {
+		assert.Error(t, d.Validate(prefer), "%+v", d)
+	}
+}
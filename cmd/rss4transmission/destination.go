@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"unicode"
+
+	"github.com/hekmon/transmissionrpc/v3"
+	"github.com/mmcdole/gofeed"
+)
+
+// DownloadPath is a template over the winner's labels, e.g.
+// "/media/{{.series}}/{{.season}}", and over these fields describing the
+// item. A label of the same name wins over them.
+const (
+	destFieldFeed      = "Feed"
+	destFieldTitle     = "Title"
+	destFieldPublished = "Published" // 2006-01-02
+)
+
+var destFields = []string{destFieldFeed, destFieldTitle, destFieldPublished}
+
+// addOptions is what Transmission is told about a torrent as it is added.
+type addOptions struct {
+	// Dir is the download-dir. Empty leaves it to Transmission.
+	Dir string
+	// Labels are the Transmission 4 labels of the torrent.
+	Labels []string
+	// Settings are the feed's and groups' Torrent settings.
+	Settings TorrentSettings
+}
+
+// payload returns a torrent-add payload with opts set, for the caller to add
+// the .torrent or magnet link to.
+func (opts addOptions) payload() (transmissionrpc.TorrentAddPayload, error) {
+	payload, err := opts.Settings.addPayload()
+	if err != nil {
+		return payload, err
+	}
+	payload.DownloadDir = &opts.Dir
+	if len(opts.Labels) > 0 {
+		payload.Labels = opts.Labels
+	}
+	return payload, nil
+}
+
+// parseDownloadPath parses DownloadPath. A label the path names is required:
+// {{index . "season"}} reads one that may be missing.
+func parseDownloadPath(downloadPath string) (*template.Template, error) {
+	return parsePathTemplate("DownloadPath", downloadPath)
+}
+
+// parsePathTemplate parses text, the path template of field.
+func parsePathTemplate(field, text string) (*template.Template, error) {
+	tmpl, err := template.New(field).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s %q: %w", field, text, err)
+	}
+	return tmpl, nil
+}
+
+// knownField reports whether name is a label the feed's items can have, or
+// one of destFields.
+func (f *Feed) knownField(extractor *ExtractorSet, name string) bool {
+	if _, ok := extractor.Labels[name]; ok {
+		return true
+	}
+	if f.Type == FeedTypeTorznab && slices.Contains(torznabLabelAttrs, name) {
+		return true
+	}
+	return slices.Contains(destFields, name)
+}
+
+// validateDestination checks that DownloadPath parses and that it and
+// TransmissionLabels only name labels the feed can have.
+func (f *Feed) validateDestination(extractor *ExtractorSet) error {
+	known := func(name string) bool { return f.knownField(extractor, name) }
+	tmpl, err := parseDownloadPath(f.DownloadPath)
+	if err != nil {
+		return err
+	}
+	for _, name := range templateFields(tmpl) {
+		if !known(name) {
+			return fmt.Errorf("DownloadPath %q: %q is not a label of extractor %q", f.DownloadPath, name, f.Extractor)
+		}
+	}
+	for _, name := range f.TransmissionLabels {
+		if !known(name) {
+			return fmt.Errorf("TransmissionLabels: %q is not a label of extractor %q", name, f.Extractor)
+		}
+	}
+	return nil
+}
+
+// templateFields returns the field names, such as series in {{.series}},
+// tmpl reads.
+func templateFields(tmpl *template.Template) []string {
+	var fields []string
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n != nil {
+				for _, c := range n.Nodes {
+					walk(c)
+				}
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.PipeNode:
+			if n != nil {
+				for _, cmd := range n.Cmds {
+					walk(cmd)
+				}
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.FieldNode:
+			if !slices.Contains(fields, n.Ident[0]) {
+				fields = append(fields, n.Ident[0])
+			}
+		}
+	}
+	if tmpl.Tree != nil {
+		walk(tmpl.Tree.Root)
+	}
+	return fields
+}
+
+// addOptions renders the feed's DownloadPath and TransmissionLabels for an
+// item with labels. Label values are made safe to be a single path element
+// first, so a "/" or ".." in a title cannot move the download elsewhere.
+func (m *Feed) addOptions(feedName string, item *gofeed.Item, labels map[string]string) (addOptions, error) {
+	fields := map[string]string{
+		destFieldFeed:  feedName,
+		destFieldTitle: item.Title,
+	}
+	if item.PublishedParsed != nil {
+		fields[destFieldPublished] = item.PublishedParsed.Format("2006-01-02")
+	}
+	fields = MergeLabels(fields, labels)
+
+	opts := addOptions{Dir: m.DownloadPath}
+	if strings.Contains(m.DownloadPath, "{{") {
+		tmpl := m.downloadPath
+		if tmpl == nil {
+			var err error
+			if tmpl, err = parseDownloadPath(m.DownloadPath); err != nil {
+				return addOptions{}, err
+			}
+		}
+		dir, err := renderPathTemplate(tmpl, fields)
+		if err != nil {
+			return addOptions{}, err
+		}
+		opts.Dir = dir
+	}
+
+	for _, name := range m.TransmissionLabels {
+		for _, value := range labelValues(fields[name], m.multi[name]) {
+			if value != "" {
+				opts.Labels = append(opts.Labels, name+":"+value)
+			}
+		}
+	}
+	return opts, nil
+}
+
+// renderPathTemplate renders tmpl over fields, each made safe to be a single
+// path element first, and cleans the result.
+func renderPathTemplate(tmpl *template.Template, fields map[string]string) (string, error) {
+	safe := make(map[string]string, len(fields))
+	for name, value := range fields {
+		safe[name] = sanitizePathElement(value)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, safe); err != nil {
+		return "", fmt.Errorf("unable to render %s: %w", tmpl.Name(), err)
+	}
+	return path.Clean(buf.String()), nil
+}
+
+// sanitizePathElement makes a label value safe to be one element of a path:
+// no separators or control characters, and not "." or "..".
+func sanitizePathElement(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, sanitizeFilename(value))
+	value = strings.TrimSpace(value)
+	if value != "" && strings.Trim(value, ".") == "" {
+		return "_"
+	}
+	return value
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hekmon/transmissionrpc/v3"
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedAddOptions_RendersDownloadPath(t *testing.T) {
+	published := time.Date(2026, 3, 8, 14, 0, 0, 0, time.UTC)
+	item := &gofeed.Item{Title: "F1.2026.RD01.Race", PublishedParsed: &published}
+	feedCfg := Feed{DownloadPath: "/media/{{.series}}/{{.round}}/{{.Published}}"}
+
+	opts, err := feedCfg.addOptions("F1", item, map[string]string{"series": "Formula 1", "round": "RD01"})
+	require.NoError(t, err)
+	assert.Equal(t, "/media/Formula 1/RD01/2026-03-08", opts.Dir)
+	assert.Empty(t, opts.Labels)
+}
+
+// A label value is one path element, whatever it holds.
+func TestFeedAddOptions_SanitisesLabelValues(t *testing.T) {
+	item := &gofeed.Item{Title: "x"}
+	feedCfg := Feed{DownloadPath: "/media/{{.series}}/{{.round}}"}
+
+	opts, err := feedCfg.addOptions("F", item, map[string]string{"series": "../../etc", "round": ".."})
+	require.NoError(t, err)
+	assert.Equal(t, "/media/.._.._etc/_", opts.Dir)
+}
+
+func TestFeedAddOptions_MissingLabel(t *testing.T) {
+	item := &gofeed.Item{Title: "x"}
+	feedCfg := Feed{DownloadPath: "/media/{{.series}}/{{.season}}"}
+	_, err := feedCfg.addOptions("F", item, map[string]string{"series": "S"})
+	assert.ErrorContains(t, err, "season")
+
+	feedCfg.DownloadPath = `/media/{{.series}}/{{index . "season"}}`
+	opts, err := feedCfg.addOptions("F", item, map[string]string{"series": "S"})
+	require.NoError(t, err)
+	assert.Equal(t, "/media/S", opts.Dir, "an optional label that is missing drops out of the path")
+}
+
+func TestFeedAddOptions_PlainPathUnchanged(t *testing.T) {
+	feedCfg := Feed{DownloadPath: "/torrents/talkshow/"}
+	opts, err := feedCfg.addOptions("F", &gofeed.Item{Title: "x"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "/torrents/talkshow/", opts.Dir)
+}
+
+func TestFeedAddOptions_TransmissionLabels(t *testing.T) {
+	feedCfg := Feed{TransmissionLabels: []string{"series", "session", "Feed", "missing"}, multi: map[string]bool{"session": true}}
+	opts, err := feedCfg.addOptions("F1", &gofeed.Item{Title: "x"},
+		map[string]string{"series": "F1, F2", "session": "FP1,FP2"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"series:F1, F2", "session:FP1", "session:FP2", "Feed:F1"}, opts.Labels,
+		"only the Multi label is split")
+}
+
+func TestFeedValidateDestination(t *testing.T) {
+	extractor := &ExtractorSet{Labels: map[string]LabelDef{"series": {Regexp: `(.+)`}}}
+
+	f := Feed{Extractor: "demo", DownloadPath: "/media/{{.series}}/{{.Feed}}", TransmissionLabels: []string{"series"}}
+	assert.NoError(t, f.validateDestination(extractor))
+
+	f = Feed{Extractor: "demo", DownloadPath: "/media/{{if .season}}{{.season}}{{end}}"}
+	assert.ErrorContains(t, f.validateDestination(extractor), `"season" is not a label`)
+
+	f = Feed{Extractor: "demo", DownloadPath: "/media/{{.series"}
+	assert.ErrorContains(t, f.validateDestination(extractor), "unable to parse DownloadPath")
+
+	f = Feed{Extractor: "demo", TransmissionLabels: []string{"seeders"}}
+	assert.Error(t, f.validateDestination(extractor))
+	f.Type = FeedTypeTorznab
+	assert.NoError(t, f.validateDestination(extractor), "a torznab feed has the seeders attr as a label")
+}
+
+func TestDispatch_DownloadPathAndTransmissionLabels(t *testing.T) {
+	var added map[string]any
+	srv := recordingTransmissionServer(t, func(args map[string]any) { added = args })
+	defer srv.Close()
+	endpoint, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	client, err := transmissionrpc.New(endpoint, nil)
+	require.NoError(t, err)
+
+	ctx := &RunContext{Cache: emptyCache(), transmission: client}
+	feedCfg := Feed{
+		DownloadPath:       "/media/MotoGP/{{.round}}",
+		TransmissionLabels: []string{"round", "class"},
+		Identity:           []string{"round"},
+		Groups:             []Group{{Require: map[string][]string{}}},
+	}
+	c := bundleCandidate(t)
+	c.torrentBytes = buildMultiFileTorrent("RD01", [][]string{{"a"}, {"b"}, {"c"}, {"d"}})
+
+	assert.True(t, (&OnceCmd{}).dispatch(ctx, feedCfg, "F", c, []string{"round=RD01"}))
+	require.NotNil(t, added)
+	assert.Equal(t, "/media/MotoGP/RD01", added["download-dir"])
+	assert.Equal(t, []any{"round:RD01", "class:MotoGP"}, added["labels"])
+}
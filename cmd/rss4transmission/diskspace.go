@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	bytesize "github.com/inhies/go-bytesize"
+)
+
+// DiskSpaceConfig guards the download disk: a torrent is only added when
+// Transmission reports room for it in its download-dir, on top of Reserve
+// and what the torrents already there still have to download.
+type DiskSpaceConfig struct {
+	// Disabled turns the check off.
+	Disabled bool `koanf:"Disabled"`
+	// Reserve is the space to leave free, e.g. 5GB.
+	Reserve string `koanf:"Reserve"`
+}
+
+// defaultDiskReserve is the Reserve of a config that sets none.
+const defaultDiskReserve = "1GB"
+
+// holdReasonSpace starts the history reason of a winner held back for lack
+// of space.
+const holdReasonSpace = "insufficient space"
+
+// Validate parses Reserve.
+func (d *DiskSpaceConfig) Validate() error {
+	_, err := d.reserve()
+	return err
+}
+
+// reserve returns Reserve in bytes, 0 when it is empty.
+func (d *DiskSpaceConfig) reserve() (int64, error) {
+	if d.Reserve == "" {
+		return 0, nil
+	}
+	size, err := bytesize.Parse(d.Reserve)
+	if err != nil {
+		return 0, fmt.Errorf("DiskSpace: unable to parse Reserve %q: %w", d.Reserve, err)
+	}
+	return int64(size), nil
+}
+
+// spaceShortfall is a torrent there is no room for.
+type spaceShortfall struct {
+	// Dir is the download-dir the torrent was to go to.
+	Dir string
+	// Free is the space Transmission reports there, less what its torrents
+	// below the same directory still have to download.
+	Free int64
+	// Needed is the torrent's size plus the Reserve.
+	Needed int64
+}
+
+// reason is the history reason of the held winner.
+func (s *spaceShortfall) reason() string {
+	return fmt.Sprintf("%s: need %s, %s free in %s", holdReasonSpace, formatBytes(s.Needed), formatBytes(s.Free), s.Dir)
+}
+
+// formatBytes formats n as bytesize does, treating a negative n as 0.
+func formatBytes(n int64) string {
+	return bytesize.ByteSize(max(n, 0)).String()
+}
+
+// checkDiskSpace reports whether a torrent of size bytes fits in dir, or the
+// session's download-dir when dir is empty. A dir that does not exist yet,
+// as a templated DownloadPath often does not, is checked at its nearest
+// parent Transmission can measure.
+func checkDiskSpace(ctx *RunContext, dir string, size int64) (*spaceShortfall, error) {
+	if ctx.Config.DiskSpace.Disabled {
+		return nil, nil
+	}
+	reserve, err := ctx.Config.DiskSpace.reserve()
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		session, err := ctx.Tx().SessionArgumentsGet(context.TODO(), []string{"download-dir"})
+		if err != nil {
+			return nil, err
+		}
+		if session.DownloadDir == nil || *session.DownloadDir == "" {
+			return nil, fmt.Errorf("Transmission reported no download-dir")
+		}
+		dir = *session.DownloadDir
+	}
+	free, measured, err := freeSpace(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := bytesLeftBelow(ctx, measured)
+	if err != nil {
+		return nil, err
+	}
+	short := &spaceShortfall{Dir: dir, Free: free - pending, Needed: max(size, 0) + reserve}
+	if short.Free >= short.Needed {
+		return nil, nil
+	}
+	return short, nil
+}
+
+// freeSpace returns the free bytes Transmission reports for dir or, failing
+// that, for its nearest parent it can measure, and the directory measured.
+func freeSpace(ctx *RunContext, dir string) (int64, string, error) {
+	for p := path.Clean(dir); ; p = path.Dir(p) {
+		free, _, err := ctx.Tx().FreeSpace(context.TODO(), p)
+		if err == nil {
+			return int64(free.Byte()), p, nil
+		}
+		if parent := path.Dir(p); parent == p {
+			return 0, "", fmt.Errorf("unable to get the free space in %s: %w", dir, err)
+		}
+	}
+}
+
+// bytesLeftBelow is what the torrents downloading into dir or below it still
+// have to download. Transmission does not allocate a torrent's files up
+// front, so free space alone would count the same room for each of them.
+func bytesLeftBelow(ctx *RunContext, dir string) (int64, error) {
+	torrents, err := ctx.Tx().TorrentGet(context.TODO(), []string{"downloadDir", "leftUntilDone"}, nil)
+	if err != nil {
+		return 0, fmt.Errorf("unable to list Transmission's torrents: %w", err)
+	}
+	var left int64
+	for _, t := range torrents {
+		if t.DownloadDir == nil || t.LeftUntilDone == nil || !isBelow(path.Clean(*t.DownloadDir), dir) {
+			continue
+		}
+		left += *t.LeftUntilDone
+	}
+	return left, nil
+}
+
+// isBelow reports whether p is dir or a path below it.
+func isBelow(p, dir string) bool {
+	return p == dir || dir == "/" || strings.HasPrefix(p, dir+"/")
+}
+
+// wantedSize is the size of the files of w that files leaves wanted: the
+// whole torrent when nothing is unwanted or its file list is unknown.
+func wantedSize(w *candidate, files fileSelection) int64 {
+	if w.meta == nil || len(files.Unwanted) == 0 {
+		return w.item.Size()
+	}
+	var size int64
+	for _, i := range files.Wanted {
+		if i >= 0 && int(i) < len(w.meta.Files) {
+			size += w.meta.Files[i].Length
+		}
+	}
+	return size
+}
+
+// holdForSpace checks there is room for w in dir. When there is not, it
+// records w as deferred and alerts AlertTopic, once until there is room in
+// dir again, and the caller keeps w in the feed's pending set so it is
+// evaluated again at the next fetch. A failed check is logged and lets w
+// through: the guard must not stop every dispatch when Transmission cannot
+// answer it.
+func holdForSpace(ctx *RunContext, feedName string, w *candidate, dir string, files fileSelection, labels map[string]string) bool {
+	short, err := checkDiskSpace(ctx, dir, wantedSize(w, files))
+	if err != nil {
+		log.WithError(err).Warnf("%s: unable to check the free space for %s, adding it anyway", feedName, w.item.Item.Title)
+		return false
+	}
+	if short == nil {
+		delete(ctx.lowSpace, dir)
+		return false
+	}
+	w.heldForSpace = true
+	log.Warnf("%s: holding %s, %s", feedName, w.item.Item.Title, short.reason())
+	ctx.recordItemHistory(feedName, w.item, "deferred", short.reason(), labels)
+	if !ctx.lowSpace[dir] {
+		if ctx.lowSpace == nil {
+			ctx.lowSpace = map[string]bool{}
+		}
+		ctx.lowSpace[dir] = true
+		notifyLowSpace(ctx.Config.Ntfy, &NtfyDiskSpaceContext{
+			Title:    w.item.Item.Title,
+			FeedName: feedName,
+			Dir:      short.Dir,
+			Free:     formatBytes(short.Free),
+			Needed:   formatBytes(short.Needed),
+		})
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// diskSpaceSetup returns a fake Transmission with free bytes in /downloads,
+// and the bodies of the alerts sent.
+func diskSpaceSetup(t *testing.T, free int64) (*upgradeTransmission, *RunContext, *[]string) {
+	t.Helper()
+	tx := &upgradeTransmission{free: map[string]int64{"/downloads": free}}
+	ctx := tx.serve(t)
+
+	var alerts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		alerts = append(alerts, r.URL.Path+"|"+r.Header.Get("Title")+"|"+string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	ctx.Config.Ntfy = mustValidateNtfyConfig(t, NtfyConfig{BaseURL: srv.URL, AlertTopic: "alerts"})
+	ctx.Config.DiskSpace = DiskSpaceConfig{Reserve: "1GB"}
+	return tx, ctx, &alerts
+}
+
+// A winner without room is held pending and alerted on once, and added once
+// there is room.
+func TestProcessFeed_HoldsForDiskSpace(t *testing.T) {
+	tx, ctx, alerts := diskSpaceSetup(t, 512<<20)
+	cmd := &OnceCmd{}
+	feed := upgradeFeed(UpgradePolicy{})
+
+	cmd.processFeed(ctx, "F", feed, upgradeItem("720p", hash720), upgradeExtractor)
+	assert.Empty(t, tx.torrents, "no room for the reserve")
+	require.Len(t, ctx.Cache.PendingItems("F"), 1)
+	assert.Empty(t, ctx.Cache.Seen)
+	idx := ctx.History.guidIndex[historyKey("F", "guid-720p")]
+	assert.Equal(t, "deferred", ctx.History.Records[idx].Outcome)
+	assert.Equal(t, "insufficient space: need 1.00GB, 512.00MB free in /downloads", ctx.History.Records[idx].Reason)
+	assert.Equal(t, []string{"/alerts|Disk Space Low|MotoGP.RD01.Race.720p\nneeds 1.00GB, 512.00MB free in /downloads"}, *alerts)
+
+	cmd.processFeed(ctx, "F", feed, upgradeItem("720p", hash720), upgradeExtractor)
+	assert.Len(t, *alerts, 1, "one alert per shortage")
+	require.Len(t, ctx.Cache.PendingItems("F"), 1)
+
+	tx.free["/downloads"] = 2 << 30
+	cmd.processFeed(ctx, "F", feed, upgradeItem("720p", hash720), upgradeExtractor)
+	assert.Len(t, tx.torrents, 1)
+	assert.Empty(t, ctx.Cache.PendingItems("F"))
+	assert.Equal(t, "dispatched", ctx.History.Records[idx].Outcome)
+	assert.Empty(t, ctx.lowSpace, "the next shortage alerts again")
+}
+
+// A download-dir that does not exist yet is measured at its parent, less
+// what the torrents there still have to download.
+func TestCheckDiskSpace_ParentAndPendingDownloads(t *testing.T) {
+	tx, ctx, _ := diskSpaceSetup(t, 10<<30)
+	tx.torrents = []map[string]any{
+		{"id": 1, "downloadDir": "/downloads/motogp", "leftUntilDone": 6 << 30},
+		{"id": 2, "downloadDir": "/downloads-other", "leftUntilDone": 6 << 30},
+	}
+
+	short, err := checkDiskSpace(ctx, "/downloads/motogp/RD01", 2<<30)
+	require.NoError(t, err)
+	assert.Nil(t, short, "4GB free after the other download, 3GB needed")
+
+	short, err = checkDiskSpace(ctx, "/downloads/motogp/RD01", 4<<30)
+	require.NoError(t, err)
+	require.NotNil(t, short)
+	assert.Equal(t, &spaceShortfall{Dir: "/downloads/motogp/RD01", Free: 4 << 30, Needed: 5 << 30}, short)
+
+	ctx.Config.DiskSpace.Disabled = true
+	short, err = checkDiskSpace(ctx, "/downloads/motogp/RD01", 100<<30)
+	assert.NoError(t, err)
+	assert.Nil(t, short)
+}
+
+// Without an answer from Transmission the winner is added anyway.
+func TestHoldForSpace_CheckFails(t *testing.T) {
+	tx, ctx, alerts := diskSpaceSetup(t, 0)
+	delete(tx.free, "/downloads")
+	cmd := &OnceCmd{}
+
+	cmd.processFeed(ctx, "F", upgradeFeed(UpgradePolicy{}), upgradeItem("720p", hash720), upgradeExtractor)
+	assert.Len(t, tx.torrents, 1)
+	assert.Empty(t, *alerts)
+}
+
+func TestWantedSize(t *testing.T) {
+	w := &candidate{item: &FeedItem{}, meta: &MetaInfo{
+		TotalSize: 30,
+		Files:     []TorrentFile{{Path: "a", Length: 10}, {Path: "b", Length: 20}},
+	}}
+	w.item.meta = w.meta
+	assert.Equal(t, int64(30), wantedSize(w, fileSelection{}))
+	assert.Equal(t, int64(20), wantedSize(w, fileSelection{Wanted: []int64{1}, Unwanted: []int64{0}}))
+}
+
+func TestIsBelow(t *testing.T) {
+	assert.True(t, isBelow("/d", "/d"))
+	assert.True(t, isBelow("/d/x", "/d"))
+	assert.True(t, isBelow("/d", "/"))
+	assert.False(t, isBelow("/dd", "/d"))
+}
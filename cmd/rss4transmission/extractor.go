@@ -2,15 +2,49 @@ package main
 
 import (
 	"fmt"
+	"path"
 	"regexp"
 	"sort"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
 )
 
 // LabelDef is the config definition for a single label extraction rule.
+// Source is the text Regexp runs on; see the Source* constants. Without one,
+// a label is extracted from the title and from each file name. A Multi label
+// collects every match rather than the first, as a set (see labelValues).
 type LabelDef struct {
 	Regexp    string            `koanf:"Regexp"`
 	Default   string            `koanf:"Default"`
 	Normalize map[string]string `koanf:"Normalize"`
+	Source    string            `koanf:"Source"`
+	Multi     bool              `koanf:"Multi"`
+}
+
+// Label sources. A torznab attr is named as SourceTorznabPrefix plus the
+// attr's name, e.g. "torznab:resolution".
+const (
+	SourceTitle         = "title"       // the item's title only, not file names
+	SourceDescription   = "description" // the item's description
+	SourceCategories    = "categories"  // each of the item's categories, first match wins
+	SourceLink          = "link"        // the item's link
+	SourceAuthor        = "author"      // the item's author names
+	SourcePath          = "path"        // each file's full path inside the torrent
+	SourceComment       = "comment"     // the torrent's comment
+	SourceTorznabPrefix = "torznab:"
+)
+
+// validLabelSource checks source is one of the Source* values.
+func validLabelSource(name, source string) error {
+	switch source {
+	case "", SourceTitle, SourceDescription, SourceCategories, SourceLink, SourceAuthor, SourcePath, SourceComment:
+		return nil
+	}
+	if attr, ok := strings.CutPrefix(source, SourceTorznabPrefix); ok && attr != "" {
+		return nil
+	}
+	return fmt.Errorf("label %q: unknown Source %q", name, source)
 }
 
 // ExtractorSet is a named collection of label definitions.
@@ -24,6 +58,8 @@ type ExtractorSet struct {
 type compiledLabel struct {
 	re        *regexp.Regexp
 	normalize []normalizeRule
+	source    string
+	multi     bool
 }
 
 type normalizeRule struct {
@@ -51,7 +87,14 @@ func (es *ExtractorSet) Compile() error {
 	}
 	compiled := make(map[string]*compiledLabel, len(es.Labels))
 	for name, def := range es.Labels {
-		cl := &compiledLabel{}
+		if err := validLabelSource(name, def.Source); err != nil {
+			return err
+		}
+		cl := &compiledLabel{source: def.Source, multi: def.Multi}
+		if strings.HasPrefix(def.Source, SourceTorznabPrefix) {
+			// torznabAttrs lowercases attr names.
+			cl.source = strings.ToLower(def.Source)
+		}
 		var err error
 		if cl.re, err = regexp.Compile(def.Regexp); err != nil {
 			return fmt.Errorf("label %q: invalid Regexp %q: %w", name, def.Regexp, err)
@@ -91,27 +134,134 @@ func (es *ExtractorSet) compile() {
 	}
 }
 
-// ExtractLabels extracts labels from s. Labels whose regex does not match are
-// omitted from the result. After extraction, the first matching Normalize rule
-// (sorted by pattern string) maps the raw match to a canonical value.
-// Defaults are NOT applied here; use Defaults() and apply them at coverage time
-// so that a file's absent label never overrides a title's explicit value.
+// multiLabels returns the names of the Multi labels, or nil when there are
+// none.
+func (es *ExtractorSet) multiLabels() map[string]bool {
+	var multi map[string]bool
+	for name, def := range es.Labels {
+		if def.Multi {
+			if multi == nil {
+				multi = map[string]bool{}
+			}
+			multi[name] = true
+		}
+	}
+	return multi
+}
+
+// extract runs the label's Regexp on s. After extraction, the first matching
+// Normalize rule (sorted by pattern string) maps the raw match to a canonical
+// value. A Multi label normalizes every match and returns the distinct values
+// joined by joinLabelValues.
+func (cl *compiledLabel) extract(s string) (string, bool) {
+	if !cl.multi {
+		match := cl.re.FindStringSubmatch(s)
+		if len(match) < 2 {
+			return "", false
+		}
+		return cl.normalized(match[1]), true
+	}
+	var values []string
+	for _, match := range cl.re.FindAllStringSubmatch(s, -1) {
+		if len(match) >= 2 && match[1] != "" {
+			values = append(values, cl.normalized(match[1]))
+		}
+	}
+	if len(values) == 0 {
+		return "", false
+	}
+	return joinLabelValues(values), true
+}
+
+func (cl *compiledLabel) normalized(raw string) string {
+	for _, rule := range cl.normalize {
+		if rule.re.MatchString(raw) {
+			return rule.value
+		}
+	}
+	return raw
+}
+
+// ExtractLabels extracts the labels without a Source from s. Labels whose
+// regex does not match are omitted from the result. Defaults are NOT applied
+// here; use Defaults() and apply them at coverage time so that a file's absent
+// label never overrides a title's explicit value.
 func (es *ExtractorSet) ExtractLabels(s string) map[string]string {
 	es.compile()
 	result := make(map[string]string)
 	for name, cl := range es.compiledLabels {
-		match := cl.re.FindStringSubmatch(s)
-		if len(match) < 2 {
+		if cl.source != "" {
 			continue
 		}
-		raw := match[1]
-		for _, rule := range cl.normalize {
-			if rule.re.MatchString(raw) {
-				raw = rule.value
+		if v, ok := cl.extract(s); ok {
+			result[name] = v
+		}
+	}
+	return result
+}
+
+// ExtractItemLabels extracts the labels read from the feed item itself: those
+// without a Source, or with SourceTitle, from the title, and the rest from
+// their Source. Labels sourced from the .torrent are left to ExtractPerFile
+// and ExtractMetaLabels.
+func (es *ExtractorSet) ExtractItemLabels(item *gofeed.Item) map[string]string {
+	es.compile()
+	result := make(map[string]string)
+	var attrs map[string]string
+	for name, cl := range es.compiledLabels {
+		var texts []string
+		switch cl.source {
+		case "", SourceTitle:
+			texts = []string{item.Title}
+		case SourceDescription:
+			texts = []string{item.Description}
+		case SourceCategories:
+			texts = item.Categories
+		case SourceLink:
+			texts = []string{item.Link}
+		case SourceAuthor:
+			if item.Author != nil {
+				texts = append(texts, item.Author.Name)
+			}
+			for _, a := range item.Authors {
+				if a != nil {
+					texts = append(texts, a.Name)
+				}
+			}
+		default:
+			attr, ok := strings.CutPrefix(cl.source, SourceTorznabPrefix)
+			if !ok {
+				continue
+			}
+			if attrs == nil {
+				attrs = torznabAttrs(item)
+			}
+			if v, ok := attrs[attr]; ok {
+				texts = []string{v}
+			}
+		}
+		for _, text := range texts {
+			if v, ok := cl.extract(text); ok {
+				result[name] = v
 				break
 			}
 		}
-		result[name] = raw
+	}
+	return result
+}
+
+// ExtractMetaLabels extracts the labels with SourceComment from the
+// torrent's comment.
+func (es *ExtractorSet) ExtractMetaLabels(meta *MetaInfo) map[string]string {
+	es.compile()
+	result := make(map[string]string)
+	for name, cl := range es.compiledLabels {
+		if cl.source != SourceComment {
+			continue
+		}
+		if v, ok := cl.extract(meta.Comment); ok {
+			result[name] = v
+		}
 	}
 	return result
 }
@@ -127,15 +277,16 @@ func (es *ExtractorSet) Defaults() map[string]string {
 	return result
 }
 
-// hasAnyRegexMatch reports whether any label's Regexp matches s.
-func (es *ExtractorSet) hasAnyRegexMatch(s string) bool {
-	es.compile()
-	for _, cl := range es.compiledLabels {
-		if len(cl.re.FindStringSubmatch(s)) >= 2 {
-			return true
-		}
+// fileText returns what cl runs on for the file at filePath, or false when
+// cl is not extracted from files at all.
+func (cl *compiledLabel) fileText(filePath string) (string, bool) {
+	switch cl.source {
+	case "":
+		return path.Base(filePath), true
+	case SourcePath:
+		return filePath, true
 	}
-	return false
+	return "", false
 }
 
 // ExtractFromFiles extracts labels from each file name. Files where no label
@@ -143,12 +294,43 @@ func (es *ExtractorSet) hasAnyRegexMatch(s string) bool {
 // at coverage time via Defaults() so a file's absent label never silently
 // overrides an explicit value from the torrent title.
 func (es *ExtractorSet) ExtractFromFiles(fileNames []string) []map[string]string {
-	result := make([]map[string]string, 0, len(fileNames))
-	for _, fn := range fileNames {
-		if !es.hasAnyRegexMatch(fn) {
-			continue
+	return matchedFileLabels(es.ExtractPerFile(fileNames))
+}
+
+// ExtractPerFile is ExtractFromFiles keeping the files' positions: entry i
+// holds file i's labels, or nil when no label Regexp matches it. File rules
+// need the position, which is the file's index in Transmission.
+//
+// Entries may be full paths inside the torrent: labels without a Source run
+// on the file name, and SourcePath labels on the whole path.
+func (es *ExtractorSet) ExtractPerFile(fileNames []string) []map[string]string {
+	es.compile()
+	result := make([]map[string]string, len(fileNames))
+	for i, fn := range fileNames {
+		labels := map[string]string{}
+		for name, cl := range es.compiledLabels {
+			text, ok := cl.fileText(fn)
+			if !ok {
+				continue
+			}
+			if v, ok := cl.extract(text); ok {
+				labels[name] = v
+			}
+		}
+		if len(labels) > 0 {
+			result[i] = labels
+		}
+	}
+	return result
+}
+
+// matchedFileLabels drops the nil entries of an ExtractPerFile result.
+func matchedFileLabels(perFile []map[string]string) []map[string]string {
+	result := make([]map[string]string, 0, len(perFile))
+	for _, labels := range perFile {
+		if labels != nil {
+			result = append(result, labels)
 		}
-		result = append(result, es.ExtractLabels(fn))
 	}
 	return result
 }
@@ -3,6 +3,9 @@ package main
 import (
 	"regexp"
 	"testing"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
 )
 
 func TestExtractLabels_SingleLabel(t *testing.T) {
@@ -274,3 +277,121 @@ func TestExtractFromFiles_DefaultDoesNotAffectFileSkip(t *testing.T) {
 		t.Errorf("expected 1 label set (subtitle skipped), got %d", len(got))
 	}
 }
+
+func TestExtractItemLabels_Sources(t *testing.T) {
+	es := &ExtractorSet{
+		Labels: map[string]LabelDef{
+			"series":     {Regexp: `(MotoGP|Moto2|Moto3)`},
+			"resolution": {Regexp: `(1080p|720p)`, Source: SourceDescription},
+			"format":     {Regexp: `^TV/(HD|UHD)$`, Source: SourceCategories},
+			"site":       {Regexp: `https://([^/]+)/`, Source: SourceLink},
+			"uploader":   {Regexp: `(\w+)`, Source: SourceAuthor},
+			"lang":       {Regexp: `(\w+)`, Source: "torznab:Language"},
+			"year":       {Regexp: `(20\d\d)`, Source: SourceTitle},
+			"dir":        {Regexp: `^([^/]+)/`, Source: SourcePath},
+		},
+	}
+	item := &gofeed.Item{
+		Title:       "MotoGP.2024.RD01.Race",
+		Description: "Full race, 1080p, English commentary",
+		Categories:  []string{"TV", "TV/HD"},
+		Link:        "https://tracker.example/details/1",
+		Author:      &gofeed.Person{Name: "racer"},
+		Extensions: map[string]map[string][]ext.Extension{
+			"torznab": {"attr": {{Attrs: map[string]string{"name": "language", "value": "English"}}}},
+		},
+	}
+	got := es.ExtractItemLabels(item)
+	want := map[string]string{
+		"series": "MotoGP", "resolution": "1080p", "format": "HD", "site": "tracker.example",
+		"uploader": "racer", "lang": "English", "year": "2024",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+	if _, ok := got["dir"]; ok {
+		t.Error("a path label is not extracted from the item")
+	}
+}
+
+// A label with a Source other than the default is not read from the text
+// ExtractLabels is handed, so a title-only label never comes from a file
+// name.
+func TestExtractLabels_SkipsSourcedLabels(t *testing.T) {
+	es := &ExtractorSet{
+		Labels: map[string]LabelDef{
+			"series":     {Regexp: `(MotoGP|Moto2|Moto3)`},
+			"resolution": {Regexp: `(1080p|720p)`, Source: SourceTitle},
+		},
+	}
+	got := es.ExtractLabels("MotoGP.RD01.1080p.mkv")
+	if _, ok := got["resolution"]; ok || got["series"] != "MotoGP" {
+		t.Errorf("got %v, want only series", got)
+	}
+}
+
+func TestExtractPerFile_PathSource(t *testing.T) {
+	es := &ExtractorSet{
+		Labels: map[string]LabelDef{
+			"series": {Regexp: `(MotoGP|Moto2|Moto3)`},
+			"round":  {Regexp: `^(RD\d+)/`, Source: SourcePath},
+		},
+	}
+	got := es.ExtractPerFile([]string{"RD03/MotoGP.Race.mkv", "RD03/info.nfo", "readme.txt"})
+	if got[0]["series"] != "MotoGP" || got[0]["round"] != "RD03" {
+		t.Errorf("file 0 = %v", got[0])
+	}
+	if got[1]["round"] != "RD03" || got[1]["series"] != "" {
+		t.Errorf("file 1 = %v, want the round from its directory", got[1])
+	}
+	if got[2] != nil {
+		t.Errorf("file 2 = %v, want nil", got[2])
+	}
+}
+
+func TestExtractMetaLabels_Comment(t *testing.T) {
+	es := &ExtractorSet{
+		Labels: map[string]LabelDef{
+			"series": {Regexp: `(MotoGP|Moto2|Moto3)`},
+			"source": {Regexp: `Source: (\w+)`, Source: SourceComment},
+		},
+	}
+	got := es.ExtractMetaLabels(&MetaInfo{Comment: "MotoGP RD01. Source: WEB"})
+	if len(got) != 1 || got["source"] != "WEB" {
+		t.Errorf("got %v, want source=WEB only", got)
+	}
+}
+
+func TestCompile_RejectsUnknownSource(t *testing.T) {
+	for _, source := range []string{"titel", "torznab:"} {
+		es := &ExtractorSet{Labels: map[string]LabelDef{"x": {Regexp: `(x)`, Source: source}}}
+		if err := es.Compile(); err == nil {
+			t.Errorf("Source %q: expected an error", source)
+		}
+	}
+}
+
+func TestExtractLabels_Multi(t *testing.T) {
+	es := &ExtractorSet{
+		Labels: map[string]LabelDef{
+			"audio": {
+				Regexp:    `(?i)\b(ENG|GER|FRE)\b`,
+				Multi:     true,
+				Normalize: map[string]string{"(?i)eng": "en", "(?i)ger": "de", "(?i)fre": "fr"},
+			},
+			"series": {Regexp: `(MotoGP|Moto2)`},
+		},
+	}
+	got := es.ExtractLabels("MotoGP.RD01.Race.GER.ENG.FRE.ENG.1080p")
+	if got["audio"] != "de,en,fr" {
+		t.Errorf("audio = %q, want de,en,fr", got["audio"])
+	}
+	if got["series"] != "MotoGP" {
+		t.Errorf("series = %q, want MotoGP", got["series"])
+	}
+	if _, ok := es.ExtractLabels("MotoGP.RD01.Race")["audio"]; ok {
+		t.Error("a Multi label with no match is omitted")
+	}
+}
@@ -22,16 +22,18 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/hekmon/transmissionrpc/v3"
 	bytesize "github.com/inhies/go-bytesize"
 	"github.com/mmcdole/gofeed"
+	str2duration "github.com/xhit/go-str2duration/v2"
 )
 
 const (
@@ -43,17 +45,77 @@ type FeedItem struct {
 	Complete bool
 	Location string
 	Item     *gofeed.Item
+
+	// client fetches the .torrent with the owning feed's HTTP profile. Nil
+	// uses the default client.
+	client *FeedClient
+	// meta is the parsed .torrent, when it has been fetched. Its infohash and
+	// size win over whatever the feed claims.
+	meta *MetaInfo
+	// TorrentID is Transmission's ID for the item once addTorrent has added
+	// it, and 0 before.
+	TorrentID int64
 }
 
+// TorrentURL returns the URL of the item's .torrent file. Indexers often type a
+// magnet enclosure as application/x-bittorrent too, so magnet URIs are skipped
+// here; MagnetURI finds those.
 func (fi *FeedItem) TorrentURL() (string, error) {
 	for _, enclosure := range fi.Item.Enclosures {
-		if enclosure.Type == "application/x-bittorrent" {
+		if enclosure.Type == "application/x-bittorrent" && !isMagnet(enclosure.URL) {
 			return enclosure.URL, nil
 		}
 	}
 	return "", fmt.Errorf("unable to find Type = application/x-bittorrent for %s", fi.Item.Title)
 }
 
+// MagnetURI returns the item's magnet link. Indexers publish it in an
+// enclosure, in the item link, or in a torznab magneturl attr, and all three
+// are checked in that order.
+func (fi *FeedItem) MagnetURI() (string, bool) {
+	for _, enclosure := range fi.Item.Enclosures {
+		if isMagnet(enclosure.URL) {
+			return enclosure.URL, true
+		}
+	}
+	if isMagnet(fi.Item.Link) {
+		return fi.Item.Link, true
+	}
+	if uri, ok := torznabAttrs(fi.Item)["magneturl"]; ok && isMagnet(uri) {
+		return uri, true
+	}
+	return "", false
+}
+
+// InfoHash returns the item's v1 infohash as lowercase hex, or "" when nothing
+// names one. A hash computed from the .torrent itself wins, then the magnet
+// link's, then a torznab infohash attr.
+func (fi *FeedItem) InfoHash() string {
+	if fi.meta != nil {
+		return fi.meta.InfoHash
+	}
+	if uri, ok := fi.MagnetURI(); ok {
+		if hash, ok := magnetInfoHash(uri); ok {
+			return hash
+		}
+	}
+	if attr, ok := torznabAttrs(fi.Item)["infohash"]; ok {
+		if hash, ok := normalizeInfoHash(attr); ok {
+			return hash
+		}
+	}
+	return ""
+}
+
+// Size returns the content size in bytes: the .torrent's total when it has
+// been fetched, else what the feed claims (see extractSize).
+func (fi *FeedItem) Size() int64 {
+	if fi.meta != nil && fi.meta.TotalSize > 0 {
+		return fi.meta.TotalSize
+	}
+	return extractSize(fi.Item)
+}
+
 func (fi *FeedItem) getTorrentContents(cacheDir string) ([]byte, error) {
 	if cacheDir != "" {
 		if err := os.MkdirAll(cacheDir, 0755); err != nil { //nolint:gosec
@@ -84,15 +146,18 @@ func (fi *FeedItem) fetchTorrent() ([]byte, error) {
 	if err != nil {
 		return []byte{}, err
 	}
-	return fetchTorrentBytes(torrentUrl)
+	return fetchTorrentBytes(fi.client, torrentUrl)
 }
 
-// fetchTorrentBytes downloads the .torrent file at url. It is a standalone
-// function (rather than a FeedItem method) so callers with only a URL — such
-// as a history-page retry that has no live RSS entry to fetch through — can
-// use it directly.
-func fetchTorrentBytes(torrentUrl string) ([]byte, error) {
-	resp, err := http.Get(torrentUrl) //nolint:gosec
+// fetchTorrentBytes downloads the .torrent file at url through client, or the
+// default client when client is nil. It is a standalone function (rather than
+// a FeedItem method) so callers with only a URL — such as a history-page retry
+// that has no live RSS entry to fetch through — can use it directly.
+func fetchTorrentBytes(client *FeedClient, torrentUrl string) ([]byte, error) {
+	if client == nil {
+		client = defaultFeedClient
+	}
+	resp, err := client.Get(torrentUrl)
 	if err != nil {
 		return []byte{}, fmt.Errorf("unable to download %s: %s", torrentUrl, err)
 	}
@@ -103,6 +168,17 @@ func fetchTorrentBytes(torrentUrl string) ([]byte, error) {
 	return io.ReadAll(resp.Body)
 }
 
+// fetchFeed downloads and parses the RSS feed at feedURL through client. It
+// replaces gofeed's own ParseURL, which cannot carry a feed's headers, cookies
+// or timeout.
+func fetchFeed(client *FeedClient, feedURL string) (*gofeed.Feed, error) {
+	resp, err := fetchFeedConditional(client, feedURL, FeedValidators{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Feed, nil
+}
+
 // Download saves the .torrent file to dir and returns its path. The caller is
 // responsible for recording the item in the cache.
 func (fi *FeedItem) Download(ctx *RunContext, dir string, cacheDir string) (string, error) {
@@ -123,9 +199,10 @@ func (fi *FeedItem) Download(ctx *RunContext, dir string, cacheDir string) (stri
 }
 
 // TorrentWithBytes submits a torrent to Transmission using pre-fetched bytes
-// (MetaInfo upload). Returns the Transmission torrent ID (0 for duplicates).
-// The caller is responsible for recording the item in the cache.
-func (fi *FeedItem) TorrentWithBytes(ctx *RunContext, dir string, data []byte) (int64, error) {
+// (MetaInfo upload) with opts, downloading only the files in files when it
+// selects any. Returns the Transmission torrent ID (0 for duplicates). The
+// caller is responsible for recording the item in the cache.
+func (fi *FeedItem) TorrentWithBytes(ctx *RunContext, opts addOptions, data []byte, files fileSelection) (int64, error) {
 	log.Debugf("Attempting to torrent: %s", fi.Item.Title)
 
 	if len(data) == 0 {
@@ -133,10 +210,38 @@ func (fi *FeedItem) TorrentWithBytes(ctx *RunContext, dir string, data []byte) (
 	}
 
 	encoded := base64.StdEncoding.EncodeToString(data)
-	addPayload := transmissionrpc.TorrentAddPayload{
-		DownloadDir: &dir,
-		MetaInfo:    &encoded,
+	payload, err := opts.payload()
+	if err != nil {
+		return 0, err
 	}
+	payload.MetaInfo = &encoded
+	if len(files.Unwanted) > 0 {
+		payload.FilesWanted = files.Wanted
+		payload.FilesUnwanted = files.Unwanted
+		log.Infof("Not downloading %d file(s) of %s: %s", len(files.Unwanted), fi.Item.Title,
+			strings.Join(files.UnwantedPath, ", "))
+	}
+	return fi.addTorrent(ctx, opts, payload)
+}
+
+// TorrentWithMagnet submits a magnet link to Transmission with opts, and
+// Transmission fetches the metadata from peers itself. Returns the
+// Transmission torrent ID (0 for duplicates). The caller is responsible for
+// recording the item in the cache.
+func (fi *FeedItem) TorrentWithMagnet(ctx *RunContext, opts addOptions, magnet string) (int64, error) {
+	log.Debugf("Attempting to torrent magnet: %s", fi.Item.Title)
+	payload, err := opts.payload()
+	if err != nil {
+		return 0, err
+	}
+	payload.Filename = &magnet
+	return fi.addTorrent(ctx, opts, payload)
+}
+
+// addTorrent sends a torrent-add for fi and treats Transmission's duplicate
+// rejection as success with no ID. The settings torrent-add cannot make are
+// applied to the new torrent after it.
+func (fi *FeedItem) addTorrent(ctx *RunContext, opts addOptions, addPayload transmissionrpc.TorrentAddPayload) (int64, error) {
 	torrent, err := ctx.Tx().TorrentAdd(context.TODO(), addPayload)
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate torrent") {
@@ -148,6 +253,8 @@ func (fi *FeedItem) TorrentWithBytes(ctx *RunContext, dir string, data []byte) (
 
 	log.Infof("Torrenting: %s", fi.Item.Title)
 	if torrent.ID != nil {
+		fi.TorrentID = *torrent.ID
+		opts.Settings.apply(ctx, *torrent.ID, fi.Item.Title)
 		return *torrent.ID, nil
 	}
 	return 0, nil
@@ -195,8 +302,59 @@ func (m *Feed) Compile() error {
 		minSize = uint64(size)
 	}
 
+	var interval, jitter time.Duration
+	if m.Interval != "" {
+		d, err := str2duration.ParseDuration(m.Interval)
+		if err != nil {
+			return fmt.Errorf("unable to parse Interval %q: %w", m.Interval, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("Interval %q must be positive", m.Interval)
+		}
+		interval = d
+	}
+	if m.Jitter != "" {
+		d, err := str2duration.ParseDuration(m.Jitter)
+		if err != nil {
+			return fmt.Errorf("unable to parse Jitter %q: %w", m.Jitter, err)
+		}
+		if d < 0 {
+			return fmt.Errorf("Jitter %q must not be negative", m.Jitter)
+		}
+		jitter = d
+	}
+
+	client, err := NewFeedClient(m.HTTP, m.NoValidateCert)
+	if err != nil {
+		return err
+	}
+
+	downloadPath, err := parseDownloadPath(m.DownloadPath)
+	if err != nil {
+		return err
+	}
+
+	var backfillQuery *template.Template
+	var backfillClient *FeedClient
+	if m.Backfill.Enabled() {
+		if backfillQuery, err = m.Backfill.parseQuery(); err != nil {
+			return err
+		}
+		if m.Backfill.URL != "" {
+			if backfillClient, err = NewFeedClient(m.Backfill.HTTP, m.NoValidateCert); err != nil {
+				return fmt.Errorf("Backfill: %w", err)
+			}
+		}
+	}
+
 	// Assigned only once everything parsed, so a failed Compile leaves the
 	// feed exactly as it was rather than half-built.
+	m.client = client
+	m.interval = interval
+	m.jitter = jitter
+	m.downloadPath = downloadPath
+	m.backfillQuery = backfillQuery
+	m.backfillClient = backfillClient
 	m.exclude = exclude
 	m.maxSize = maxSize
 	m.minSize = minSize
@@ -204,6 +362,29 @@ func (m *Feed) Compile() error {
 	return nil
 }
 
+// Client is the HTTP client for this feed's RSS and .torrent requests. A feed
+// whose profile failed to compile falls back to the default client, which
+// still has a timeout.
+func (m *Feed) Client() *FeedClient {
+	m.compile()
+	if m.client == nil {
+		return defaultFeedClient
+	}
+	return m.client
+}
+
+// PollInterval is the parsed Interval, or 0 when the feed follows --sleep.
+func (m *Feed) PollInterval() time.Duration {
+	m.compile()
+	return m.interval
+}
+
+// PollJitter is the parsed Jitter.
+func (m *Feed) PollJitter() time.Duration {
+	m.compile()
+	return m.jitter
+}
+
 // compile is the lazy path used by Check. Compile has normally already run at
 // config load; a feed built directly (in tests, or by a caller that skipped
 // loadConfig) compiles here instead. A bad value filters nothing rather than
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
 )
 
 func TestTorrentURL_Found(t *testing.T) {
@@ -72,6 +73,80 @@ func TestTorrentURL_NoEnclosures(t *testing.T) {
 	}
 }
 
+func TestTorrentURL_SkipsMagnetEnclosure(t *testing.T) {
+	fi := &FeedItem{
+		Item: &gofeed.Item{
+			Title: "Test",
+			Enclosures: []*gofeed.Enclosure{
+				{URL: "magnet:?xt=urn:btih:" + testInfoHash, Type: "application/x-bittorrent"},
+			},
+		},
+	}
+	if _, err := fi.TorrentURL(); err == nil {
+		t.Error("a magnet enclosure is not a .torrent URL")
+	}
+}
+
+// --- MagnetURI / InfoHash ---
+
+func TestMagnetURI_Sources(t *testing.T) {
+	magnet := "magnet:?xt=urn:btih:" + testInfoHash
+	tests := []struct {
+		name string
+		item *gofeed.Item
+	}{
+		{"enclosure", &gofeed.Item{Enclosures: []*gofeed.Enclosure{
+			{URL: magnet, Type: "application/x-bittorrent;x-scheme-handler/magnet"},
+		}}},
+		{"link", &gofeed.Item{Link: magnet}},
+		{"torznab attr", &gofeed.Item{Extensions: torznabExtensions(map[string]string{"magneturl": magnet})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fi := &FeedItem{Item: tt.item}
+			got, ok := fi.MagnetURI()
+			if !ok || got != magnet {
+				t.Errorf("MagnetURI() = %q, %v; want %q", got, ok, magnet)
+			}
+			if hash := fi.InfoHash(); hash != testInfoHash {
+				t.Errorf("InfoHash() = %q, want %q", hash, testInfoHash)
+			}
+		})
+	}
+}
+
+func TestMagnetURI_None(t *testing.T) {
+	fi := makeFeedItemWithURL("Test", "https://example.com/a.torrent")
+	if _, ok := fi.MagnetURI(); ok {
+		t.Error("an item with only a .torrent enclosure has no magnet")
+	}
+	if hash := fi.InfoHash(); hash != "" {
+		t.Errorf("InfoHash() = %q, want empty", hash)
+	}
+}
+
+func TestInfoHash_TorznabAttr(t *testing.T) {
+	fi := &FeedItem{Item: &gofeed.Item{
+		Extensions: torznabExtensions(map[string]string{"infohash": "0123456789ABCDEF0123456789ABCDEF01234567"}),
+	}}
+	if hash := fi.InfoHash(); hash != testInfoHash {
+		t.Errorf("InfoHash() = %q, want %q", hash, testInfoHash)
+	}
+}
+
+// torznabExtensions builds the gofeed extension tree a torznab:attr element
+// parses into.
+func torznabExtensions(attrs map[string]string) ext.Extensions {
+	var list []ext.Extension
+	for name, value := range attrs {
+		list = append(list, ext.Extension{
+			Name:  "attr",
+			Attrs: map[string]string{"name": name, "value": value},
+		})
+	}
+	return ext.Extensions{"torznab": {"attr": list}}
+}
+
 // --- getTorrentContents ---
 
 var sentinelTorrent = []byte("d8:announce27:http://example.com/announcee")
@@ -189,7 +264,7 @@ func TestFetchTorrentBytes_Success(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	got, err := fetchTorrentBytes(srv.URL + "/my.torrent")
+	got, err := fetchTorrentBytes(nil, srv.URL+"/my.torrent")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -204,13 +279,13 @@ func TestFetchTorrentBytes_HTTPError(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	if _, err := fetchTorrentBytes(srv.URL + "/missing.torrent"); err == nil {
+	if _, err := fetchTorrentBytes(nil, srv.URL+"/missing.torrent"); err == nil {
 		t.Error("expected error for non-2xx HTTP response, got nil")
 	}
 }
 
 func TestFetchTorrentBytes_ConnectionError(t *testing.T) {
-	if _, err := fetchTorrentBytes("http://127.0.0.1:1/unreachable"); err == nil {
+	if _, err := fetchTorrentBytes(nil, "http://127.0.0.1:1/unreachable"); err == nil {
 		t.Error("expected error for connection failure, got nil")
 	}
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+//go:embed web/feeds.html
+var feedsTmpl string
+
+// feedsPageData is what web/feeds.html renders.
+type feedsPageData struct {
+	Feeds []FeedSchedule
+}
+
+// registerFeedsRoutes adds GET /feeds, the scheduler's view of every feed:
+// its interval, when it was last fetched and when it is next due. Like GET /,
+// it is for the private mux only.
+//
+// schedule is read per request, so a reload that adds, removes or retimes a
+// feed shows up on the next render.
+func registerFeedsRoutes(mux *http.ServeMux, schedule func() []FeedSchedule, nav navConfig) {
+	nav.Feeds = alwaysNav
+	funcs := template.FuncMap{
+		"fmtTime": func(t time.Time) string { return t.Local().Format("2006-01-02 15:04:05") },
+	}
+	for name, fn := range nav.navFuncs() {
+		funcs[name] = fn
+	}
+	tmpl := template.Must(template.Must(
+		template.New("feeds").Funcs(funcs).Parse(navTmpl)).Parse(feedsTmpl))
+
+	mux.HandleFunc("GET /feeds", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := tmpl.Execute(w, feedsPageData{Feeds: schedule()}); err != nil {
+			log.WithError(err).Error("Failed to render feeds template")
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/url"
+	"sync"
+)
+
+const (
+	defaultFetchConcurrency = 8
+	defaultFetchPerHost     = 2
+)
+
+// fetchPool bounds concurrent HTTP fetches: at most global in flight overall
+// and perHost against any one host, so a run over many feeds on one tracker
+// does not look like a flood to it.
+type fetchPool struct {
+	global  chan struct{}
+	perHost int
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+// newFetchPool builds a pool from the Fetch config block. Zero values, as in a
+// Config built without the defaults, fall back to the default caps.
+func newFetchPool(cfg FetchConfig) *fetchPool {
+	global := cfg.Concurrency
+	if global <= 0 {
+		global = defaultFetchConcurrency
+	}
+	perHost := cfg.PerHost
+	if perHost <= 0 {
+		perHost = defaultFetchPerHost
+	}
+	return &fetchPool{
+		global:  make(chan struct{}, global),
+		perHost: perHost,
+		hosts:   map[string]chan struct{}{},
+	}
+}
+
+func (p *fetchPool) hostSlots(rawURL string) chan struct{} {
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	slots, ok := p.hosts[host]
+	if !ok {
+		slots = make(chan struct{}, p.perHost)
+		p.hosts[host] = slots
+	}
+	return slots
+}
+
+// Run calls fn(i) for i in [0, n), each holding a slot for hostOf(i), and
+// returns once all have finished. fn must write its result to its own index
+// so the caller sees results in input order however the fetches interleave.
+func (p *fetchPool) Run(n int, hostOf func(i int) string, fn func(i int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		host := p.hostSlots(hostOf(i))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// The host slot is taken first so that jobs queued behind a
+			// busy host do not sit on global slots other hosts could use.
+			host <- struct{}{}
+			defer func() { <-host }()
+			p.global <- struct{}{}
+			defer func() { <-p.global }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchPool_Caps(t *testing.T) {
+	pool := newFetchPool(FetchConfig{Concurrency: 3, PerHost: 2})
+	urls := []string{
+		"http://a/1", "http://a/2", "http://a/3", "http://a/4",
+		"http://b/1", "http://b/2", "http://c/1", "http://c/2",
+	}
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	perHost, maxPerHost := map[string]int{}, 0
+	results := make([]string, len(urls))
+
+	pool.Run(len(urls), func(i int) string { return urls[i] }, func(i int) {
+		host := urls[i][len("http://") : len("http://")+1]
+		mu.Lock()
+		inFlight++
+		perHost[host]++
+		maxInFlight = max(maxInFlight, inFlight)
+		maxPerHost = max(maxPerHost, perHost[host])
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+		results[i] = urls[i]
+
+		mu.Lock()
+		inFlight--
+		perHost[host]--
+		mu.Unlock()
+	})
+
+	assert.Equal(t, urls, results, "each job writes its own slot")
+	assert.LessOrEqual(t, maxInFlight, 3)
+	assert.LessOrEqual(t, maxPerHost, 2)
+	assert.Greater(t, maxInFlight, 1, "jobs do run concurrently")
+}
+
+// Feeds are fetched concurrently but processed in config order, whichever
+// response arrives first.
+func TestOnceRun_ConcurrentFetchKeepsConfigOrder(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		// Every response takes a moment, and the first feed's answers last.
+		time.Sleep(20 * time.Millisecond)
+		if r.URL.Path == "/f0" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		_, _ = fmt.Fprintf(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>t</title>
+<item><title>Show.RD01.%s</title><guid>%s</guid></item></channel></rss>`, r.URL.Path[1:], r.URL.Path[1:])
+	}))
+	defer srv.Close()
+
+	cache, err := OpenCache(filepath.Join(t.TempDir(), "seen.json"))
+	require.NoError(t, err)
+	var feeds []Feed
+	for i := 0; i < 4; i++ {
+		feeds = append(feeds, Feed{
+			Name: fmt.Sprintf("F%d", i), URL: fmt.Sprintf("%s/f%d", srv.URL, i),
+			Extractor: "e", Identity: []string{"round"},
+			Groups: []Group{{Require: map[string][]string{"round": {"never"}}}},
+		})
+	}
+	ctx := &RunContext{
+		Config: Config{
+			Feeds: feeds,
+			Extractors: map[string]*ExtractorSet{"e": {Labels: map[string]LabelDef{
+				"round": {Regexp: `(RD\d+)`},
+			}}},
+			SeenCacheDays: 1,
+			Fetch:         FetchConfig{Concurrency: 4, PerHost: 4},
+		},
+		Cache:   cache,
+		History: &HistoryFile{guidIndex: map[string]int{}},
+	}
+
+	require.NoError(t, (&OnceCmd{NoAction: true}).Run(ctx))
+
+	var feedOrder []string
+	for _, r := range ctx.History.GetRecords() {
+		feedOrder = append(feedOrder, r.Feed)
+	}
+	assert.Equal(t, []string{"F0", "F1", "F2", "F3"}, feedOrder)
+	assert.Greater(t, maxInFlight.Load(), int32(1), "feeds are fetched concurrently")
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// FileRules choose which files of a torrent Transmission downloads, so a
+// bundle's samples, NFOs or classes nobody follows are left out. A file is
+// wanted when its path within the torrent matches an Include pattern (any
+// file, if there are none), matches no Exclude pattern, and its labels satisfy
+// Require.
+type FileRules struct {
+	Include []string            `koanf:"Include"`
+	Exclude []string            `koanf:"Exclude"`
+	Require map[string][]string `koanf:"Require"`
+}
+
+// Empty reports whether the rules leave every file wanted.
+func (r *FileRules) Empty() bool {
+	return len(r.Include) == 0 && len(r.Exclude) == 0 && len(r.Require) == 0
+}
+
+// Validate compiles the patterns, so loadConfig can reject a bad one.
+func (r *FileRules) Validate() error {
+	_, _, err := r.compile()
+	return err
+}
+
+func (r *FileRules) compile() (include, exclude []*regexp.Regexp, err error) {
+	for _, p := range r.Include {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Files: unable to compile Include %q: %w", p, err)
+		}
+		include = append(include, re)
+	}
+	for _, p := range r.Exclude {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Files: unable to compile Exclude %q: %w", p, err)
+		}
+		exclude = append(exclude, re)
+	}
+	return include, exclude, nil
+}
+
+// wanter returns the rules as a test of one file, whose Multi labels are
+// multi. A pattern that does not compile, which loadConfig has already
+// rejected, wants every file.
+func (r *FileRules) wanter(multi map[string]bool) func(path string, labels map[string]string) bool {
+	include, exclude, err := r.compile()
+	if err != nil {
+		log.WithError(err).Error("Unable to compile file rules")
+		return func(string, map[string]string) bool { return true }
+	}
+	require := Group{Require: r.Require, multi: multi}
+	return func(path string, labels map[string]string) bool {
+		if len(include) > 0 && !slices.ContainsFunc(include, func(re *regexp.Regexp) bool { return re.MatchString(path) }) {
+			return false
+		}
+		if slices.ContainsFunc(exclude, func(re *regexp.Regexp) bool { return re.MatchString(path) }) {
+			return false
+		}
+		return require.Matches(labels)
+	}
+}
+
+// fileSelection is what a winner's file rules made of its torrent: the
+// indexes Transmission is to download and skip, and the skipped paths for the
+// /cancel page. Reason notes files the bundle policy left out, for history.
+// The zero value downloads everything.
+type fileSelection struct {
+	Wanted       []int64
+	Unwanted     []int64
+	UnwantedPath []string
+	Reason       string
+}
+
+// selectFiles applies the feed's Files rules and those of the Groups w
+// matched to w's files. A file must pass the feed's rules and, when any
+// matched group has rules, the rules of at least one such group. A file of an
+// identity key in w.coveredKeys is left out too. Each file is judged on its
+// own labels over the title's, as in coverages. A selection that would leave
+// nothing to download is dropped in favour of the whole torrent, as is one for
+// a torrent whose file list is unknown.
+func selectFiles(feedCfg Feed, w *candidate) fileSelection {
+	if w.meta == nil || len(w.meta.Files) == 0 {
+		return fileSelection{}
+	}
+	var feedRule func(string, map[string]string) bool
+	if !feedCfg.Files.Empty() {
+		feedRule = feedCfg.Files.wanter(feedCfg.multi)
+	}
+	var groupRules []func(string, map[string]string) bool
+	covs := w.coverages(feedCfg.Identity)
+	for _, g := range feedCfg.Groups {
+		if g.Files.Empty() {
+			continue
+		}
+		if slices.ContainsFunc(covs, func(cov coverage) bool { return g.Matches(cov.labels) }) {
+			groupRules = append(groupRules, g.Files.wanter(g.multi))
+		}
+	}
+	if feedRule == nil && len(groupRules) == 0 && len(w.coveredKeys) == 0 {
+		return fileSelection{}
+	}
+
+	var sel fileSelection
+	coveredFiles := 0
+	for i, f := range w.meta.Files {
+		var fileLabels map[string]string
+		if i < len(w.perFileLabels) {
+			fileLabels = w.perFileLabels[i]
+		}
+		labels := withDefaultLabels(MergeLabels(w.titleLabels, fileLabels), w.defaults)
+		wanted := feedRule == nil || feedRule(f.Path, labels)
+		if wanted && len(groupRules) > 0 {
+			wanted = slices.ContainsFunc(groupRules, func(rule func(string, map[string]string) bool) bool {
+				return rule(f.Path, labels)
+			})
+		}
+		if key, ok := IdentityKey(labels, feedCfg.Identity); wanted && ok && w.coveredKeys[key] {
+			wanted = false
+			coveredFiles++
+		}
+		if wanted {
+			sel.Wanted = append(sel.Wanted, int64(i))
+		} else {
+			sel.Unwanted = append(sel.Unwanted, int64(i))
+			sel.UnwantedPath = append(sel.UnwantedPath, f.Path)
+		}
+	}
+	if len(sel.Wanted) == 0 {
+		log.Warnf("File rules leave nothing of %s to download, downloading all of it", w.item.Item.Title)
+		return fileSelection{}
+	}
+	if len(sel.Unwanted) == 0 {
+		return fileSelection{}
+	}
+	if coveredFiles > 0 {
+		sel.Reason = coveredNote(coveredFiles, w.coveredKeys)
+	}
+	return sel
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/hekmon/transmissionrpc/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bundleCandidate is a MotoGP/Moto2 bundle with a sample and an NFO, its
+// file labels extracted the way processFeed does.
+func bundleCandidate(t *testing.T) *candidate {
+	t.Helper()
+	meta, err := ParseMetaInfo(buildMultiFileTorrent("RD01", [][]string{
+		{"MotoGP.RD01.Race.mkv"},
+		{"Moto2.RD01.Race.mkv"},
+		{"Sample", "MotoGP.RD01.sample.mkv"},
+		{"RD01.nfo"},
+	}))
+	require.NoError(t, err)
+	extractor := &ExtractorSet{Labels: map[string]LabelDef{
+		"round": {Regexp: `(RD\d+)`},
+		"class": {Regexp: `(MotoGP|Moto2|Moto3)`},
+	}}
+	c := &candidate{
+		item:        &FeedItem{Item: makeGofeedItemWithEnclosure("RD01.Bundle", "g1", "https://example.com/x.torrent")},
+		titleLabels: extractor.ExtractLabels("RD01.Bundle"),
+		defaults:    map[string]string{},
+	}
+	c.setMeta(meta)
+	c.extractFileLabels(extractor)
+	return c
+}
+
+func TestSelectFiles_FeedIncludeExclude(t *testing.T) {
+	feedCfg := Feed{
+		Identity: []string{"round"},
+		Groups:   []Group{{Require: map[string][]string{}}},
+		Files:    FileRules{Include: []string{`\.mkv$`}, Exclude: []string{`(?i)sample`}},
+	}
+	sel := selectFiles(feedCfg, bundleCandidate(t))
+	assert.Equal(t, []int64{0, 1}, sel.Wanted)
+	assert.Equal(t, []int64{2, 3}, sel.Unwanted)
+	assert.Equal(t, []string{"Sample/MotoGP.RD01.sample.mkv", "RD01.nfo"}, sel.UnwantedPath)
+}
+
+// A group's rules apply to the winners it matched: only files whose own
+// labels satisfy its Require are downloaded.
+func TestSelectFiles_GroupRequire(t *testing.T) {
+	feedCfg := Feed{
+		Identity: []string{"round"},
+		Groups: []Group{
+			{Require: map[string][]string{"round": {"RD01"}}, Files: FileRules{
+				Require: map[string][]string{"class": {"MotoGP"}},
+			}},
+			{Require: map[string][]string{"round": {"RD99"}}, Files: FileRules{
+				Include: []string{`nfo$`},
+			}},
+		},
+		Files: FileRules{Exclude: []string{`(?i)sample`}},
+	}
+	sel := selectFiles(feedCfg, bundleCandidate(t))
+	assert.Equal(t, []int64{0}, sel.Wanted, "the RD99 group did not match, so its rules do not apply")
+	assert.Equal(t, []int64{1, 2, 3}, sel.Unwanted)
+}
+
+func TestSelectFiles_NothingWantedDownloadsAll(t *testing.T) {
+	feedCfg := Feed{
+		Identity: []string{"round"},
+		Groups:   []Group{{Require: map[string][]string{}}},
+		Files:    FileRules{Include: []string{`\.avi$`}},
+	}
+	assert.Empty(t, selectFiles(feedCfg, bundleCandidate(t)).Unwanted)
+}
+
+func TestSelectFiles_NoRulesOrNoFileList(t *testing.T) {
+	feedCfg := Feed{Identity: []string{"round"}, Groups: []Group{{Require: map[string][]string{}}}}
+	assert.Equal(t, fileSelection{}, selectFiles(feedCfg, bundleCandidate(t)))
+
+	feedCfg.Files = FileRules{Exclude: []string{`nfo$`}}
+	c := bundleCandidate(t)
+	c.meta = nil
+	assert.Equal(t, fileSelection{}, selectFiles(feedCfg, c), "a magnet-only winner has no files to select")
+}
+
+func TestDispatch_FileRulesSetUnwantedFiles(t *testing.T) {
+	var added map[string]any
+	srv := recordingTransmissionServer(t, func(args map[string]any) { added = args })
+	defer srv.Close()
+	endpoint, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	client, err := transmissionrpc.New(endpoint, nil)
+	require.NoError(t, err)
+
+	ctx := &RunContext{Cache: emptyCache(), transmission: client}
+	feedCfg := Feed{
+		Identity: []string{"round"},
+		Groups:   []Group{{Require: map[string][]string{}}},
+		Files:    FileRules{Exclude: []string{`(?i)sample`, `nfo$`}},
+	}
+	c := bundleCandidate(t)
+	c.torrentBytes = buildMultiFileTorrent("RD01", [][]string{{"a"}, {"b"}, {"c"}, {"d"}})
+
+	assert.True(t, (&OnceCmd{}).dispatch(ctx, feedCfg, "F", c, []string{"round=RD01"}))
+	require.NotNil(t, added)
+	assert.Equal(t, []any{float64(0), float64(1)}, added["files-wanted"])
+	assert.Equal(t, []any{float64(2), float64(3)}, added["files-unwanted"])
+}
@@ -48,14 +48,31 @@ type HistoryRecord struct {
 	Reason      string            `json:"Reason,omitempty"`
 	Labels      map[string]string `json:"Labels,omitempty"`
 	TorrentURL  string            `json:"TorrentURL,omitempty"`
+	MagnetURI   string            `json:"MagnetURI,omitempty"`
+	InfoHash    string            `json:"InfoHash,omitempty"`
 	SizeBytes   int64             `json:"SizeBytes,omitempty"`
+	// WantedBytes is the size of the files added to Transmission, less
+	// those the Files rules left unwanted, which Quota counts. Zero means
+	// the whole torrent.
+	WantedBytes int64 `json:"WantedBytes,omitempty"`
+	// Dispatched is when the torrent was added to Transmission. Unlike
+	// ProcessedAt it stays put when Retention later marks it removed, so
+	// Quota can count it.
+	Dispatched time.Time `json:"Dispatched,omitzero"`
+	// Completed is when Transmission finished downloading the torrent.
+	Completed time.Time `json:"Completed,omitzero"`
+	// Actions is the status of each OnComplete action, by action.
+	Actions map[string]string `json:"Actions,omitempty"`
 }
 
 // outcomeRank returns a rank for dedup: lower is more interesting.
 // "dispatched"/"downloaded" beat "notified" beat "skipped" beat "excluded" beat "error".
+// "removed" ranks with "dispatched": it is what became of a dispatched torrent.
+// "deferred" and "waiting" rank last: they only say the item is waiting, so
+// whatever a later run does with it replaces them.
 func outcomeRank(outcome string) int {
 	switch outcome {
-	case "dispatched", "downloaded":
+	case "dispatched", "downloaded", removedOutcome:
 		return 0
 	case "notified":
 		return 1
@@ -63,6 +80,10 @@ func outcomeRank(outcome string) int {
 		return 2
 	case "excluded":
 		return 3
+	case "deferred":
+		return 5
+	case waitingOutcome:
+		return 6
 	default:
 		return 4
 	}
@@ -72,12 +93,20 @@ func historyKey(feedName, guid string) string {
 	return feedName + "|" + guid
 }
 
-// NewHistoryRecord builds a HistoryRecord from a gofeed.Item. TorrentURL and
-// SizeBytes are captured from the item's bittorrent enclosure (when present) so
-// a later "torrent this" retry can re-fetch the .torrent without the original
-// RSS entry — dispatch() never persists the .torrent bytes themselves.
+// NewHistoryRecord builds a HistoryRecord from a gofeed.Item. TorrentURL,
+// MagnetURI and SizeBytes are captured from the item (when present) so a later
+// "torrent this" retry can resubmit without the original RSS entry —
+// dispatch() never persists the .torrent bytes themselves.
 func NewHistoryRecord(feedName string, item *gofeed.Item, outcome, reason string, labels map[string]string) HistoryRecord {
-	torrentURL, _ := (&FeedItem{Item: item}).TorrentURL()
+	return newItemHistoryRecord(feedName, &FeedItem{Item: item}, outcome, reason, labels)
+}
+
+// newItemHistoryRecord is NewHistoryRecord for a FeedItem, whose fetched
+// .torrent (if any) supplies the infohash and size.
+func newItemHistoryRecord(feedName string, fi *FeedItem, outcome, reason string, labels map[string]string) HistoryRecord {
+	item := fi.Item
+	torrentURL, _ := fi.TorrentURL()
+	magnet, _ := fi.MagnetURI()
 	rec := HistoryRecord{
 		Feed:       feedName,
 		Title:      item.Title,
@@ -86,11 +115,16 @@ func NewHistoryRecord(feedName string, item *gofeed.Item, outcome, reason string
 		Reason:     reason,
 		Labels:     labels,
 		TorrentURL: torrentURL,
-		SizeBytes:  extractSize(item),
+		MagnetURI:  magnet,
+		InfoHash:   fi.InfoHash(),
+		SizeBytes:  fi.Size(),
 	}
 	if item.PublishedParsed != nil {
 		rec.Published = *item.PublishedParsed
 	}
+	if outcome == "dispatched" {
+		rec.Dispatched = time.Now()
+	}
 	return rec
 }
 
@@ -141,6 +175,57 @@ func (h *HistoryFile) AddOrUpdateRecord(rec HistoryRecord) {
 	h.Records = append(h.Records, rec)
 }
 
+// SetOutcome replaces the outcome and reason of the record of feedName/guid,
+// whatever its rank, for what later became of an item. An empty outcome keeps
+// the record's own. It reports whether there was a record.
+func (h *HistoryFile) SetOutcome(feedName, guid, outcome, reason string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	idx, ok := h.guidIndex[historyKey(feedName, guid)]
+	if !ok {
+		return false
+	}
+	if outcome != "" {
+		h.Records[idx].Outcome = outcome
+	}
+	h.Records[idx].Reason = reason
+	h.Records[idx].ProcessedAt = time.Now()
+	return true
+}
+
+// MarkComplete records that the torrent of feedName/guid finished
+// downloading at when, leaving its outcome as it is. It reports whether there
+// was a record.
+func (h *HistoryFile) MarkComplete(feedName, guid string, when time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	idx, ok := h.guidIndex[historyKey(feedName, guid)]
+	if !ok {
+		return false
+	}
+	h.Records[idx].Completed = when
+	return true
+}
+
+// SetActionStatus records the status of the OnComplete action of the record
+// of feedName/guid. It reports whether there was a record.
+func (h *HistoryFile) SetActionStatus(feedName, guid, action, status string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	idx, ok := h.guidIndex[historyKey(feedName, guid)]
+	if !ok {
+		return false
+	}
+	if h.Records[idx].Actions == nil {
+		h.Records[idx].Actions = map[string]string{}
+	}
+	h.Records[idx].Actions[action] = status
+	return true
+}
+
 // SaveHistory prunes records older than d and writes the file.
 func (h *HistoryFile) SaveHistory(d time.Duration) error {
 	h.mu.Lock()
@@ -170,13 +255,39 @@ func (h *HistoryFile) SaveHistory(d time.Duration) error {
 // to the history file when one is configured. The log always fires — it's the
 // only visibility into per-item outcomes when --history-file isn't set.
 func (ctx *RunContext) recordHistory(feedName string, item *gofeed.Item, outcome, reason string, labels map[string]string) {
+	ctx.recordItemHistory(feedName, &FeedItem{Item: item}, outcome, reason, labels)
+}
+
+// recordItemHistory is recordHistory for a FeedItem, so a record of an item
+// whose .torrent was fetched carries its infohash and real size.
+func (ctx *RunContext) recordItemHistory(feedName string, fi *FeedItem, outcome, reason string, labels map[string]string) {
+	item := fi.Item
 	if reason != "" {
 		log.Infof("[%s] %s: %s (%s)", feedName, outcome, item.Title, reason)
 	} else {
 		log.Infof("[%s] %s: %s", feedName, outcome, item.Title)
 	}
 	if ctx.History != nil {
-		ctx.History.AddOrUpdateRecord(NewHistoryRecord(feedName, item, outcome, reason, labels))
+		ctx.History.AddOrUpdateRecord(newItemHistoryRecord(feedName, fi, outcome, reason, labels))
+	}
+}
+
+// recordDispatched records w as dispatched to Transmission with the files
+// files leaves wanted.
+func (ctx *RunContext) recordDispatched(feedName string, w *candidate, files fileSelection, labels map[string]string) {
+	ctx.recordItemHistory(feedName, w.item, "dispatched", files.Reason, labels)
+	if ctx.History != nil && len(files.Unwanted) > 0 {
+		ctx.History.setWantedBytes(feedName, w.item.Item.GUID, wantedSize(w, files))
+	}
+}
+
+// setWantedBytes sets the WantedBytes of the record of feedName/guid.
+func (h *HistoryFile) setWantedBytes(feedName, guid string, n int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if idx, ok := h.guidIndex[historyKey(feedName, guid)]; ok {
+		h.Records[idx].WantedBytes = n
 	}
 }
 
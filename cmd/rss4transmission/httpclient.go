@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	str2duration "github.com/xhit/go-str2duration/v2"
+)
+
+// defaultFeedTimeout bounds every RSS and .torrent request whose feed does not
+// set HTTP.Timeout. Without a bound a tracker that accepts the connection and
+// then never answers stalls the whole watch loop.
+const defaultFeedTimeout = 30 * time.Second
+
+// HTTPProfile is the per-feed HTTP client configuration. It applies to both
+// the RSS fetch and the .torrent download, which is what a private tracker
+// checks its cookie or passkey header on.
+type HTTPProfile struct {
+	Headers    map[string]string `koanf:"Headers"`
+	Cookies    map[string]string `koanf:"Cookies"`
+	CookieFile string            `koanf:"CookieFile"`
+	Username   string            `koanf:"Username"`
+	Password   string            `koanf:"Password"` //nolint:gosec
+	UserAgent  string            `koanf:"UserAgent"`
+	Timeout    string            `koanf:"Timeout"`
+	Proxy      string            `koanf:"Proxy"`
+}
+
+// FeedClient makes the HTTP requests for a single feed. It carries the
+// profile's headers, cookies and credentials onto every request, and a cookie
+// jar so anything the tracker sets with Set-Cookie is sent back on the next
+// request.
+type FeedClient struct {
+	client  *http.Client
+	profile HTTPProfile
+	cookies []*http.Cookie
+}
+
+// defaultFeedClient is used by a feed built without Compile (in tests, or by a
+// caller that skipped loadConfig) and for URLs no feed owns.
+var defaultFeedClient = &FeedClient{client: &http.Client{Timeout: defaultFeedTimeout}}
+
+// NewFeedClient builds the client for a feed's HTTP profile. noValidateCert is
+// Feed.NoValidateCert, which predates the profile and so stays on Feed.
+//
+// It returns an error rather than calling log.Fatalf so that loadConfig can
+// reject a bad value and keep the running config.
+func NewFeedClient(profile HTTPProfile, noValidateCert bool) (*FeedClient, error) {
+	timeout := defaultFeedTimeout
+	if profile.Timeout != "" {
+		d, err := str2duration.ParseDuration(profile.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse HTTP.Timeout %q: %w", profile.Timeout, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("HTTP.Timeout %q must be positive", profile.Timeout)
+		}
+		timeout = d
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if profile.Proxy != "" {
+		u, err := url.Parse(profile.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse HTTP.Proxy %q: %w", profile.Proxy, err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("HTTP.Proxy %q must be a full URL, e.g. http://gluetun:8888", profile.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	if noValidateCert {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} //nolint:gosec
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create cookie jar: %w", err)
+	}
+	if profile.CookieFile != "" {
+		if err := loadCookieFile(jar, GetPath(profile.CookieFile)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sorted so the Cookie header is the same on every request, which keeps
+	// the request byte-identical for anything that logs or compares it.
+	names := make([]string, 0, len(profile.Cookies))
+	for name := range profile.Cookies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cookies := make([]*http.Cookie, 0, len(names))
+	for _, name := range names {
+		cookies = append(cookies, &http.Cookie{Name: name, Value: profile.Cookies[name]})
+	}
+
+	return &FeedClient{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			Jar:       jar,
+		},
+		profile: profile,
+		cookies: cookies,
+	}, nil
+}
+
+// NewRequest builds a GET for rawURL carrying the profile's headers, cookies,
+// basic auth and user agent.
+func (c *FeedClient) NewRequest(rawURL string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ua := c.profile.UserAgent
+	if ua == "" {
+		ua = fmt.Sprintf("rss4transmission/%s", Version)
+	}
+	req.Header.Set("User-Agent", ua)
+	for k, v := range c.profile.Headers {
+		req.Header.Set(k, v)
+	}
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+	if c.profile.Username != "" || c.profile.Password != "" {
+		req.SetBasicAuth(c.profile.Username, c.profile.Password)
+	}
+	return req, nil
+}
+
+// Get fetches rawURL through the profile.
+func (c *FeedClient) Get(rawURL string) (*http.Response, error) {
+	req, err := c.NewRequest(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Do(req)
+}
+
+// loadCookieFile adds the cookies in a Netscape-format cookies.txt (what
+// browser export extensions and curl's -c write) to jar. Expired cookies are
+// skipped.
+func loadCookieFile(jar http.CookieJar, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open HTTP.CookieFile %q: %w", path, err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		httpOnly := false
+		if strings.HasPrefix(line, "#HttpOnly_") {
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+			httpOnly = true
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return fmt.Errorf("HTTP.CookieFile %q line %d: expected 7 tab-separated fields, got %d",
+				path, lineNo, len(fields))
+		}
+		domain, cookiePath, secure, expires, name, value := fields[0], fields[2], fields[3], fields[4], fields[5], fields[6]
+
+		cookie := &http.Cookie{
+			Name:     name,
+			Value:    value,
+			Path:     cookiePath,
+			Secure:   strings.EqualFold(secure, "TRUE"),
+			HttpOnly: httpOnly,
+		}
+		if exp, err := strconv.ParseInt(expires, 10, 64); err == nil && exp > 0 {
+			cookie.Expires = time.Unix(exp, 0)
+			if cookie.Expires.Before(time.Now()) {
+				continue
+			}
+		}
+		// A leading dot means the cookie applies to subdomains too, which is
+		// what the jar does with an explicit Domain attribute.
+		host := strings.TrimPrefix(domain, ".")
+		if strings.HasPrefix(domain, ".") {
+			cookie.Domain = host
+		}
+		scheme := "http"
+		if cookie.Secure {
+			scheme = "https"
+		}
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: "/"}, []*http.Cookie{cookie})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to read HTTP.CookieFile %q: %w", path, err)
+	}
+	return nil
+}
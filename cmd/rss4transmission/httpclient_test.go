@@ -0,0 +1,177 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRSS = `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>t</title>
+<item><title>MotoGP.RD01.Race</title><guid>g1</guid></item>
+</channel></rss>`
+
+func TestFeedClient_AppliesProfileToRequests(t *testing.T) {
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		_, _ = w.Write([]byte(testRSS))
+	}))
+	defer srv.Close()
+
+	client, err := NewFeedClient(HTTPProfile{
+		Headers:   map[string]string{"X-Passkey": "secret"},
+		Cookies:   map[string]string{"uid": "42", "pass": "hash"},
+		Username:  "user",
+		Password:  "pw",
+		UserAgent: "tracker-friendly/1.0",
+	}, false)
+	require.NoError(t, err)
+
+	rss, err := fetchFeed(client, srv.URL)
+	require.NoError(t, err)
+	require.Len(t, rss.Items, 1)
+
+	require.NotNil(t, got)
+	assert.Equal(t, "secret", got.Header.Get("X-Passkey"))
+	assert.Equal(t, "tracker-friendly/1.0", got.UserAgent())
+	user, pass, ok := got.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "user", user)
+	assert.Equal(t, "pw", pass)
+	uid, err := got.Cookie("uid")
+	require.NoError(t, err)
+	assert.Equal(t, "42", uid.Value)
+	passCookie, err := got.Cookie("pass")
+	require.NoError(t, err)
+	assert.Equal(t, "hash", passCookie.Value)
+}
+
+func TestFeedClient_DefaultUserAgent(t *testing.T) {
+	var ua string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua = r.UserAgent()
+		_, _ = w.Write(sentinelTorrent)
+	}))
+	defer srv.Close()
+
+	client, err := NewFeedClient(HTTPProfile{}, false)
+	require.NoError(t, err)
+	_, err = fetchTorrentBytes(client, srv.URL+"/a.torrent")
+	require.NoError(t, err)
+	assert.Equal(t, "rss4transmission/"+Version, ua)
+}
+
+// A tracker that accepts the connection and never answers must not hold the
+// run hostage: the request gives up after HTTP.Timeout.
+func TestFeedClient_TimeoutBoundsAHungServer(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client, err := NewFeedClient(HTTPProfile{Timeout: "100ms"}, false)
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = fetchFeed(client, srv.URL)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestFeedClient_NoValidateCert(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(testRSS))
+	}))
+	defer srv.Close()
+
+	strict, err := NewFeedClient(HTTPProfile{}, false)
+	require.NoError(t, err)
+	_, err = fetchFeed(strict, srv.URL)
+	assert.Error(t, err, "a self-signed certificate must be rejected by default")
+
+	lax, err := NewFeedClient(HTTPProfile{}, true)
+	require.NoError(t, err)
+	_, err = fetchFeed(lax, srv.URL)
+	assert.NoError(t, err, "NoValidateCert must skip certificate validation")
+}
+
+func TestFeedClient_Proxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		_, _ = w.Write([]byte(testRSS))
+	}))
+	defer proxy.Close()
+
+	client, err := NewFeedClient(HTTPProfile{Proxy: proxy.URL}, false)
+	require.NoError(t, err)
+	_, err = fetchFeed(client, "http://tracker.invalid/rss")
+	require.NoError(t, err)
+	assert.Equal(t, "http://tracker.invalid/rss", proxied)
+}
+
+func TestFeedClient_CookieFile(t *testing.T) {
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		_, _ = w.Write([]byte(testRSS))
+	}))
+	defer srv.Close()
+
+	cookies := "# Netscape HTTP Cookie File\n" +
+		"127.0.0.1\tFALSE\t/\tFALSE\t0\tsession\tabc123\n" +
+		"#HttpOnly_127.0.0.1\tFALSE\t/\tFALSE\t0\ttoken\txyz\n" +
+		"127.0.0.1\tFALSE\t/\tFALSE\t1\texpired\tgone\n"
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	require.NoError(t, os.WriteFile(path, []byte(cookies), 0600))
+
+	client, err := NewFeedClient(HTTPProfile{CookieFile: path}, false)
+	require.NoError(t, err)
+	_, err = fetchFeed(client, srv.URL)
+	require.NoError(t, err)
+
+	session, err := got.Cookie("session")
+	require.NoError(t, err)
+	assert.Equal(t, "abc123", session.Value)
+	token, err := got.Cookie("token")
+	require.NoError(t, err)
+	assert.Equal(t, "xyz", token.Value)
+	_, err = got.Cookie("expired")
+	assert.Error(t, err, "an expired cookie must not be sent")
+}
+
+func TestFeedClient_CookieFileRejectsMalformedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	require.NoError(t, os.WriteFile(path, []byte("example.com\tTRUE\t/\n"), 0600))
+
+	_, err := NewFeedClient(HTTPProfile{CookieFile: path}, false)
+	assert.Error(t, err)
+}
+
+// The .torrent download goes through the same profile as the RSS fetch, which
+// is what a private tracker checks its passkey on.
+func TestFeedItem_FetchTorrentUsesFeedProfile(t *testing.T) {
+	var passkey string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		passkey = r.Header.Get("X-Passkey")
+		_, _ = w.Write(sentinelTorrent)
+	}))
+	defer srv.Close()
+
+	feedCfg := Feed{Name: "F", HTTP: HTTPProfile{Headers: map[string]string{"X-Passkey": "pk"}}}
+	fi := makeFeedItemWithURL("My.Title", srv.URL+"/my.torrent")
+	fi.client = feedCfg.Client()
+
+	_, err := fi.getTorrentContents("")
+	require.NoError(t, err)
+	assert.Equal(t, "pk", passkey)
+}
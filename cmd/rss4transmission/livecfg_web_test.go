@@ -171,7 +171,7 @@ func TestNotifyCompleteRoute_GateIsLive(t *testing.T) {
 	mux := http.NewServeMux()
 	registerNotifyCompleteRoute(mux, func() NtfyConfig {
 		return live.Load().(NtfyConfig)
-	}, staticNotif(NotificationsConfig{}), nil)
+	}, staticNotif(NotificationsConfig{}), nil, nil)
 
 	post := func() int {
 		body := bytes.NewBufferString(`{"name":"My.Show","dir":"/dl","id":1}`)
@@ -246,7 +246,7 @@ func TestSpeedRoutes_GateIsLive(t *testing.T) {
 	registerSpeedRoutes(mux, func() *SpeedFile {
 		s, _ := live.Load().(*SpeedFile)
 		return s
-	}, nil, nil, nil, staticActions(speedActions{}), navConfig{})
+	}, nil, nil, nil, staticActions(speedActions{}), navConfig{}, nil)
 
 	for _, path := range []string{"/speedtest", "/rotations"} {
 		if code, _ := getBody(t, mux, path); code != http.StatusNotFound {
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+// isMagnet reports whether s is a magnet URI.
+func isMagnet(s string) bool {
+	return len(s) >= len("magnet:") && strings.EqualFold(s[:len("magnet:")], "magnet:")
+}
+
+// magnetInfoHash returns the v1 infohash named by a magnet URI's
+// xt=urn:btih: parameter, as lowercase hex. ok is false when the URI is not a
+// magnet or names no usable v1 hash.
+func magnetInfoHash(uri string) (string, bool) {
+	if !isMagnet(uri) {
+		return "", false
+	}
+	// url.ParseQuery wants the part after "magnet:?".
+	query := strings.TrimPrefix(uri[len("magnet:"):], "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", false
+	}
+	for _, xt := range values["xt"] {
+		const prefix = "urn:btih:"
+		if len(xt) <= len(prefix) || !strings.EqualFold(xt[:len(prefix)], prefix) {
+			continue
+		}
+		if hash, ok := normalizeInfoHash(xt[len(prefix):]); ok {
+			return hash, true
+		}
+	}
+	return "", false
+}
+
+// normalizeInfoHash returns a v1 infohash as lowercase hex. It accepts the 40
+// character hex form and the 32 character base32 form older magnet links use.
+func normalizeInfoHash(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	switch len(s) {
+	case 40:
+		if _, err := hex.DecodeString(s); err != nil {
+			return "", false
+		}
+		return strings.ToLower(s), true
+	case 32:
+		raw, err := base32.StdEncoding.DecodeString(strings.ToUpper(s))
+		if err != nil {
+			return "", false
+		}
+		return hex.EncodeToString(raw), true
+	}
+	return "", false
+}
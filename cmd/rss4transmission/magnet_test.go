@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testInfoHash = "0123456789abcdef0123456789abcdef01234567"
+
+func TestMagnetInfoHash_Hex(t *testing.T) {
+	hash, ok := magnetInfoHash("magnet:?xt=urn:btih:0123456789ABCDEF0123456789ABCDEF01234567&dn=MotoGP.RD01")
+	assert.True(t, ok)
+	assert.Equal(t, testInfoHash, hash, "hex hashes are lowercased")
+}
+
+func TestMagnetInfoHash_Base32(t *testing.T) {
+	// base32 of the 20 bytes 0x01..0x14
+	hash, ok := magnetInfoHash("magnet:?xt=urn:btih:AEBAGBAFAYDQQCIKBMGA2DQPCAIREEYU")
+	assert.True(t, ok)
+	assert.Equal(t, "0102030405060708090a0b0c0d0e0f1011121314", hash)
+}
+
+func TestMagnetInfoHash_SkipsNonBTIH(t *testing.T) {
+	hash, ok := magnetInfoHash("magnet:?xt=urn:sha1:abc&xt=urn:btih:" + testInfoHash)
+	assert.True(t, ok)
+	assert.Equal(t, testInfoHash, hash)
+}
+
+func TestMagnetInfoHash_Rejects(t *testing.T) {
+	for _, uri := range []string{
+		"https://example.com/a.torrent",
+		"magnet:?dn=no-hash",
+		"magnet:?xt=urn:btih:tooshort",
+		"magnet:?xt=urn:btih:zz23456789abcdef0123456789abcdef01234567",
+	} {
+		_, ok := magnetInfoHash(uri)
+		assert.False(t, ok, uri)
+	}
+}
@@ -92,6 +92,16 @@ type RunContext struct {
 	// abandons a measurement in flight, which is acceptable at the hourly
 	// cadence the monitor runs at.
 	speedCancel context.CancelFunc
+
+	// lowSpace holds the download-dirs a winner was last held back from for
+	// lack of space, so the alert is sent once until there is room again.
+	lowSpace map[string]bool
+	// quotaWarned is set once the warning that Quota needs a history file
+	// has been logged.
+	quotaWarned bool
+	// announced are the torrents /notify-complete has sent the completed
+	// notification for. It is shared with the web server's goroutines.
+	announced hookAnnouncements
 }
 
 type CLI struct {
@@ -105,6 +115,8 @@ type CLI struct {
 	Version   VersionCmd   `kong:"cmd,help='Print version and exit'"`
 	Watch     WatchCmd     `kong:"cmd,help='Scrape RSS feeds in a loop'"`
 	Once      OnceCmd      `kong:"cmd,help='Scrape RSS feeds once'"`
+	Backfill  BackfillCmd  `kong:"cmd,help='Search for expected content missing from the seen cache'"`
+	Retention RetentionCmd `kong:"cmd,help='Remove torrents that have seeded enough or been superseded'"`
 	Simulate  SimulateCmd  `kong:"cmd,help='Replay a local RSS feed file for testing'"`
 	SpeedTest SpeedTestCmd `kong:"cmd,name='speedtest',help='Run a single speedtest over the VPN proxy'"`
 }
@@ -318,6 +330,29 @@ func (rc *RunContext) loadConfig(configFile string) error {
 		return fmt.Errorf("invalid Gluetun configuration: %w", err)
 	}
 
+	if err := cfg.Fetch.Validate(); err != nil {
+		return fmt.Errorf("invalid Fetch configuration: %w", err)
+	}
+
+	if err := cfg.DiskSpace.Validate(); err != nil {
+		return fmt.Errorf("invalid DiskSpace configuration: %w", err)
+	}
+
+	if cfg.MaxDispatchPerRun < 0 {
+		return fmt.Errorf("MaxDispatchPerRun %d must not be negative", cfg.MaxDispatchPerRun)
+	}
+
+	if err := cfg.Quota.Validate(); err != nil {
+		return fmt.Errorf("invalid global %w", err)
+	}
+	if err := cfg.Quota.withinHistory(cfg.SeenCacheDays); err != nil {
+		return fmt.Errorf("invalid global %w", err)
+	}
+
+	if err := cfg.Schedule.Validate(); err != nil {
+		return fmt.Errorf("invalid global %w", err)
+	}
+
 	// Compiling the extractors here does double duty: it rejects a bad Regexp
 	// or Normalize pattern up front instead of at first use, and it means the
 	// map is fully built before anything shares it, so handing a Config copy
@@ -340,6 +375,9 @@ func (rc *RunContext) loadConfig(configFile string) error {
 		if err := feedCfg.Compile(); err != nil {
 			return fmt.Errorf("invalid feed %q config: %w", feedCfg.Name, err)
 		}
+		if err := feedCfg.Quota.withinHistory(cfg.SeenCacheDays); err != nil {
+			return fmt.Errorf("invalid feed %q config: %w", feedCfg.Name, err)
+		}
 	}
 
 	// Only commit the newly parsed config once every check above has passed,
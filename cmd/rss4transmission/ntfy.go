@@ -44,6 +44,17 @@ type NtfyVpnRotatedContext struct {
 	SameExit   bool
 }
 
+// NtfyDiskSpaceContext holds the data available to the templates for the alert
+// sent when a winner is held back for lack of space. Free and Needed are
+// formatted sizes.
+type NtfyDiskSpaceContext struct {
+	Title    string
+	FeedName string
+	Dir      string
+	Free     string
+	Needed   string
+}
+
 // NtfyTemplateContext holds all torrent data available to notification templates.
 type NtfyTemplateContext struct {
 	Title     string
@@ -180,6 +191,13 @@ func (c *NtfyConfig) Validate() error {
 		if err != nil {
 			return err
 		}
+		c.lowSpaceTitleTmpl, c.lowSpaceBodyTmpl, err = compileNotificationTemplates(
+			&c.LowSpaceTitle, &c.LowSpaceBody, &c.LowSpacePriority,
+			"Disk Space Low", "{{.Title}}\nneeds {{.Needed}}, {{.Free}} free in {{.Dir}}", "high",
+			"LowSpaceTitle", "LowSpaceBody", "LowSpacePriority")
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -345,6 +363,18 @@ func (c *NtfyClient) SendVpnRotated(ctx *NtfyVpnRotatedContext) error {
 	return c.post(c.cfg.AlertTopic, title, body, "", c.cfg.VpnRotatedPriority)
 }
 
+func (c *NtfyClient) SendLowSpace(ctx *NtfyDiskSpaceContext) error {
+	title, err := renderTemplate(c.cfg.lowSpaceTitleTmpl, ctx)
+	if err != nil {
+		return err
+	}
+	body, err := renderTemplate(c.cfg.lowSpaceBodyTmpl, ctx)
+	if err != nil {
+		return err
+	}
+	return c.post(c.cfg.AlertTopic, title, body, "", c.cfg.LowSpacePriority)
+}
+
 // notifyConfigReload sends a config-reload outcome notification to ntfy's
 // AlertTopic. No-op when BaseURL or AlertTopic is unset. Send failures are
 // logged as warnings, never fatal — a broken notification channel must not
@@ -425,3 +455,17 @@ func notifyVpnRotated(cfg NtfyConfig, ctx *NtfyVpnRotatedContext) {
 		log.WithError(err).Warn("Failed to send ntfy vpn-rotated notification")
 	}
 }
+
+// notifyLowSpace sends the alert that a winner is held back for lack of
+// space to ntfy's AlertTopic. No-op when BaseURL or AlertTopic is unset. Send
+// failures are logged as warnings, never fatal.
+func notifyLowSpace(cfg NtfyConfig, ctx *NtfyDiskSpaceContext) {
+	if cfg.BaseURL == "" || cfg.AlertTopic == "" {
+		return
+	}
+
+	client := NewNtfyClient(cfg)
+	if err := client.SendLowSpace(ctx); err != nil {
+		log.WithError(err).Warn("Failed to send ntfy low-space notification")
+	}
+}
@@ -14,11 +14,14 @@ import (
 	"github.com/mmcdole/gofeed"
 )
 
-// extractSize returns the byte length of the bittorrent enclosure, or 0 if
-// no parseable length is found.
+// extractSize returns the item's torznab size attr, else the byte length of
+// the bittorrent (or magnet) enclosure, or 0 if no parseable length is found.
 func extractSize(item *gofeed.Item) int64 {
+	if n, ok := torznabSize(item); ok {
+		return int64(n)
+	}
 	for _, enc := range item.Enclosures {
-		if enc.Type == "application/x-bittorrent" && enc.Length != "" {
+		if (enc.Type == "application/x-bittorrent" || isMagnet(enc.URL)) && enc.Length != "" {
 			if n, err := strconv.ParseInt(enc.Length, 10, 64); err == nil && n > 0 {
 				return n
 			}
@@ -150,6 +153,94 @@ type OnceCmd struct {
 	NoAction        bool     `kong:"short='n',help='Just print results and take no action',xor='action'"`
 	Skip            bool     `kong:"short='s',help='Just skip any matching torrents',xor='action'"`
 	TorrentCacheDir string   `kong:"help='Directory to cache fetched .torrent files across runs'"`
+
+	// schedule is watch's per-feed scheduler. When set, Run fetches only the
+	// feeds that are due; once leaves it nil and fetches every feed.
+	schedule *feedScheduler
+	// budget counts the run's dispatches against MaxDispatchPerRun. Like
+	// pool, Run and Backfill build a fresh one each time.
+	budget *dispatchBudget
+	// quit is set when the user picks Quit at an interactive prompt.
+	quit bool
+	// pool bounds the run's concurrent fetches. Run and Backfill build a
+	// fresh one from the config each time, so a reload applies.
+	pool *fetchPool
+	// txHashes caches Transmission's infohashes for the run; see
+	// transmissionHashes. Run and Backfill clear it.
+	txHashes map[string]bool
+	// backfill is set while processFeed runs on Backfill's search results,
+	// which leave the feed's pending set to its regular runs.
+	backfill bool
+	// postWork wakes watch's OnComplete worker. When set, Completions leaves
+	// the actions to it rather than running them itself.
+	postWork chan<- struct{}
+}
+
+// deferReasonBudget is the history reason for a winner left for a later run.
+const deferReasonBudget = "MaxDispatchPerRun reached"
+
+// dispatchBudget is what is left of a run's MaxDispatchPerRun.
+type dispatchBudget struct {
+	// max is the run's limit; 0 means unlimited.
+	max  int
+	used int
+	// deferred counts winners left for a later run, by feed.
+	deferred map[string]int
+}
+
+func newDispatchBudget(max int) *dispatchBudget {
+	return &dispatchBudget{max: max, deferred: map[string]int{}}
+}
+
+// allows reports whether the run may dispatch another item.
+func (b *dispatchBudget) allows() bool {
+	return b.max <= 0 || b.used < b.max
+}
+
+func (b *dispatchBudget) deferItem(feedName string) {
+	b.deferred[feedName]++
+}
+
+// Deferred is the number of winners left for a later run, across all feeds.
+func (b *dispatchBudget) Deferred() int {
+	n := 0
+	for _, d := range b.deferred {
+		n += d
+	}
+	return n
+}
+
+// feedFetch is one RSS fetch of a run.
+type feedFetch struct {
+	feedCfg  Feed
+	fetchURL string
+	// validators are sent with the request, then replaced by the response's.
+	validators FeedValidators
+	// rss is nil after an error or a 304 Not Modified.
+	rss  *gofeed.Feed
+	err  error
+	done bool
+}
+
+func (f *feedFetch) fetch() {
+	if f.done {
+		return
+	}
+	f.done = true
+	start := time.Now()
+	resp, err := fetchFeedConditional(f.feedCfg.Client(), f.fetchURL, f.validators)
+	log.Tracef("Fetched RSS %s in %s", f.feedCfg.URL, time.Since(start))
+	switch {
+	case err != nil:
+		log.WithError(err).Warnf("Unable to process URL: %s", f.feedCfg.URL)
+		f.err = err
+	case resp.NotModified:
+		// Left nil: nothing to process, and no evidence for pruning either.
+		log.Debugf("Not modified: %s", f.feedCfg.URL)
+	default:
+		f.rss = resp.Feed
+		f.validators = resp.Validators
+	}
 }
 
 // candidate is a feed item that has passed pre-filtering, with its extracted labels.
@@ -158,8 +249,58 @@ type candidate struct {
 	titleLabels  map[string]string
 	fileLabels   []map[string]string // one set per file in the .torrent
 	fileNames    []string            // raw file names from the .torrent, for metadata display
+	meta         *MetaInfo           // parsed .torrent; nil when it was not fetched or did not parse
 	torrentBytes []byte              // raw .torrent content for MetaInfo upload
 	defaults     map[string]string   // label defaults from the extractor config
+	// sizeFromTorrent defers the MinSize/MaxSize check until the .torrent
+	// has been fetched, so it runs against the real total.
+	sizeFromTorrent bool
+	// perFileLabels is fileLabels by file index, nil for a file no label
+	// matched; file rules need the index Transmission knows the file by.
+	perFileLabels []map[string]string
+	// coveredKeys are the identity keys whose files the bundle policy
+	// leaves out of the download, since the cache already has them.
+	coveredKeys map[string]bool
+	// heldForSpace is set by dispatch when there was no room for the
+	// candidate, which keeps it pending for the next fetch.
+	heldForSpace bool
+	// volatile are the volatilePseudoLabels Prefer asks for, which rank the
+	// candidate within its run but stay out of its labels.
+	volatile map[string]string
+}
+
+// rankLabels adds the candidate's volatile pseudo-labels to labels, one of
+// its coverages' labels, to rank it against the other candidates of the run.
+func (c *candidate) rankLabels(labels map[string]string) map[string]string {
+	if len(c.volatile) == 0 {
+		return labels
+	}
+	return MergeLabels(labels, c.volatile)
+}
+
+// setMeta records the candidate's parsed .torrent, on the item too so its
+// infohash and size reach the cache and history.
+func (c *candidate) setMeta(meta *MetaInfo) {
+	c.meta = meta
+	c.item.meta = meta
+	c.fileNames = meta.FileNames()
+}
+
+// extractFileLabels extracts labels from each of the candidate's files, and
+// adds those sourced from the torrent's comment to its title labels.
+func (c *candidate) extractFileLabels(extractor *ExtractorSet) {
+	paths := c.fileNames
+	if c.meta != nil {
+		paths = make([]string, len(c.meta.Files))
+		for i, f := range c.meta.Files {
+			paths[i] = f.Path
+		}
+		if labels := extractor.ExtractMetaLabels(c.meta); len(labels) > 0 {
+			c.titleLabels = MergeLabels(c.titleLabels, labels)
+		}
+	}
+	c.perFileLabels = extractor.ExtractPerFile(paths)
+	c.fileLabels = matchedFileLabels(c.perFileLabels)
 }
 
 // coverages returns the set of {identityKey, mergedLabels} pairs this candidate
@@ -221,9 +362,9 @@ func (cmd *OnceCmd) feedAllowed(feedName string) bool {
 }
 
 // processFeed runs phases 1–4 for a single feed: build candidates, fetch
-// torrent data, select winners, and dispatch. Returns true if the caller
-// should stop processing further feeds this run — either a torrent was
-// dispatched/downloaded, or the user selected Quit interactively.
+// torrent data, select winners, and dispatch as many as MaxDispatchPerRun
+// allows. Returns true if the caller should stop processing further feeds this
+// run, which only happens when the user selects Quit interactively.
 func (cmd *OnceCmd) processFeed(ctx *RunContext, feedName string, feedCfg Feed, rss *gofeed.Feed, extractor *ExtractorSet) bool {
 	// Phase 1: Extract title labels for every item, then pre-filter candidates via
 	// Exclude + size. Labels are extracted before the Check() filter runs so that
@@ -231,63 +372,169 @@ func (cmd *OnceCmd) processFeed(ctx *RunContext, feedName string, feedCfg Feed,
 	// skipped/dispatched records show, and giving the history page's group
 	// primary-row tie-break (bestGroupScore) evidence to work with even when every
 	// sibling feed excludes the same item.
+	//
+	// Items held back by Delay join the feed's own, so they are evaluated
+	// again even once the feed has dropped them. Backfill's search results
+	// leave them to the feed's regular run.
+	var held []PendingItem
+	if !cmd.backfill {
+		held = ctx.Cache.PendingItems(feedName)
+	}
 	var candidates []*candidate
-	for _, item := range rss.Items {
-		fi := &FeedItem{Feed: feedName, Item: item}
+	for _, item := range withPendingItems(rss.Items, held) {
+		fi := &FeedItem{Feed: feedName, Item: item, client: feedCfg.Client()}
 		if ctx.Cache.Exists(feedName, fi) {
 			continue
 		}
-		titleLabels := extractor.ExtractLabels(item.Title)
-		ok, reason := feedCfg.Check(item)
+		titleLabels := feedCfg.ItemLabels(extractor, item)
+		ok, reason := feedCfg.CheckTitle(item)
+		// An enclosure length is often the .torrent file's own size, so when
+		// the .torrent is about to be fetched anyway its total is checked
+		// instead. An indexer's size attr is trusted as it stands.
+		_, hasSizeAttr := torznabSize(item)
+		_, urlErr := fi.TorrentURL()
+		sizeFromTorrent := feedCfg.HasSizeLimits() && !hasSizeAttr && urlErr == nil
+		if ok && !sizeFromTorrent {
+			ok, reason = feedCfg.CheckSize(item, claimedSize(item))
+		}
 		if !ok {
 			ctx.recordHistory(feedName, item, "excluded", reason, titleLabels)
 			ctx.Cache.AddSkippedItem(fi)
 			continue
 		}
 		candidates = append(candidates, &candidate{
-			item:        fi,
-			titleLabels: titleLabels,
-			defaults:    extractor.Defaults(),
+			item:            fi,
+			titleLabels:     titleLabels,
+			defaults:        extractor.Defaults(),
+			sizeFromTorrent: sizeFromTorrent,
 		})
 	}
 
-	// Phase 2: Fetch .torrent for each candidate; extract file-level labels.
-	for _, c := range candidates {
+	// Phase 2: Fetch .torrent for each candidate concurrently, then extract
+	// file-level labels in candidate order.
+	pool := cmd.pool
+	if pool == nil {
+		pool = newFetchPool(ctx.Config.Fetch)
+	}
+	torrents := make([][]byte, len(candidates))
+	fetchErrs := make([]error, len(candidates))
+	torrentURL := func(i int) string {
+		u, _ := candidates[i].item.TorrentURL()
+		return u
+	}
+	pool.Run(len(candidates), torrentURL, func(i int) {
 		start := time.Now()
-		torrentBytes, err := c.item.getTorrentContents(cmd.TorrentCacheDir)
-		if err != nil {
-			log.WithError(err).Debugf("Unable to fetch torrent for %s, using title labels only", c.item.Item.Title)
+		torrents[i], fetchErrs[i] = candidates[i].item.getTorrentContents(cmd.TorrentCacheDir)
+		log.Tracef("Fetched torrent for %s in %s", candidates[i].item.Item.Title, time.Since(start))
+	})
+	for i, c := range candidates {
+		if fetchErrs[i] != nil {
+			log.WithError(fetchErrs[i]).Debugf("Unable to fetch torrent for %s, using title labels only", c.item.Item.Title)
 			continue
 		}
-		log.Tracef("Fetched torrent for %s in %s", c.item.Item.Title, time.Since(start))
-		c.torrentBytes = torrentBytes
-		fileNames, err := TorrentFileNames(torrentBytes)
+		c.torrentBytes = torrents[i]
+		meta, err := ParseMetaInfo(c.torrentBytes)
 		if err != nil {
 			log.WithError(err).Debugf("Unable to parse torrent files for %s", c.item.Item.Title)
 			continue
 		}
-		c.fileNames = fileNames
-		c.fileLabels = extractor.ExtractFromFiles(fileNames)
+		c.setMeta(meta)
+		c.extractFileLabels(extractor)
+	}
+
+	// The size check Phase 1 left for the .torrent. Without one it falls
+	// back to what the feed claims.
+	kept := candidates[:0]
+	for _, c := range candidates {
+		if c.sizeFromTorrent {
+			size := claimedSize(c.item.Item)
+			if c.meta != nil && c.meta.TotalSize > 0 {
+				size = uint64(c.meta.TotalSize)
+			}
+			if ok, reason := feedCfg.CheckSize(c.item.Item, size); !ok {
+				ctx.recordItemHistory(feedName, c.item, "excluded", reason, c.titleLabels)
+				ctx.Cache.AddSkippedItem(c.item)
+				continue
+			}
+		}
+		kept = append(kept, c)
 	}
+	candidates = kept
 
 	// Phase 3: Select highest-preference winner per identity key.
 	winners, skipped := selectWinners(candidates, feedCfg, ctx.Cache)
 	markSkippedSeen(skipped, ctx.Cache)
 	for _, s := range skipped {
-		ctx.recordHistory(feedName, s.cand.item.Item, "skipped", s.reason, s.cand.titleLabels)
+		ctx.recordItemHistory(feedName, s.cand.item, "skipped", s.reason, s.cand.titleLabels)
 	}
 
-	// Phase 4: Dispatch winners.
+	// Phase 4: Dispatch winners until the run's or the feed's budget is
+	// spent; the rest are deferred to a later run.
+	budget := cmd.budget
+	if budget == nil {
+		budget = newDispatchBudget(ctx.Config.MaxDispatchPerRun)
+	}
+	feedDispatched := 0
+	// pending is what this run holds back for Delay, and replaces the feed's
+	// pending set. A winner whose wait is over but which the budget defers
+	// keeps its entry, so its window does not start again. A backfill pass
+	// only replaces the entries of its own results.
+	var pending []PendingItem
+	keepPending := func(w *candidate, keys []string, firstSeen time.Time) {
+		pending = append(pending, PendingItem{Feed: feedName, GUID: w.item.Item.GUID, Keys: keys, FirstSeen: firstSeen, Item: w.item.Item})
+	}
 	for _, w := range winners {
+		if reason := applyBundlePolicy(feedCfg, w, ctx.Cache); reason != "" {
+			ctx.recordItemHistory(feedName, w.item, "skipped", reason, w.allLabels(feedCfg.Identity))
+			ctx.Cache.AddSkippedItem(w.item)
+			continue
+		}
 		covs := w.coverages(feedCfg.Identity)
 		keys := make([]string, len(covs))
 		for i, cov := range covs {
 			keys[i] = cov.identityKey
 		}
+		now := time.Now()
+		firstSeen, wasPending := ctx.Cache.PendingSince(feedName, w.item.Item.GUID, keys)
+		if !wasPending {
+			firstSeen = now
+		}
+		if until, held := holdUntil(feedCfg, w, firstSeen, now); held {
+			keepPending(w, keys, firstSeen)
+			ctx.recordItemHistory(feedName, w.item, waitingOutcome, "waiting until "+until.Format("2006-01-02 15:04"), w.allLabels(feedCfg.Identity))
+			continue
+		}
+		if reason := cmd.dispatchHold(ctx, feedCfg, w, now); reason != "" {
+			keepPending(w, keys, firstSeen)
+			ctx.recordItemHistory(feedName, w.item, "deferred", reason, w.allLabels(feedCfg.Identity))
+			continue
+		}
+		if !budget.allows() || (feedCfg.MaxDispatchPerRun > 0 && feedDispatched >= feedCfg.MaxDispatchPerRun) {
+			if wasPending {
+				keepPending(w, keys, firstSeen)
+			}
+			budget.deferItem(feedName)
+			ctx.recordItemHistory(feedName, w.item, "deferred", deferReasonBudget, w.allLabels(feedCfg.Identity))
+			continue
+		}
 		if cmd.dispatch(ctx, feedCfg, feedName, w, keys) {
-			return true
+			if cmd.quit {
+				return true
+			}
+			budget.used++
+			feedDispatched++
+		} else if w.heldForSpace {
+			keepPending(w, keys, firstSeen)
+		}
+	}
+	if cmd.backfill {
+		for _, p := range ctx.Cache.PendingItems(feedName) {
+			if !slices.ContainsFunc(rss.Items, func(item *gofeed.Item) bool { return item.GUID == p.GUID }) {
+				pending = append(pending, p)
+			}
 		}
 	}
+	ctx.Cache.SetPending(feedName, pending)
 	return false
 }
 
@@ -299,7 +546,7 @@ func (cmd *OnceCmd) processFeed(ctx *RunContext, feedName string, feedCfg Feed,
 func collectActiveGUIDs(feeds Feeds, cfgs []Feed) map[string]map[string]bool {
 	active := make(map[string]map[string]bool, len(cfgs))
 	for _, feedCfg := range cfgs {
-		rss := feeds[feedCfg.URL]
+		rss := feeds[feedCfg.FetchURL()]
 		if rss == nil {
 			active[feedCfg.Name] = nil
 			continue
@@ -313,6 +560,43 @@ func collectActiveGUIDs(feeds Feeds, cfgs []Feed) map[string]map[string]bool {
 	return active
 }
 
+// sharedValidators returns the validators to send when fetching fetchURL. A 304
+// skips every feed sharing the URL, so they are sent only when all of this
+// run's feeds on it were last processed against the same response.
+func (cmd *OnceCmd) sharedValidators(ctx *RunContext, fetchURL string) FeedValidators {
+	var shared FeedValidators
+	first := true
+	now := time.Now()
+	for _, feedCfg := range ctx.Config.Feeds {
+		if feedCfg.FetchURL() != fetchURL || !cmd.feedAllowed(feedCfg.Name) {
+			continue
+		}
+		if cmd.schedule != nil && !cmd.schedule.Due(&feedCfg, now) {
+			continue
+		}
+		if _, ok := ctx.Config.Extractors[feedCfg.Extractor]; !ok {
+			continue
+		}
+		v := ctx.Cache.FeedValidators(feedCfg.Name, fetchURL)
+		if first {
+			shared, first = v, false
+		} else if v != shared {
+			return FeedValidators{}
+		}
+	}
+	return shared
+}
+
+// anyDue reports whether the scheduler has an allowed feed due at now.
+func (cmd *OnceCmd) anyDue(feeds []Feed, now time.Time) bool {
+	for _, feedCfg := range feeds {
+		if cmd.feedAllowed(feedCfg.Name) && cmd.schedule.Due(&feedCfg, now) {
+			return true
+		}
+	}
+	return false
+}
+
 func (cmd *OnceCmd) Run(ctx *RunContext) error {
 	var err error
 
@@ -323,13 +607,30 @@ func (cmd *OnceCmd) Run(ctx *RunContext) error {
 		cmd.DownloadPath = os.Getenv("PWD")
 	}
 
-	// Cache gofeed results per URL so each RSS endpoint is fetched only once.
-	feeds := Feeds{}
+	// A scheduled run with nothing due returns before it touches the cache
+	// or history files, which is most of watch's wake-ups.
+	if cmd.schedule != nil && !cmd.anyDue(ctx.Config.Feeds, time.Now()) {
+		return nil
+	}
 
+	// Superseded torrents whose upgrade has completed since the last run
+	// can go now.
+	checkUpgrades(ctx)
+
+	// Work out which feeds this run processes, in config order.
+	type plannedFeed struct {
+		cfg       Feed
+		extractor *ExtractorSet
+		fetchURL  string
+	}
+	var planned []plannedFeed
 	for _, feedCfg := range ctx.Config.Feeds {
 		if !cmd.feedAllowed(feedCfg.Name) {
 			continue
 		}
+		if cmd.schedule != nil && !cmd.schedule.Due(&feedCfg, time.Now()) {
+			continue
+		}
 		if feedCfg.Extractor == "" {
 			log.Warnf("Feed %q has no Extractor configured, skipping", feedCfg.Name)
 			continue
@@ -339,24 +640,74 @@ func (cmd *OnceCmd) Run(ctx *RunContext) error {
 			log.Errorf("Feed %q references unknown Extractor %q, skipping", feedCfg.Name, feedCfg.Extractor)
 			continue
 		}
+		planned = append(planned, plannedFeed{cfg: feedCfg, extractor: extractor, fetchURL: feedCfg.FetchURL()})
+	}
 
-		// Fetch RSS (cached by URL).
-		if _, ok := feeds[feedCfg.URL]; !ok {
-			p := gofeed.NewParser()
-			start := time.Now()
-			if feeds[feedCfg.URL], err = p.ParseURL(feedCfg.URL); err != nil {
-				log.WithError(err).Warnf("Unable to process URL: %s", feedCfg.URL)
-				feeds[feedCfg.URL] = nil
-			}
-			log.Tracef("Fetched RSS %s in %s", feedCfg.URL, time.Since(start))
+	// Fetch each distinct URL once, concurrently. Feeds sharing a fetch URL
+	// share the fetch, so the first feed's HTTP profile is the one used.
+	var jobs []*feedFetch
+	jobByURL := map[string]*feedFetch{}
+	for _, p := range planned {
+		if _, ok := jobByURL[p.fetchURL]; ok {
+			continue
+		}
+		job := &feedFetch{feedCfg: p.cfg, fetchURL: p.fetchURL}
+		if until := ctx.Cache.BackoffUntil(p.cfg.URL); time.Now().Before(until) {
+			log.Debugf("Backing off %s until %s", p.cfg.URL, until.Format(time.RFC3339))
+			job.err = fmt.Errorf("rate limited, backing off until %s", until.Format(time.RFC3339))
+			job.done = true
+		} else {
+			job.validators = cmd.sharedValidators(ctx, p.fetchURL)
 		}
-		if feeds[feedCfg.URL] == nil {
+		jobs = append(jobs, job)
+		jobByURL[p.fetchURL] = job
+	}
+	cmd.pool = newFetchPool(ctx.Config.Fetch)
+	cmd.pool.Run(len(jobs), func(i int) string { return jobs[i].feedCfg.URL }, func(i int) {
+		jobs[i].fetch()
+	})
+	for _, job := range jobs {
+		if until, ok := isRateLimited(job.err); ok {
+			ctx.Cache.SetBackoff(job.feedCfg.URL, until)
+		}
+	}
+
+	// Process in config order, so history and dispatch order do not depend
+	// on which fetch finished first. feeds holds only the URLs this loop
+	// reached: a feed skipped by an interactive Quit is no evidence for
+	// pruning.
+	cmd.budget = newDispatchBudget(ctx.Config.MaxDispatchPerRun)
+	cmd.quit = false
+	cmd.txHashes = nil
+	feeds := Feeds{}
+	for _, p := range planned {
+		feedCfg := p.cfg
+		job := jobByURL[p.fetchURL]
+		feeds[p.fetchURL] = job.rss
+		if job.rss == nil {
+			if cmd.schedule != nil {
+				cmd.schedule.Fetched(&feedCfg, time.Now(), job.err)
+			}
 			continue
 		}
 
-		if cmd.processFeed(ctx, feedCfg.Name, feedCfg, feeds[feedCfg.URL], extractor) {
+		if cmd.processFeed(ctx, feedCfg.Name, feedCfg, job.rss, p.extractor) {
 			break
 		}
+		if cmd.schedule != nil {
+			cmd.schedule.Fetched(&feedCfg, time.Now(), nil)
+		}
+		// Items held back by Delay, and winners left over by the budget, are
+		// evaluated again at the next scheduled fetch, so that fetch must not
+		// be answered 304.
+		if cmd.budget.deferred[feedCfg.Name] > 0 || len(ctx.Cache.PendingItems(feedCfg.Name)) > 0 {
+			ctx.Cache.SetFeedValidators(feedCfg.Name, FeedValidators{})
+			continue
+		}
+		ctx.Cache.SetFeedValidators(feedCfg.Name, job.validators)
+	}
+	if n := cmd.budget.Deferred(); n > 0 {
+		log.Infof("Deferred %d item(s) to a later run: MaxDispatchPerRun reached", n)
 	}
 
 	activeGUIDs := collectActiveGUIDs(feeds, ctx.Config.Feeds)
@@ -377,22 +728,22 @@ func (cmd *OnceCmd) Run(ctx *RunContext) error {
 }
 
 // dispatch handles a single winner: submits it and records it in the cache.
-// Returns true if processing should stop for the rest of this run — either
-// because the item was actually dispatched (torrented or downloaded), or the
-// user selected Quit in interactive mode. NoAction, Skip, and error paths
-// never stop processing, since nothing was produced.
+// Returns true if the item was actually dispatched (torrented, downloaded or
+// notified), which counts against MaxDispatchPerRun, or the user selected Quit
+// in interactive mode, which also sets cmd.quit. NoAction, Skip, and error
+// paths return false, since nothing was produced.
 func (cmd *OnceCmd) dispatch(ctx *RunContext, feedCfg Feed, feedName string, w *candidate, keys []string) bool {
 	var err error
 	labels := w.allLabels(feedCfg.Identity)
 
 	if cmd.NoAction {
 		log.Infof("%s match: %s", feedName, w.item.Item.Title)
-		ctx.recordHistory(feedName, w.item.Item, "skipped", "no-action mode", labels)
+		ctx.recordItemHistory(feedName, w.item, "skipped", "no-action mode", labels)
 		return false
 	}
 	if cmd.Skip {
 		ctx.Cache.AddItem(w.item, labels, keys)
-		ctx.recordHistory(feedName, w.item.Item, "skipped", "user skip", labels)
+		ctx.recordItemHistory(feedName, w.item, "skipped", "user skip", labels)
 		return false
 	}
 	if cmd.Interactive {
@@ -402,42 +753,52 @@ func (cmd *OnceCmd) dispatch(ctx *RunContext, feedCfg Feed, feedName string, w *
 	if cmd.Download {
 		if _, err = w.item.Download(ctx, cmd.DownloadPath, cmd.TorrentCacheDir); err != nil {
 			log.WithError(err).Errorf("Unable to download: %s", w.item.Item.Title)
-			ctx.recordHistory(feedName, w.item.Item, "error", err.Error(), labels)
+			ctx.recordItemHistory(feedName, w.item, "error", err.Error(), labels)
 			return false
 		}
-		ctx.recordHistory(feedName, w.item.Item, "downloaded", "", labels)
+		ctx.recordItemHistory(feedName, w.item, "downloaded", "", labels)
 	} else if feedCfg.Action == "notify" {
 		meta := CancelMetadata{
 			Title:     w.item.Item.Title,
 			FeedName:  feedName,
 			Labels:    labels,
 			Files:     w.fileNames,
-			SizeBytes: extractSize(w.item.Item),
+			SizeBytes: w.item.Size(),
 		}
 		sendNtfySeen(ctx, feedName, w.item.Item.GUID, meta, w.item.Item)
-		ctx.recordHistory(feedName, w.item.Item, "notified", "", labels)
+		ctx.recordItemHistory(feedName, w.item, "notified", "", labels)
 	} else {
-		torrentBytes, err := ensureTorrentBytes(w.item, cmd.TorrentCacheDir, w.torrentBytes)
+		if cmd.skipAlreadyHave(ctx, feedName, w, labels, keys) {
+			return false
+		}
+		files := selectFiles(feedCfg, w)
+		opts, err := feedCfg.addOptions(feedName, w.item.Item, labels)
 		if err != nil {
-			log.WithError(err).Errorf("Unable to fetch torrent data for %s", w.item.Item.Title)
-			ctx.recordHistory(feedName, w.item.Item, "error", err.Error(), labels)
+			log.WithError(err).Errorf("Unable to torrent: %s", w.item.Item.Title)
+			ctx.recordItemHistory(feedName, w.item, "error", err.Error(), labels)
+			return false
+		}
+		opts.Settings = feedCfg.torrentSettings(coverageLabels(w.coverages(feedCfg.Identity)))
+		if holdForSpace(ctx, feedName, w, opts.Dir, files, labels) {
 			return false
 		}
-		torrentID, err := w.item.TorrentWithBytes(ctx, feedCfg.DownloadPath, torrentBytes)
+		torrentID, _, err := submitItem(ctx, w.item, opts, cmd.TorrentCacheDir, w.torrentBytes, files)
 		if err != nil {
 			log.WithError(err).Errorf("Unable to torrent: %s", feedName)
-			ctx.recordHistory(feedName, w.item.Item, "error", err.Error(), labels)
+			ctx.recordItemHistory(feedName, w.item, "error", err.Error(), labels)
 			return false
 		}
 		meta := CancelMetadata{
-			Title:     w.item.Item.Title,
-			FeedName:  feedName,
-			Labels:    labels,
-			Files:     w.fileNames,
-			SizeBytes: extractSize(w.item.Item),
+			Title:        w.item.Item.Title,
+			FeedName:     feedName,
+			Labels:       labels,
+			Files:        w.fileNames,
+			SkippedFiles: files.UnwantedPath,
+			SizeBytes:    w.item.Size(),
 		}
 		sendNtfyStarted(ctx, feedCfg, torrentID, meta, w.item.Item)
-		ctx.recordHistory(feedName, w.item.Item, "dispatched", "", labels)
+		queueUpgrade(ctx, feedCfg, feedName, w)
+		ctx.recordDispatched(feedName, w, files, labels)
 	}
 	ctx.Cache.AddItem(w.item, labels, keys)
 	return true
@@ -446,13 +807,14 @@ func (cmd *OnceCmd) dispatch(ctx *RunContext, feedCfg Feed, feedName string, w *
 // retryHistoryItem re-submits a previously skipped/excluded/error history
 // record to Transmission. Unlike dispatch(), which works from a freshly
 // extracted candidate, this fetches the .torrent fresh from rec.TorrentURL
-// since the original bytes are never persisted to history. Cache and history
+// since the original bytes are never persisted to history, and falls back to
+// rec.MagnetURI when there is no .torrent to be had. Cache and history
 // updates here are in-memory only (via AddItem/recordHistory) — persistence to
 // disk is left to the next scheduled once.Run() tick, same as every other
 // mutation dispatch() makes mid-run.
 func retryHistoryItem(ctx *RunContext, rec HistoryRecord) (int64, error) {
-	if rec.TorrentURL == "" {
-		return 0, fmt.Errorf("no torrent URL recorded for %q", rec.Title)
+	if rec.TorrentURL == "" && rec.MagnetURI == "" {
+		return 0, fmt.Errorf("no torrent URL or magnet link recorded for %q", rec.Title)
 	}
 	if rec.Outcome == "dispatched" || rec.Outcome == "downloaded" {
 		return 0, fmt.Errorf("%q was already %s", rec.Title, rec.Outcome)
@@ -462,21 +824,46 @@ func retryHistoryItem(ctx *RunContext, rec HistoryRecord) (int64, error) {
 		return 0, fmt.Errorf("feed %q is no longer configured", rec.Feed)
 	}
 
-	torrentBytes, err := fetchTorrentBytes(rec.TorrentURL)
-	if err != nil {
-		return 0, fmt.Errorf("unable to fetch torrent data for %q: %w", rec.Title, err)
-	}
-
+	// The enclosures are rebuilt from the record so the retried item finds
+	// its .torrent and magnet the same way a live feed item does, and so the
+	// dispatched history record keeps both for next time.
 	item := &gofeed.Item{Title: rec.Title, GUID: rec.GUID}
 	if !rec.Published.IsZero() {
 		item.PublishedParsed = &rec.Published
 	}
-	fi := &FeedItem{Feed: rec.Feed, Item: item}
+	var length string
+	if rec.SizeBytes > 0 {
+		length = strconv.FormatInt(rec.SizeBytes, 10)
+	}
+	if rec.TorrentURL != "" {
+		item.Enclosures = append(item.Enclosures,
+			&gofeed.Enclosure{URL: rec.TorrentURL, Type: "application/x-bittorrent", Length: length})
+	}
+	if rec.MagnetURI != "" {
+		item.Enclosures = append(item.Enclosures,
+			&gofeed.Enclosure{URL: rec.MagnetURI, Type: "application/x-bittorrent", Length: length})
+	}
+	fi := &FeedItem{Feed: rec.Feed, Item: item, client: feedCfg.Client()}
 
-	torrentID, err := fi.TorrentWithBytes(ctx, feedCfg.DownloadPath, torrentBytes)
+	opts, err := feedCfg.addOptions(rec.Feed, item, rec.Labels)
 	if err != nil {
 		return 0, fmt.Errorf("unable to torrent %q: %w", rec.Title, err)
 	}
+	opts.Settings = feedCfg.torrentSettings([]map[string]string{rec.Labels})
+	if short, err := checkDiskSpace(ctx, opts.Dir, fi.Size()); err != nil {
+		log.WithError(err).Warnf("%s: unable to check the free space for %s, adding it anyway", rec.Feed, rec.Title)
+	} else if short != nil {
+		return 0, fmt.Errorf("unable to torrent %q: %s", rec.Title, short.reason())
+	}
+	torrentID, torrentBytes, err := submitItem(ctx, fi, opts, "", nil, fileSelection{})
+	if err != nil {
+		return 0, fmt.Errorf("unable to torrent %q: %w", rec.Title, err)
+	}
+	var fileNames []string
+	if torrentMeta, err := ParseMetaInfo(torrentBytes); err == nil {
+		fi.meta = torrentMeta
+		fileNames = torrentMeta.FileNames()
+	}
 
 	// A bundle candidate can cover several identity keys at once (see
 	// candidate.coverages), but history only ever persists the single merged
@@ -487,25 +874,23 @@ func retryHistoryItem(ctx *RunContext, rec HistoryRecord) (int64, error) {
 	}
 	ctx.Cache.AddItem(fi, rec.Labels, keys)
 
-	fileNames, _ := TorrentFileNames(torrentBytes)
 	meta := CancelMetadata{
 		Title:     rec.Title,
 		FeedName:  rec.Feed,
 		Labels:    rec.Labels,
 		Files:     fileNames,
-		SizeBytes: rec.SizeBytes,
+		SizeBytes: fi.Size(),
 	}
 	sendNtfyStarted(ctx, feedCfg, torrentID, meta, item)
 
-	ctx.recordHistory(rec.Feed, item, "dispatched", "", rec.Labels)
+	ctx.recordItemHistory(rec.Feed, fi, "dispatched", "", rec.Labels)
 
 	return torrentID, nil
 }
 
 // dispatchInteractive prompts the user for what to do with a winner. Returns
-// true if processing should stop for the rest of this run — either because
-// the item was actually dispatched (torrented or downloaded), or the user
-// selected Quit.
+// true if the item was actually dispatched (torrented or downloaded), or the
+// user selected Quit, which also sets cmd.quit.
 func (cmd *OnceCmd) dispatchInteractive(ctx *RunContext, feedCfg Feed, feedName string, w *candidate, keys []string) bool {
 	var err error
 	labels := w.allLabels(feedCfg.Identity)
@@ -514,36 +899,53 @@ func (cmd *OnceCmd) dispatchInteractive(ctx *RunContext, feedCfg Feed, feedName
 	case Download:
 		if _, err = w.item.Download(ctx, cmd.DownloadPath, cmd.TorrentCacheDir); err != nil {
 			log.WithError(err).Errorf("Unable to download: %s", w.item.Item.Title)
-			ctx.recordHistory(feedName, w.item.Item, "error", err.Error(), labels)
+			ctx.recordItemHistory(feedName, w.item, "error", err.Error(), labels)
 			return false
 		}
 		ctx.Cache.AddItem(w.item, labels, keys)
-		ctx.recordHistory(feedName, w.item.Item, "downloaded", "", labels)
+		ctx.recordItemHistory(feedName, w.item, "downloaded", "", labels)
 		return true
 	case Torrent:
-		torrentID, err := w.item.TorrentWithBytes(ctx, feedCfg.DownloadPath, w.torrentBytes)
+		if cmd.skipAlreadyHave(ctx, feedName, w, labels, keys) {
+			return false
+		}
+		files := selectFiles(feedCfg, w)
+		opts, err := feedCfg.addOptions(feedName, w.item.Item, labels)
+		if err != nil {
+			log.WithError(err).Errorf("Unable to torrent: %s", w.item.Item.Title)
+			ctx.recordItemHistory(feedName, w.item, "error", err.Error(), labels)
+			return false
+		}
+		opts.Settings = feedCfg.torrentSettings(coverageLabels(w.coverages(feedCfg.Identity)))
+		if holdForSpace(ctx, feedName, w, opts.Dir, files, labels) {
+			return false
+		}
+		torrentID, _, err := submitItem(ctx, w.item, opts, cmd.TorrentCacheDir, w.torrentBytes, files)
 		if err != nil {
 			log.WithError(err).Errorf("Unable to torrent: %s", feedName)
-			ctx.recordHistory(feedName, w.item.Item, "error", err.Error(), labels)
+			ctx.recordItemHistory(feedName, w.item, "error", err.Error(), labels)
 			return false
 		}
 		meta := CancelMetadata{
-			Title:     w.item.Item.Title,
-			FeedName:  feedName,
-			Labels:    labels,
-			Files:     w.fileNames,
-			SizeBytes: extractSize(w.item.Item),
+			Title:        w.item.Item.Title,
+			FeedName:     feedName,
+			Labels:       labels,
+			Files:        w.fileNames,
+			SkippedFiles: files.UnwantedPath,
+			SizeBytes:    w.item.Size(),
 		}
 		sendNtfyStarted(ctx, feedCfg, torrentID, meta, w.item.Item)
+		queueUpgrade(ctx, feedCfg, feedName, w)
 		ctx.Cache.AddItem(w.item, labels, keys)
-		ctx.recordHistory(feedName, w.item.Item, "dispatched", "", labels)
+		ctx.recordDispatched(feedName, w, files, labels)
 		return true
 	case Skip:
 		ctx.Cache.AddItem(w.item, labels, keys)
-		ctx.recordHistory(feedName, w.item.Item, "skipped", "user skip", labels)
+		ctx.recordItemHistory(feedName, w.item, "skipped", "user skip", labels)
 	case SkipOnce:
 		// don't add to cache
 	case Quit:
+		cmd.quit = true
 		return true
 	default:
 		log.Errorf("Unknown reply")
@@ -551,6 +953,25 @@ func (cmd *OnceCmd) dispatchInteractive(ctx *RunContext, feedCfg Feed, feedName
 	return false
 }
 
+// submitItem adds item to Transmission with opts, from its .torrent when one
+// can be had and from its magnet link otherwise, which leaves files nothing
+// to select from. It returns the .torrent bytes it used, which are empty for a magnet,
+// so the caller can list file names when there are any.
+func submitItem(ctx *RunContext, item *FeedItem, opts addOptions, cacheDir string, existing []byte, files fileSelection) (int64, []byte, error) {
+	torrentBytes, err := ensureTorrentBytes(item, cacheDir, existing)
+	if err != nil {
+		magnet, ok := item.MagnetURI()
+		if !ok {
+			return 0, nil, fmt.Errorf("unable to fetch torrent data: %w", err)
+		}
+		log.WithError(err).Debugf("No .torrent for %s, submitting its magnet link", item.Item.Title)
+		torrentID, err := item.TorrentWithMagnet(ctx, opts, magnet)
+		return torrentID, nil, err
+	}
+	torrentID, err := item.TorrentWithBytes(ctx, opts, torrentBytes, files)
+	return torrentID, torrentBytes, err
+}
+
 // ensureTorrentBytes returns existing if non-empty; otherwise fetches via getTorrentContents.
 // This prevents dispatch failures when Phase 2 couldn't fetch the torrent at selection time.
 func ensureTorrentBytes(item *FeedItem, cacheDir string, existing []byte) ([]byte, error) {
@@ -591,16 +1012,26 @@ type skippedCandidate struct {
 
 // selectWinners returns winners and skipped candidates with reasons. For each
 // identity key, the highest-preference candidate that beats the cache wins.
-// A candidate winning on multiple keys appears once in winners.
+// A candidate winning on multiple keys appears once in winners. The stable
+// pseudo-labels Prefer asks for are added to each candidate's title labels
+// first, so they are ranked here and kept with the labels in the seen cache.
+// The volatile ones only rank the candidates against each other: the rank
+// checked against the cache leaves them out, as the cache does.
 func selectWinners(candidates []*candidate, feedCfg Feed, cache *CacheFile) ([]*candidate, []skippedCandidate) {
 	type entry struct {
-		cand *candidate
-		rank []int
+		cand      *candidate
+		rank      []int
+		cacheRank []int
 	}
 	best := map[string]*entry{}
 	matchedCands := map[*candidate]bool{}
 
 	for _, c := range candidates {
+		stable, volatile := preferPseudoLabels(feedCfg.Prefer, c.item)
+		if stable != nil {
+			c.titleLabels = MergeLabels(c.titleLabels, stable)
+		}
+		c.volatile = volatile
 		covs := c.coverages(feedCfg.Identity)
 		for _, g := range feedCfg.Groups {
 			for _, cov := range covs {
@@ -608,9 +1039,9 @@ func selectWinners(candidates []*candidate, feedCfg Feed, cache *CacheFile) ([]*
 					continue
 				}
 				matchedCands[c] = true
-				rank := PreferenceRank(cov.labels, feedCfg.Prefer)
+				rank := PreferenceRank(c.rankLabels(cov.labels), feedCfg.Prefer)
 				if e, ok := best[cov.identityKey]; !ok || IsBetter(rank, e.rank) {
-					best[cov.identityKey] = &entry{cand: c, rank: rank}
+					best[cov.identityKey] = &entry{cand: c, rank: rank, cacheRank: PreferenceRank(cov.labels, feedCfg.Prefer)}
 				}
 			}
 		}
@@ -633,11 +1064,10 @@ func selectWinners(candidates []*candidate, feedCfg Feed, cache *CacheFile) ([]*
 	seen := map[*candidate]bool{}
 	var winners []*candidate
 	for key, e := range best {
-		cachedRank, cached := cache.BestRankForKey(key, feedCfg.Prefer)
-		if cached && !IsBetter(e.rank, cachedRank) {
-			log.Debugf("Skipping %s for key %s: cache has equal or better preference", e.cand.item.Item.Title, key)
+		if reason := cacheBlocks(feedCfg, cache, key, e.cacheRank); reason != "" {
+			log.Debugf("Skipping %s for key %s: %s", e.cand.item.Item.Title, key, reason)
 			if !seen[e.cand] {
-				skipReasons[e.cand] = skipReasonCacheBetter
+				skipReasons[e.cand] = reason
 			}
 			continue
 		}
@@ -671,6 +1101,14 @@ func selectWinners(candidates []*candidate, feedCfg Feed, cache *CacheFile) ([]*
 		}
 	}
 
+	// best is a map, so put the winners back in feed order: dispatch, and
+	// which winners a spent budget defers, must not vary from run to run.
+	order := make(map[*candidate]int, len(candidates))
+	for i, c := range candidates {
+		order[c] = i
+	}
+	slices.SortFunc(winners, func(a, b *candidate) int { return order[a] - order[b] })
+
 	var skipped []skippedCandidate
 	for _, c := range candidates {
 		if reason, ok := skipReasons[c]; ok {
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"crypto/sha1" //nolint:gosec
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -14,6 +16,7 @@ import (
 
 	"github.com/hekmon/transmissionrpc/v3"
 	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -554,6 +557,76 @@ func fakeTransmissionServer(t *testing.T) *httptest.Server {
 	}))
 }
 
+// recordingTransmissionServer is fakeTransmissionServer that also hands every
+// torrent-add's arguments to record.
+func recordingTransmissionServer(t *testing.T, record func(args map[string]any)) *httptest.Server {
+	t.Helper()
+	const sessionID = "test-session-id"
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Transmission-Session-Id") != sessionID {
+			w.Header().Set("X-Transmission-Session-Id", sessionID)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		var req struct {
+			Method    string         `json:"method"`
+			Arguments map[string]any `json:"arguments"`
+			Tag       int            `json:"tag"`
+		}
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &req))
+		if req.Method == "torrent-add" {
+			record(req.Arguments)
+		}
+
+		resp := map[string]any{
+			"result": "success",
+			"tag":    req.Tag,
+			"arguments": map[string]any{
+				"torrent-added": map[string]any{"id": 1},
+			},
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+}
+
+func TestDispatch_MagnetOnlyItem_SubmitsMagnet(t *testing.T) {
+	var added map[string]any
+	srv := recordingTransmissionServer(t, func(args map[string]any) { added = args })
+	defer srv.Close()
+	endpoint, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	client, err := transmissionrpc.New(endpoint, nil)
+	require.NoError(t, err)
+
+	magnet := "magnet:?xt=urn:btih:" + testInfoHash + "&dn=MotoGP.RD01.Race"
+	c := makeCandidate("guid1", map[string]string{"series": "MotoGP", "round": "RD01", "session": "Race"}, nil)
+	c.item.Item.Link = magnet
+	feedCfg := makeFeed([]string{"series", "round", "session"}, nil, nil)
+	keys := []string{"series=MotoGP|round=RD01|session=Race"}
+
+	ctx := &RunContext{
+		Cache:        emptyCache(),
+		History:      &HistoryFile{guidIndex: map[string]int{}},
+		transmission: client,
+	}
+	stop := (&OnceCmd{}).dispatch(ctx, feedCfg, "testfeed", c, keys)
+
+	assert.True(t, stop)
+	require.NotNil(t, added)
+	assert.Equal(t, magnet, added["filename"], "a magnet is submitted as the torrent-add filename")
+	assert.Nil(t, added["metainfo"])
+
+	require.Len(t, ctx.Cache.Seen, 1)
+	assert.Equal(t, testInfoHash, ctx.Cache.Seen[0].InfoHash)
+	records := ctx.History.GetRecords()
+	require.Len(t, records, 1)
+	assert.Equal(t, "dispatched", records[0].Outcome)
+	assert.Equal(t, magnet, records[0].MagnetURI)
+	assert.Equal(t, testInfoHash, records[0].InfoHash)
+}
+
 func TestDispatch_NoAction_DoesNotStopProcessing(t *testing.T) {
 	c := makeCandidate("guid1", map[string]string{"series": "MotoGP", "round": "RD01", "session": "Race"}, nil)
 	feedCfg := makeFeed([]string{"series", "round", "session"}, nil, nil)
@@ -773,6 +846,47 @@ func TestRetryHistoryItem_Success(t *testing.T) {
 	assert.Equal(t, "dispatched", updated.Outcome)
 }
 
+func TestRetryHistoryItem_FromStoredMagnet(t *testing.T) {
+	var added map[string]any
+	srv := recordingTransmissionServer(t, func(args map[string]any) { added = args })
+	defer srv.Close()
+	endpoint, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	client, err := transmissionrpc.New(endpoint, nil)
+	require.NoError(t, err)
+
+	feedCfg := makeFeed([]string{"series", "round", "session"}, nil, nil)
+	feedCfg.Name = "testfeed"
+
+	ctx := &RunContext{
+		Cache:        emptyCache(),
+		History:      &HistoryFile{guidIndex: map[string]int{}},
+		transmission: client,
+		Config:       Config{Feeds: []Feed{feedCfg}},
+	}
+	magnet := "magnet:?xt=urn:btih:" + testInfoHash
+	rec := HistoryRecord{
+		Feed:      "testfeed",
+		Title:     "guid1",
+		GUID:      "guid1",
+		Outcome:   "notified",
+		Labels:    map[string]string{"series": "MotoGP", "round": "RD01", "session": "Race"},
+		MagnetURI: magnet,
+	}
+
+	torrentID, err := retryHistoryItem(ctx, rec)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, torrentID)
+	assert.Equal(t, magnet, added["filename"])
+
+	require.Len(t, ctx.Cache.Seen, 1)
+	assert.Equal(t, testInfoHash, ctx.Cache.Seen[0].InfoHash)
+	updated, ok := ctx.History.FindRecord("testfeed", "guid1")
+	require.True(t, ok)
+	assert.Equal(t, "dispatched", updated.Outcome)
+	assert.Equal(t, magnet, updated.MagnetURI, "the dispatched record keeps the magnet for next time")
+}
+
 func TestRetryHistoryItem_NoTorrentURL(t *testing.T) {
 	ctx := &RunContext{Cache: emptyCache(), History: &HistoryFile{guidIndex: map[string]int{}}}
 	rec := HistoryRecord{Feed: "testfeed", GUID: "guid1", Outcome: "skipped"}
@@ -941,6 +1055,86 @@ func TestSelectWinners_PicksHighestPreference(t *testing.T) {
 	}
 }
 
+// Pseudo-labels rank on what the item says about itself rather than its
+// title. $feed is kept in the winner's labels for the seen cache; $seeders
+// changes from fetch to fetch, so it is kept apart.
+func TestSelectWinners_PseudoLabels(t *testing.T) {
+	labels := map[string]string{"series": "MotoGP", "round": "RD01", "session": "Race", "resolution": "1080p"}
+	withSeeders := func(guid, feed, seeders string) *candidate {
+		c := makeCandidate(guid, labels, nil)
+		c.item.Feed = feed
+		c.item.Item.Extensions = ext.Extensions{"torznab": {"attr": {
+			{Name: "attr", Attrs: map[string]string{"name": "seeders", "value": seeders}},
+		}}}
+		return c
+	}
+	few := withSeeders("few", "TrackerA", "3")
+	many := withSeeders("many", "TrackerA", "250")
+	other := withSeeders("other", "TrackerB", "900")
+
+	feed := makeFeed(
+		[]string{"series", "round", "session"},
+		[]PreferDimension{
+			{Label: "resolution", Order: []string{"1080p", "720p"}},
+			{Label: PseudoLabelFeed, Order: []string{"TrackerA", "TrackerB"}},
+			{Label: PseudoLabelSeeders, Direction: PreferHigher},
+		},
+		[]Group{{Require: map[string][]string{"series": {"MotoGP"}}}},
+	)
+	winners, _ := selectWinners([]*candidate{few, other, many}, feed, emptyCache())
+	require.Len(t, winners, 1)
+	assert.Equal(t, "many", winners[0].item.Item.GUID, "TrackerA first, then the most seeders")
+	assert.NotContains(t, winners[0].titleLabels, PseudoLabelSeeders)
+	assert.Equal(t, map[string]string{PseudoLabelSeeders: "250"}, winners[0].volatile)
+	assert.Equal(t, "TrackerA", winners[0].titleLabels[PseudoLabelFeed])
+	assert.NotContains(t, winners[0].titleLabels, PseudoLabelSize, "only pseudo-labels Prefer uses are added")
+	assert.NotContains(t, labels, PseudoLabelFeed, "the shared title labels must not be modified")
+}
+
+// A release seen again with more seeders, or republished, does not beat the
+// cached copy of itself: volatile pseudo-labels are not compared against the
+// cache.
+func TestSelectWinners_VolatilePseudoLabelsSkipCache(t *testing.T) {
+	labels := map[string]string{"series": "MotoGP", "round": "RD01", "session": "Race", "resolution": "1080p"}
+	feed := makeFeed(
+		[]string{"series", "round", "session"},
+		[]PreferDimension{
+			{Label: "resolution", Order: []string{"1080p", "720p"}},
+			{Label: PseudoLabelSeeders, Direction: PreferHigher},
+			{Label: PseudoLabelPublished, Direction: PreferHigher},
+		},
+		[]Group{{Require: map[string][]string{"series": {"MotoGP"}}}},
+	)
+	c := makeCandidate("rd01", labels, nil)
+	c.item.Item.Extensions = ext.Extensions{"torznab": {"attr": {
+		{Name: "attr", Attrs: map[string]string{"name": "seeders", "value": "10"}},
+	}}}
+	published := time.Now()
+	c.item.Item.PublishedParsed = &published
+
+	cache := emptyCache()
+	winners, _ := selectWinners([]*candidate{c}, feed, cache)
+	require.Len(t, winners, 1)
+	var keys []string
+	for _, cov := range winners[0].coverages(feed.Identity) {
+		keys = append(keys, cov.identityKey)
+	}
+	cache.AddItem(winners[0].item, winners[0].allLabels(feed.Identity), keys)
+	assert.NotContains(t, cache.Seen[0].Labels, PseudoLabelSeeders)
+	assert.NotContains(t, cache.Seen[0].Labels, PseudoLabelPublished)
+
+	again := makeCandidate("rd01-again", labels, nil)
+	again.item.Item.Extensions = ext.Extensions{"torznab": {"attr": {
+		{Name: "attr", Attrs: map[string]string{"name": "seeders", "value": "500"}},
+	}}}
+	later := published.Add(time.Hour)
+	again.item.Item.PublishedParsed = &later
+	winners, skipped := selectWinners([]*candidate{again}, feed, cache)
+	assert.Empty(t, winners)
+	require.Len(t, skipped, 1)
+	assert.Equal(t, skipReasonCacheBetter, skipped[0].reason)
+}
+
 func TestSelectWinners_GroupFilter(t *testing.T) {
 	c := makeCandidate("guid1",
 		map[string]string{"series": "WorldSBK", "round": "RD01", "session": "Race"},
@@ -1282,3 +1476,187 @@ func TestPruneTorrentCache(t *testing.T) {
 		t.Error("old file should have been deleted but still exists")
 	}
 }
+
+// --- MaxDispatchPerRun ---
+
+// budgetRun processes one feed of magnet-only items, one per round, against a
+// recording Transmission, and returns how many were added.
+func budgetRun(t *testing.T, ctx *RunContext, cmd *OnceCmd, feedCfg Feed, rounds ...string) int {
+	t.Helper()
+	added := 0
+	srv := recordingTransmissionServer(t, func(map[string]any) { added++ })
+	t.Cleanup(srv.Close)
+	endpoint, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	ctx.transmission, err = transmissionrpc.New(endpoint, nil)
+	require.NoError(t, err)
+
+	// Each item gets its own infohash, so none is taken for another's copy.
+	rss := &gofeed.Feed{}
+	for _, round := range rounds {
+		hash := fmt.Sprintf("%x", sha1.Sum([]byte(feedCfg.Name+round))) //nolint:gosec
+		rss.Items = append(rss.Items, &gofeed.Item{
+			Title: "MotoGP." + round + ".Race",
+			GUID:  feedCfg.Name + "-" + round,
+			Link:  "magnet:?xt=urn:btih:" + hash + "&dn=" + round,
+		})
+	}
+	extractor := &ExtractorSet{Labels: map[string]LabelDef{"round": {Regexp: `(RD\d+)`}}}
+	cmd.processFeed(ctx, feedCfg.Name, feedCfg, rss, extractor)
+	return added
+}
+
+func budgetFeed(name string, max int) Feed {
+	return Feed{
+		Name: name, Identity: []string{"round"}, MaxDispatchPerRun: max,
+		Groups: []Group{{Require: map[string][]string{}}},
+	}
+}
+
+func outcomesByGUID(h *HistoryFile) map[string]string {
+	out := map[string]string{}
+	for _, r := range h.GetRecords() {
+		out[r.GUID] = r.Outcome
+	}
+	return out
+}
+
+func TestProcessFeed_GlobalBudgetDefersTheRest(t *testing.T) {
+	ctx := &RunContext{
+		Config:  Config{MaxDispatchPerRun: 2},
+		Cache:   emptyCache(),
+		History: &HistoryFile{guidIndex: map[string]int{}},
+	}
+	cmd := &OnceCmd{}
+	cmd.budget = newDispatchBudget(ctx.Config.MaxDispatchPerRun)
+
+	added := budgetRun(t, ctx, cmd, budgetFeed("F", 0), "RD01", "RD02", "RD03")
+
+	assert.Equal(t, 2, added)
+	assert.Equal(t, 1, cmd.budget.Deferred())
+	outcomes := outcomesByGUID(ctx.History)
+	assert.Equal(t, "deferred", outcomes["F-RD03"])
+	assert.Len(t, ctx.Cache.Seen, 2, "a deferred item is not cached, so a later run picks it up")
+
+	// The next feed in the same run has no budget left.
+	added = budgetRun(t, ctx, cmd, budgetFeed("G", 0), "RD04")
+	assert.Zero(t, added)
+	assert.Equal(t, 2, cmd.budget.Deferred())
+}
+
+func TestProcessFeed_PerFeedBudget(t *testing.T) {
+	ctx := &RunContext{
+		Cache:   emptyCache(),
+		History: &HistoryFile{guidIndex: map[string]int{}},
+	}
+	cmd := &OnceCmd{}
+	cmd.budget = newDispatchBudget(0)
+
+	assert.Equal(t, 1, budgetRun(t, ctx, cmd, budgetFeed("F", 1), "RD01", "RD02"))
+	assert.Equal(t, 2, budgetRun(t, ctx, cmd, budgetFeed("G", 0), "RD03", "RD04"),
+		"the global budget is unlimited and G has no cap of its own")
+	assert.Equal(t, map[string]int{"F": 1}, cmd.budget.deferred)
+}
+
+// A later outcome replaces a deferred record, whatever it is.
+func TestHistory_DeferredIsReplaced(t *testing.T) {
+	h := &HistoryFile{guidIndex: map[string]int{}}
+	item := &gofeed.Item{Title: "t", GUID: "g"}
+	h.AddOrUpdateRecord(NewHistoryRecord("F", item, "deferred", deferReasonBudget, nil))
+	h.AddOrUpdateRecord(NewHistoryRecord("F", item, "skipped", "covered by winner", nil))
+	assert.Equal(t, "skipped", h.GetRecords()[0].Outcome)
+
+	h.AddOrUpdateRecord(NewHistoryRecord("F", item, "deferred", deferReasonBudget, nil))
+	assert.Equal(t, "skipped", h.GetRecords()[0].Outcome, "a deferral never replaces a real outcome")
+}
+
+// --- size checks against the .torrent's own total ---
+
+// An enclosure length is only the feed's guess: once the .torrent is fetched,
+// MinSize/MaxSize are checked against its real total, and its infohash is
+// recorded in the cache and history.
+func TestProcessFeed_SizeCheckUsesTorrentTotal(t *testing.T) {
+	torrentSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/big.torrent" {
+			_, _ = w.Write(buildSingleFileTorrent("RD02.mkv"))
+			return
+		}
+		_, _ = w.Write(buildMultiFileTorrent("RD01", [][]string{{"a.mkv"}, {"b.mkv"}, {"c.mkv"}}))
+	}))
+	defer torrentSrv.Close()
+
+	item := func(round, path string) *gofeed.Item {
+		return &gofeed.Item{
+			Title: "MotoGP." + round + ".Race",
+			GUID:  round,
+			Enclosures: []*gofeed.Enclosure{
+				{URL: torrentSrv.URL + path, Type: "application/x-bittorrent", Length: "10"},
+			},
+		}
+	}
+	rss := &gofeed.Feed{Items: []*gofeed.Item{item("RD01", "/small.torrent"), item("RD02", "/big.torrent")}}
+	feedCfg := Feed{
+		Name: "F", Identity: []string{"round"}, MinSize: "2KB", MaxSize: "500KB",
+		Groups: []Group{{Require: map[string][]string{}}},
+	}
+	extractor := &ExtractorSet{Labels: map[string]LabelDef{"round": {Regexp: `(RD\d+)`}}}
+	ctx := &RunContext{Cache: emptyCache(), History: &HistoryFile{guidIndex: map[string]int{}}}
+	cmd := &OnceCmd{Skip: true, TorrentCacheDir: t.TempDir()}
+
+	cmd.processFeed(ctx, "F", feedCfg, rss, extractor)
+
+	records := map[string]HistoryRecord{}
+	for _, r := range ctx.History.GetRecords() {
+		records[r.GUID] = r
+	}
+	require.Len(t, records, 2)
+	assert.Equal(t, "skipped", records["RD01"].Outcome, "the 3000 byte torrent passes MinSize despite its 10 byte enclosure")
+	assert.Equal(t, int64(3000), records["RD01"].SizeBytes)
+	assert.Equal(t, "excluded", records["RD02"].Outcome)
+	assert.Equal(t, "above maximum size", records["RD02"].Reason)
+
+	meta, err := ParseMetaInfo(buildMultiFileTorrent("RD01", [][]string{{"a.mkv"}, {"b.mkv"}, {"c.mkv"}}))
+	require.NoError(t, err)
+	assert.Equal(t, meta.InfoHash, records["RD01"].InfoHash)
+	var cached string
+	for _, s := range ctx.Cache.Seen {
+		if s.GUID == "RD01" {
+			cached = s.InfoHash
+		}
+	}
+	assert.Equal(t, meta.InfoHash, cached)
+}
+
+// Winners come back in feed order however selectWinners' map iterates, so a
+// spent budget always defers the same ones.
+func TestSelectWinners_FeedOrder(t *testing.T) {
+	feedCfg := makeFeed([]string{"round"}, nil, []Group{{Require: map[string][]string{}}})
+	var candidates []*candidate
+	for _, round := range []string{"RD05", "RD01", "RD09", "RD03", "RD07"} {
+		candidates = append(candidates, makeCandidate(round, map[string]string{"round": round}, nil))
+	}
+	for i := 0; i < 10; i++ {
+		winners, _ := selectWinners(candidates, feedCfg, emptyCache())
+		assert.Equal(t, candidates, winners)
+	}
+}
+
+// Labels sourced from the .torrent's comment join the title labels once the
+// .torrent is in, and path labels see each file's directory.
+func TestCandidate_ExtractFileLabels_CommentAndPath(t *testing.T) {
+	extractor := &ExtractorSet{Labels: map[string]LabelDef{
+		"class":      {Regexp: `(MotoGP|Moto2)`},
+		"round":      {Regexp: `^(RD\d+)/`, Source: SourcePath},
+		"resolution": {Regexp: `(\d+p)`, Source: SourceComment},
+	}}
+	meta, err := ParseMetaInfo(buildMultiFileTorrent("bundle", [][]string{{"RD04", "MotoGP.mkv"}}))
+	require.NoError(t, err)
+	meta.Comment = "Encoded at 1080p"
+	c := makeCandidate("g", map[string]string{}, nil)
+	c.setMeta(meta)
+	c.extractFileLabels(extractor)
+
+	assert.Equal(t, "1080p", c.titleLabels["resolution"])
+	require.Len(t, c.fileLabels, 1)
+	assert.Equal(t, map[string]string{"class": "MotoGP", "round": "RD04"}, c.fileLabels[0])
+}
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode"
+
+	str2duration "github.com/xhit/go-str2duration/v2"
+)
+
+// OnComplete is what to do with a torrent once Transmission has finished it.
+// A Group's OnComplete replaces each of the feed's actions it sets, for the
+// torrents it matches.
+type OnComplete struct {
+	// Command is run, without a shell, with the torrent in its environment:
+	// RSS4T_FEED, RSS4T_TITLE, RSS4T_GUID, RSS4T_ID, RSS4T_HASH, RSS4T_DIR,
+	// RSS4T_FILES (one per line) and RSS4T_LABEL_<NAME> for each label.
+	Command []string `koanf:"Command"`
+	// Webhook is a URL the torrent is POSTed to as JSON.
+	Webhook string `koanf:"Webhook"`
+	// Organize links or copies the finished files into a library.
+	Organize OrganizeAction `koanf:"Organize"`
+	// Attempts is how many times a failing action is tried, waiting twice as
+	// long each time, before it is given up. Default 4.
+	Attempts int `koanf:"Attempts"`
+	// Timeout bounds each run of Command and Webhook. Default 10m.
+	Timeout string `koanf:"Timeout"`
+}
+
+// OrganizeAction places a torrent's finished files in a library layout.
+type OrganizeAction struct {
+	// Path is an absolute path template of where each file goes, over the
+	// torrent's labels with those extracted from the file's own name over
+	// them, Feed, Title and Published, and File and Ext, the file's name
+	// without its extension and the extension itself, e.g.
+	// "/library/{{.series}}/{{.round}} - {{.session}}{{.Ext}}".
+	Path string `koanf:"Path"`
+	// Mode is link, a hard link and the default, or copy.
+	Mode string `koanf:"Mode"`
+}
+
+// The OnComplete actions, as named in history.
+const (
+	postActionCommand  = "command"
+	postActionWebhook  = "webhook"
+	postActionOrganize = "organize"
+)
+
+// Organize modes.
+const (
+	organizeLink = "link"
+	organizeCopy = "copy"
+)
+
+// Organize.Path fields describing the file, besides destFields.
+const (
+	organizeFieldFile = "File"
+	organizeFieldExt  = "Ext"
+)
+
+const (
+	defaultPostAttempts = 4
+	defaultPostTimeout  = 10 * time.Minute
+	// maxPostBackoff caps the wait before an action is tried again.
+	maxPostBackoff = time.Hour
+)
+
+// Enabled reports whether there is any action to run.
+func (o *OnComplete) Enabled() bool {
+	return len(o.Command) > 0 || o.Webhook != "" || o.Organize.Path != ""
+}
+
+// Validate checks the actions, with known saying which fields Organize.Path
+// may name besides File and Ext.
+func (o *OnComplete) Validate(known func(string) bool) error {
+	if len(o.Command) > 0 && o.Command[0] == "" {
+		return fmt.Errorf("OnComplete: Command must start with the program to run")
+	}
+	if o.Webhook != "" {
+		u, err := url.Parse(o.Webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("OnComplete: Webhook must be an http or https URL, got %q", o.Webhook)
+		}
+	}
+	if o.Attempts < 0 {
+		return fmt.Errorf("OnComplete: Attempts %d must not be negative", o.Attempts)
+	}
+	if o.Timeout != "" {
+		d, err := str2duration.ParseDuration(o.Timeout)
+		if err != nil {
+			return fmt.Errorf("OnComplete: unable to parse Timeout %q: %w", o.Timeout, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("OnComplete: Timeout %q must be positive", o.Timeout)
+		}
+	}
+	return o.Organize.validate(known)
+}
+
+func (a *OrganizeAction) validate(known func(string) bool) error {
+	switch a.Mode {
+	case "", organizeLink, organizeCopy:
+	default:
+		return fmt.Errorf("OnComplete: Organize: Mode must be %q or %q, got %q", organizeLink, organizeCopy, a.Mode)
+	}
+	if a.Path == "" {
+		if a.Mode != "" {
+			return fmt.Errorf("OnComplete: Organize: Mode needs a Path")
+		}
+		return nil
+	}
+	if !strings.HasPrefix(a.Path, "/") {
+		return fmt.Errorf("OnComplete: Organize: Path %q must be absolute", a.Path)
+	}
+	tmpl, err := a.template()
+	if err != nil {
+		return fmt.Errorf("OnComplete: Organize: %w", err)
+	}
+	for _, name := range templateFields(tmpl) {
+		if name != organizeFieldFile && name != organizeFieldExt && !known(name) {
+			return fmt.Errorf("OnComplete: Organize: Path %q: %q is not a label of the feed", a.Path, name)
+		}
+	}
+	return nil
+}
+
+func (a *OrganizeAction) template() (*template.Template, error) {
+	return parsePathTemplate("Path", a.Path)
+}
+
+// over returns o with the actions over sets in place of its own.
+func (o OnComplete) over(over OnComplete) OnComplete {
+	if len(over.Command) > 0 {
+		o.Command = over.Command
+	}
+	if over.Webhook != "" {
+		o.Webhook = over.Webhook
+	}
+	if over.Organize.Path != "" {
+		o.Organize = over.Organize
+	}
+	if over.Attempts != 0 {
+		o.Attempts = over.Attempts
+	}
+	if over.Timeout != "" {
+		o.Timeout = over.Timeout
+	}
+	return o
+}
+
+// onComplete returns the feed's OnComplete with those of the Groups matching
+// labels over it. Where several groups set an action, the first in config
+// order wins.
+func (m *Feed) onComplete(labels map[string]string) OnComplete {
+	actions := m.OnComplete
+	for i := len(m.Groups) - 1; i >= 0; i-- {
+		if m.Groups[i].Matches(labels) {
+			actions = actions.over(m.Groups[i].OnComplete)
+		}
+	}
+	return actions
+}
+
+// completedTorrent is what the OnComplete actions are told about a torrent,
+// and the body of the webhook.
+type completedTorrent struct {
+	Feed      string            `json:"feed"`
+	Title     string            `json:"title"`
+	GUID      string            `json:"guid"`
+	ID        int64             `json:"id"`
+	InfoHash  string            `json:"infohash,omitempty"`
+	Dir       string            `json:"dir"`
+	Files     []string          `json:"files"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Published time.Time         `json:"published,omitzero"`
+	Completed time.Time         `json:"completed"`
+}
+
+// env returns the RSS4T_ variables Command is run with.
+func (ct *completedTorrent) env() []string {
+	env := []string{
+		"RSS4T_FEED=" + ct.Feed,
+		"RSS4T_TITLE=" + ct.Title,
+		"RSS4T_GUID=" + ct.GUID,
+		"RSS4T_ID=" + strconv.FormatInt(ct.ID, 10),
+		"RSS4T_HASH=" + ct.InfoHash,
+		"RSS4T_DIR=" + ct.Dir,
+		"RSS4T_FILES=" + strings.Join(ct.Files, "\n"),
+	}
+	for name, value := range ct.Labels {
+		env = append(env, "RSS4T_LABEL_"+envName(name)+"="+value)
+	}
+	return env
+}
+
+// envName makes a label name fit for an environment variable: upper case,
+// with anything but letters and digits as "_".
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, name)
+}
+
+// OrganizeFile is one file Organize places, from the download to the library.
+type OrganizeFile struct {
+	From string `json:"From"`
+	To   string `json:"To"`
+}
+
+// organizePlan returns where Organize puts each of ct's files. extractor, when
+// there is one, adds the labels found in each file's own name.
+func (a *OrganizeAction) organizePlan(ct completedTorrent, extractor *ExtractorSet) ([]OrganizeFile, error) {
+	tmpl, err := a.template()
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]string{
+		destFieldFeed:  ct.Feed,
+		destFieldTitle: ct.Title,
+	}
+	if !ct.Published.IsZero() {
+		fields[destFieldPublished] = ct.Published.Format("2006-01-02")
+	}
+	fields = MergeLabels(fields, ct.Labels)
+
+	var plan []OrganizeFile
+	for _, name := range ct.Files {
+		fileFields := fields
+		if extractor != nil {
+			if labels := extractor.ExtractPerFile([]string{name})[0]; labels != nil {
+				fileFields = MergeLabels(fields, labels)
+			}
+		}
+		base := path.Base(name)
+		ext := path.Ext(base)
+		fileFields = MergeLabels(fileFields, map[string]string{
+			organizeFieldFile: strings.TrimSuffix(base, ext),
+			organizeFieldExt:  ext,
+		})
+		to, err := renderPathTemplate(tmpl, fileFields)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for _, p := range plan {
+			if p.To == to {
+				return nil, fmt.Errorf("%s and %s both go to %s", p.From, path.Join(ct.Dir, name), to)
+			}
+		}
+		plan = append(plan, OrganizeFile{From: path.Join(ct.Dir, name), To: to})
+	}
+	return plan, nil
+}
+
+// PostJob is one OnComplete action of a completed torrent, waiting to run or
+// to be tried again. It carries everything the action needs, so neither a
+// config change nor a restart in between changes what it does.
+type PostJob struct {
+	Feed    string          `json:"Feed"`
+	GUID    string          `json:"GUID"`
+	Title   string          `json:"Title"`
+	Action  string          `json:"Action"`
+	Command []string        `json:"Command,omitempty"`
+	Env     []string        `json:"Env,omitempty"`
+	Webhook string          `json:"Webhook,omitempty"`
+	Body    json.RawMessage `json:"Body,omitempty"`
+	Files   []OrganizeFile  `json:"Files,omitempty"`
+	Copy    bool            `json:"Copy,omitempty"`
+	Timeout time.Duration   `json:"Timeout,omitempty"`
+
+	Attempts    int       `json:"Attempts"`
+	MaxAttempts int       `json:"MaxAttempts"`
+	NextTry     time.Time `json:"NextTry,omitzero"`
+}
+
+// queuePostJobs queues the OnComplete actions of feedCfg for ct, and records
+// them as pending in history. An Organize whose Path does not render for the
+// files is recorded as failed: trying again would not change that.
+func queuePostJobs(ctx *RunContext, feedCfg Feed, ct completedTorrent) {
+	actions := feedCfg.onComplete(ct.Labels)
+	if !actions.Enabled() {
+		return
+	}
+	base := PostJob{
+		Feed:        ct.Feed,
+		GUID:        ct.GUID,
+		Title:       ct.Title,
+		Timeout:     defaultPostTimeout,
+		MaxAttempts: defaultPostAttempts,
+	}
+	if actions.Attempts > 0 {
+		base.MaxAttempts = actions.Attempts
+	}
+	if actions.Timeout != "" {
+		if d, err := str2duration.ParseDuration(actions.Timeout); err == nil {
+			base.Timeout = d
+		}
+	}
+
+	var jobs []PostJob
+	if len(actions.Command) > 0 {
+		job := base
+		job.Action = postActionCommand
+		job.Command = actions.Command
+		job.Env = ct.env()
+		jobs = append(jobs, job)
+	}
+	if actions.Webhook != "" {
+		body, err := json.Marshal(ct)
+		if err != nil {
+			log.WithError(err).Errorf("%s: unable to encode the webhook of %s", ct.Feed, ct.Title)
+		} else {
+			job := base
+			job.Action = postActionWebhook
+			job.Webhook = actions.Webhook
+			job.Body = body
+			jobs = append(jobs, job)
+		}
+	}
+	if actions.Organize.Path != "" {
+		plan, err := actions.Organize.organizePlan(ct, ctx.Config.Extractors[feedCfg.Extractor])
+		if err != nil {
+			log.WithError(err).Errorf("%s: unable to organize %s", ct.Feed, ct.Title)
+			setPostStatus(ctx, ct.Feed, ct.GUID, postActionOrganize, "failed: "+err.Error())
+		} else {
+			job := base
+			job.Action = postActionOrganize
+			job.Files = plan
+			job.Copy = actions.Organize.Mode == organizeCopy
+			jobs = append(jobs, job)
+		}
+	}
+	for _, job := range jobs {
+		ctx.Cache.AddPostJob(job)
+		setPostStatus(ctx, job.Feed, job.GUID, job.Action, "pending")
+	}
+}
+
+// runPostJobs runs the queued actions due at now. One that fails is tried
+// again later, waiting twice as long each time, until it runs out of
+// attempts.
+func runPostJobs(ctx *RunContext, now time.Time) {
+	runPostJobsShared(ctx, now, &sync.Mutex{})
+}
+
+// runPostJobsShared is runPostJobs for a ctx shared under mu, which the
+// caller must not hold. It takes mu only to pick the due actions and to
+// record how each went, not while one runs: a command or a copy may take
+// minutes. The actions stay queued while they run, so one cut short by a
+// restart is tried again.
+func runPostJobsShared(ctx *RunContext, now time.Time, mu sync.Locker) {
+	mu.Lock()
+	var due []PostJob
+	for _, job := range ctx.Cache.PostJobs {
+		if !now.Before(job.NextTry) {
+			due = append(due, job)
+		}
+	}
+	mu.Unlock()
+
+	for _, job := range due {
+		job.Attempts++
+		err := job.run()
+		var status string
+		retry := false
+		switch {
+		case err == nil:
+			log.Infof("%s: %s of %s done", job.Feed, job.Action, job.Title)
+			status = "done"
+		case job.Attempts >= job.MaxAttempts:
+			log.WithError(err).Errorf("%s: %s of %s failed, giving up after %d attempts", job.Feed, job.Action, job.Title, job.Attempts)
+			status = fmt.Sprintf("failed after %d attempts: %s", job.Attempts, err)
+		default:
+			job.NextTry = now.Add(postBackoff(job.Attempts))
+			log.WithError(err).Warnf("%s: %s of %s failed, trying again at %s", job.Feed, job.Action, job.Title, job.NextTry.Format(time.TimeOnly))
+			status = fmt.Sprintf("attempt %d of %d failed, retrying at %s: %s",
+				job.Attempts, job.MaxAttempts, job.NextTry.Format("2006-01-02 15:04"), err)
+			retry = true
+		}
+		mu.Lock()
+		ctx.Cache.FinishPostJob(job, retry)
+		setPostStatus(ctx, job.Feed, job.GUID, job.Action, status)
+		mu.Unlock()
+	}
+}
+
+// postBackoff is the wait before an action that has failed attempts times is
+// tried again.
+func postBackoff(attempts int) time.Duration {
+	wait := time.Minute
+	for i := 1; i < attempts && wait < maxPostBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxPostBackoff)
+}
+
+func setPostStatus(ctx *RunContext, feedName, guid, action, status string) {
+	if ctx.History != nil {
+		ctx.History.SetActionStatus(feedName, guid, action, status)
+	}
+}
+
+// run runs the action once.
+func (job *PostJob) run() error {
+	switch job.Action {
+	case postActionCommand:
+		return job.runCommand()
+	case postActionWebhook:
+		return job.postWebhook()
+	case postActionOrganize:
+		return organizeFiles(job.Files, job.Copy)
+	}
+	return fmt.Errorf("unknown action %q", job.Action)
+}
+
+func (job *PostJob) runCommand() error {
+	ctx, cancel := context.WithTimeout(context.Background(), job.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, job.Command[0], job.Command[1:]...) //nolint:gosec
+	cmd.Env = append(os.Environ(), job.Env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if last := lastLine(out); last != "" {
+			return fmt.Errorf("%w: %s", err, last)
+		}
+		return err
+	}
+	return nil
+}
+
+// lastLine returns the last non-empty line of out, which is usually the one
+// saying what went wrong.
+func lastLine(out []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	if len(last) > 200 {
+		last = last[:200] + "..."
+	}
+	return last
+}
+
+func (job *PostJob) postWebhook() error {
+	client := &http.Client{Timeout: job.Timeout}
+	resp, err := client.Post(job.Webhook, "application/json", bytes.NewReader(job.Body)) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// organizeFiles hard links, or with byCopy copies, each file into place. A
+// file already in place from an earlier attempt is left as it is.
+func organizeFiles(files []OrganizeFile, byCopy bool) error {
+	for _, f := range files {
+		from, err := os.Stat(f.From)
+		if err != nil {
+			return err
+		}
+		if to, err := os.Stat(f.To); err == nil {
+			if os.SameFile(from, to) || (byCopy && from.Size() == to.Size()) {
+				continue
+			}
+			return fmt.Errorf("%s already exists", f.To)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if err := os.MkdirAll(path.Dir(f.To), 0755); err != nil { //nolint:gosec
+			return err
+		}
+		if byCopy {
+			err = copyFile(f.From, f.To)
+		} else {
+			err = os.Link(f.From, f.To)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies from to to by way of a temporary file, so a copy cut short
+// is never taken for a finished one.
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close() //nolint:errcheck
+	tmp := to + ".part"
+	dst, err := os.Create(tmp) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()    //nolint:errcheck
+		os.Remove(tmp) //nolint:errcheck
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp) //nolint:errcheck
+		return err
+	}
+	return os.Rename(tmp, to)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnComplete_Validate(t *testing.T) {
+	known := func(name string) bool { return name == "series" || name == destFieldTitle }
+	for _, tc := range []struct {
+		name    string
+		actions OnComplete
+		wantErr string
+	}{
+		{name: "none", actions: OnComplete{}},
+		{name: "all", actions: OnComplete{
+			Command:  []string{"/scripts/done.sh", "--quiet"},
+			Webhook:  "https://example.com/hook",
+			Organize: OrganizeAction{Path: "/library/{{.series}}/{{.File}}{{.Ext}}", Mode: organizeCopy},
+			Attempts: 2,
+			Timeout:  "30s",
+		}},
+		{name: "empty program", actions: OnComplete{Command: []string{""}}, wantErr: "Command must start"},
+		{name: "bad webhook", actions: OnComplete{Webhook: "ftp://example.com"}, wantErr: "Webhook must be"},
+		{name: "negative attempts", actions: OnComplete{Attempts: -1}, wantErr: "Attempts -1"},
+		{name: "bad timeout", actions: OnComplete{Timeout: "soon"}, wantErr: "unable to parse Timeout"},
+		{name: "relative path", actions: OnComplete{Organize: OrganizeAction{Path: "library/{{.series}}"}}, wantErr: "must be absolute"},
+		{name: "unknown label", actions: OnComplete{Organize: OrganizeAction{Path: "/library/{{.season}}"}}, wantErr: `"season" is not a label`},
+		{name: "bad mode", actions: OnComplete{Organize: OrganizeAction{Path: "/library", Mode: "move"}}, wantErr: "Mode must be"},
+		{name: "mode without path", actions: OnComplete{Organize: OrganizeAction{Mode: organizeLink}}, wantErr: "Mode needs a Path"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.actions.Validate(known)
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestFeed_OnCompleteGroupsOverride(t *testing.T) {
+	feed := Feed{
+		OnComplete: OnComplete{Webhook: "https://example.com/feed", Command: []string{"feed.sh"}},
+		Groups: []Group{
+			{Require: map[string][]string{"class": {"MotoGP"}}, OnComplete: OnComplete{Webhook: "https://example.com/motogp"}},
+			{Require: map[string][]string{}, OnComplete: OnComplete{Webhook: "https://example.com/any", Attempts: 9}},
+		},
+	}
+	actions := feed.onComplete(map[string]string{"class": "MotoGP"})
+	assert.Equal(t, "https://example.com/motogp", actions.Webhook, "the first matching group wins")
+	assert.Equal(t, 9, actions.Attempts)
+	assert.Equal(t, []string{"feed.sh"}, actions.Command, "what no group sets stays the feed's")
+
+	actions = feed.onComplete(map[string]string{"class": "Moto2"})
+	assert.Equal(t, "https://example.com/any", actions.Webhook)
+}
+
+func TestOrganizePlan(t *testing.T) {
+	extractor := &ExtractorSet{Labels: map[string]LabelDef{
+		"session": {Regexp: `(Race|Sprint)`},
+	}}
+	ct := completedTorrent{
+		Feed:   "F",
+		Title:  "MotoGP.RD01",
+		Dir:    "/downloads",
+		Files:  []string{"MotoGP.RD01/Race.mkv", "MotoGP.RD01/Sprint.mkv"},
+		Labels: map[string]string{"series": "MotoGP/2026", "round": "RD01", "session": "Qualifying"},
+	}
+	organize := OrganizeAction{Path: "/library/{{.series}}/{{.round}} - {{.session}}{{.Ext}}"}
+
+	plan, err := organize.organizePlan(ct, extractor)
+	require.NoError(t, err)
+	assert.Equal(t, []OrganizeFile{
+		{From: "/downloads/MotoGP.RD01/Race.mkv", To: "/library/MotoGP_2026/RD01 - Race.mkv"},
+		{From: "/downloads/MotoGP.RD01/Sprint.mkv", To: "/library/MotoGP_2026/RD01 - Sprint.mkv"},
+	}, plan, "a file's own labels win, and values are single path elements")
+
+	_, err = organize.organizePlan(ct, nil)
+	assert.ErrorContains(t, err, "both go to /library/MotoGP_2026/RD01 - Qualifying.mkv")
+}
+
+func TestCompletedTorrent_Env(t *testing.T) {
+	ct := completedTorrent{Feed: "F", Title: "T", ID: 7, Dir: "/d", Files: []string{"a", "b"},
+		Labels: map[string]string{"round": "RD01", "video-codec": "x265"}}
+	env := ct.env()
+	assert.Contains(t, env, "RSS4T_ID=7")
+	assert.Contains(t, env, "RSS4T_FILES=a\nb")
+	assert.Contains(t, env, "RSS4T_LABEL_ROUND=RD01")
+	assert.Contains(t, env, "RSS4T_LABEL_VIDEO_CODEC=x265")
+}
+
+// A completed torrent runs its feed's command, webhook and organize, and
+// history records each as done.
+func TestCheckCompletions_RunsOnComplete(t *testing.T) {
+	downloads := t.TempDir()
+	library := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(downloads, "RD01.720p.mkv"), []byte("video"), 0600))
+
+	var hook completedTorrent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(body, &hook))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	tx, ctx, _ := completionSetup(t)
+	tx.torrents[0]["downloadDir"] = downloads
+	tx.complete(1)
+	ctx.Cache.Seen[0].Labels = map[string]string{"round": "RD01"}
+	out := filepath.Join(library, "command.out")
+	ctx.Config.Feeds[0].OnComplete = OnComplete{
+		Command:  []string{"sh", "-c", `echo "$RSS4T_LABEL_ROUND $RSS4T_ID" > ` + out},
+		Webhook:  srv.URL,
+		Organize: OrganizeAction{Path: library + "/{{.round}}/{{.File}}{{.Ext}}"},
+	}
+
+	checkCompletions(ctx, time.Now().Add(-time.Hour), false)
+	require.Len(t, ctx.Cache.PostJobs, 3)
+	idx := ctx.History.guidIndex[historyKey("F", "guid-720p")]
+	assert.Equal(t, "pending", ctx.History.Records[idx].Actions[postActionWebhook])
+
+	runPostJobs(ctx, time.Now())
+	assert.Empty(t, ctx.Cache.PostJobs)
+	assert.Equal(t, map[string]string{
+		postActionCommand: "done", postActionWebhook: "done", postActionOrganize: "done",
+	}, ctx.History.Records[idx].Actions)
+
+	got, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "RD01 1\n", string(got))
+	assert.Equal(t, "guid-720p", hook.GUID)
+	assert.Equal(t, []string{"RD01.720p.mkv"}, hook.Files)
+	linked, err := os.ReadFile(filepath.Join(library, "RD01", "RD01.720p.mkv"))
+	require.NoError(t, err)
+	assert.Equal(t, "video", string(linked))
+}
+
+// A failing action is tried again after a growing wait, and given up on
+// after its attempts.
+func TestRunPostJobs_RetriesThenGivesUp(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	_, ctx, _ := completionSetup(t)
+	ctx.Cache.AddPostJob(PostJob{Feed: "F", GUID: "guid-720p", Title: "T", Action: postActionWebhook,
+		Webhook: srv.URL, Body: []byte(`{}`), Timeout: time.Second, MaxAttempts: 2})
+	status := func() string {
+		idx := ctx.History.guidIndex[historyKey("F", "guid-720p")]
+		return ctx.History.Records[idx].Actions[postActionWebhook]
+	}
+
+	now := time.Now()
+	runPostJobs(ctx, now)
+	require.Len(t, ctx.Cache.PostJobs, 1)
+	assert.Equal(t, now.Add(time.Minute), ctx.Cache.PostJobs[0].NextTry)
+	assert.True(t, strings.HasPrefix(status(), "attempt 1 of 2 failed, retrying at "), status())
+	assert.Contains(t, status(), "webhook returned HTTP 502")
+
+	runPostJobs(ctx, now.Add(30*time.Second))
+	assert.Equal(t, 1, calls, "not due yet")
+
+	runPostJobs(ctx, now.Add(time.Minute))
+	assert.Equal(t, 2, calls)
+	assert.Empty(t, ctx.Cache.PostJobs)
+	assert.Equal(t, "failed after 2 attempts: webhook returned HTTP 502", status())
+}
+
+// The lock is free while an action runs, and an action queued meanwhile
+// stays queued.
+func TestRunPostJobsShared_ActionsRunUnlocked(t *testing.T) {
+	var mu sync.Mutex
+	var ctx *RunContext
+	locked := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if mu.TryLock() {
+			locked = false
+			ctx.Cache.AddPostJob(PostJob{Feed: "F", GUID: "guid-1080p", Action: postActionWebhook, MaxAttempts: 1})
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	_, ctx, _ = completionSetup(t)
+	ctx.Cache.AddPostJob(PostJob{Feed: "F", GUID: "guid-720p", Title: "T", Action: postActionWebhook,
+		Webhook: srv.URL, Body: []byte(`{}`), Timeout: time.Second, MaxAttempts: 2})
+
+	runPostJobsShared(ctx, time.Now(), &mu)
+	assert.False(t, locked, "the webhook ran under the lock")
+	require.Len(t, ctx.Cache.PostJobs, 1)
+	assert.Equal(t, "guid-1080p", ctx.Cache.PostJobs[0].GUID)
+	idx := ctx.History.guidIndex[historyKey("F", "guid-720p")]
+	assert.Equal(t, "done", ctx.History.Records[idx].Actions[postActionWebhook])
+}
+
+func TestPostBackoff(t *testing.T) {
+	assert.Equal(t, time.Minute, postBackoff(1))
+	assert.Equal(t, 4*time.Minute, postBackoff(3))
+	assert.Equal(t, maxPostBackoff, postBackoff(20))
+}
+
+func TestOrganizeFiles_CopyAndRetry(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "a.mkv")
+	require.NoError(t, os.WriteFile(from, []byte("video"), 0600))
+	files := []OrganizeFile{{From: from, To: filepath.Join(dir, "lib", "b.mkv")}}
+
+	require.NoError(t, organizeFiles(files, true))
+	require.NoError(t, organizeFiles(files, true), "a file already in place is left")
+	got, err := os.ReadFile(files[0].To)
+	require.NoError(t, err)
+	assert.Equal(t, "video", string(got))
+
+	require.NoError(t, os.WriteFile(files[0].To, []byte("other file"), 0600))
+	assert.ErrorContains(t, organizeFiles(files, false), "already exists")
+}
+
+// Without ntfy, /notify-complete still accepts the hook when it can trigger
+// a completion check. With ntfy, it reports the torrent it announced.
+func TestNotifyComplete_TriggersCompletionCheck(t *testing.T) {
+	type call struct {
+		id        int64
+		name      string
+		announced bool
+	}
+	var calls []call
+	completed := func(id int64, name string, announced bool) { calls = append(calls, call{id, name, announced}) }
+
+	mux := http.NewServeMux()
+	registerNotifyCompleteRoute(mux, staticNtfy(NtfyConfig{}), staticNotif(NotificationsConfig{}), completed, nil)
+	req := httptest.NewRequest("POST", "/notify-complete", bytes.NewBufferString(`{"name":"My.Show","dir":"/dl","id":1}`))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []call{{1, "My.Show", false}}, calls)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	defer srv.Close()
+	mux = http.NewServeMux()
+	registerNotifyCompleteRoute(mux, staticNtfy(mustValidateNtfyConfig(t, NtfyConfig{BaseURL: srv.URL, Topic: "t"})), staticNotif(NotificationsConfig{}), completed, nil)
+	req = httptest.NewRequest("POST", "/notify-complete", bytes.NewBufferString(`{"name":"My.Show","dir":"/dl","id":2}`))
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, call{2, "My.Show", true}, calls[1])
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	bytesize "github.com/inhies/go-bytesize"
+	str2duration "github.com/xhit/go-str2duration/v2"
+)
+
+// QuotaPolicy caps what a feed, or every feed together, dispatches over a
+// rolling Period, counted from the dispatched records in history. A winner
+// over the quota is held back, and dispatched once older torrents have left
+// the Period.
+type QuotaPolicy struct {
+	// Size caps the total size dispatched, e.g. 200GB.
+	Size string `koanf:"Size"`
+	// Torrents caps the number of torrents dispatched.
+	Torrents int `koanf:"Torrents"`
+	// Period is the rolling window the caps apply to, e.g. 1d or 7d.
+	Period string `koanf:"Period"`
+}
+
+// Enabled reports whether the policy has a cap.
+func (q *QuotaPolicy) Enabled() bool {
+	return q.Size != "" || q.Torrents > 0
+}
+
+// Validate parses Size and Period.
+func (q *QuotaPolicy) Validate() error {
+	if q.Torrents < 0 {
+		return fmt.Errorf("Quota: Torrents %d must not be negative", q.Torrents)
+	}
+	if q.Size != "" {
+		size, err := bytesize.Parse(q.Size)
+		if err != nil {
+			return fmt.Errorf("Quota: unable to parse Size %q: %w", q.Size, err)
+		}
+		if size == 0 {
+			return fmt.Errorf("Quota: Size %q must be positive", q.Size)
+		}
+	}
+	if !q.Enabled() {
+		if q.Period != "" {
+			return fmt.Errorf("Quota: Period needs a Size or Torrents")
+		}
+		return nil
+	}
+	if q.Period == "" {
+		return fmt.Errorf("Quota: Size and Torrents need a Period")
+	}
+	period, err := str2duration.ParseDuration(q.Period)
+	if err != nil {
+		return fmt.Errorf("Quota: unable to parse Period %q: %w", q.Period, err)
+	}
+	if period <= 0 {
+		return fmt.Errorf("Quota: Period %q must be positive", q.Period)
+	}
+	return nil
+}
+
+// withinHistory checks Period is no longer than the seenCacheDays of history
+// SaveHistory keeps: over a longer Period the quota would only count part of
+// what was dispatched in it.
+func (q *QuotaPolicy) withinHistory(seenCacheDays int) error {
+	if !q.Enabled() {
+		return nil
+	}
+	period, err := str2duration.ParseDuration(q.Period)
+	if err != nil {
+		return nil // Validate reports it
+	}
+	if kept := time.Duration(seenCacheDays) * 24 * time.Hour; period > kept {
+		return fmt.Errorf("Quota: Period %s is longer than the %d day(s) of history SeenCacheDays keeps", q.Period, seenCacheDays)
+	}
+	return nil
+}
+
+// holdReason returns why a winner of size bytes from feedName is over the
+// quota at now, or "" when it is not. An empty feedName counts every feed's
+// dispatches, for the global quota. A Size or Period that does not parse,
+// which loadConfig has already rejected, leaves that cap out.
+func (q *QuotaPolicy) holdReason(h *HistoryFile, feedName string, size int64, now time.Time) string {
+	if !q.Enabled() {
+		return ""
+	}
+	period, err := str2duration.ParseDuration(q.Period)
+	if err != nil || period <= 0 {
+		return ""
+	}
+	torrents, used := h.dispatchedSince(feedName, now.Add(-period))
+	if q.Torrents > 0 && torrents >= q.Torrents {
+		return fmt.Sprintf("Quota reached: %d torrents per %s", q.Torrents, q.Period)
+	}
+	if q.Size != "" {
+		limit, err := bytesize.Parse(q.Size)
+		if err == nil && used+max(size, 0) > int64(limit) {
+			return fmt.Sprintf("Quota reached: %s of %s per %s used", formatBytes(used), q.Size, q.Period)
+		}
+	}
+	return ""
+}
+
+// dispatchedSince counts the torrents of feedName dispatched since since, and
+// the total size of their wanted files. An empty feedName counts every feed's.
+func (h *HistoryFile) dispatchedSince(feedName string, since time.Time) (int, int64) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var n int
+	var size int64
+	for _, r := range h.Records {
+		if feedName != "" && r.Feed != feedName {
+			continue
+		}
+		if at := r.dispatchedAt(); !at.IsZero() && !at.Before(since) {
+			n++
+			size += r.wantedBytes()
+		}
+	}
+	return n, size
+}
+
+// dispatchedAt is when the record's torrent was dispatched, or the zero time
+// if it never was. A record written before Dispatched was kept falls back to
+// ProcessedAt while its outcome is still dispatched.
+func (r HistoryRecord) dispatchedAt() time.Time {
+	if !r.Dispatched.IsZero() {
+		return r.Dispatched
+	}
+	if r.Outcome == "dispatched" {
+		return r.ProcessedAt
+	}
+	return time.Time{}
+}
+
+// wantedBytes is the size of the record's wanted files: SizeBytes when
+// WantedBytes is not set, as for a whole torrent.
+func (r HistoryRecord) wantedBytes() int64 {
+	if r.WantedBytes > 0 {
+		return r.WantedBytes
+	}
+	return r.SizeBytes
+}
+
+// dispatchHold returns why w, a winner of feedCfg, is not to be dispatched at
+// now under the feed's and the global Schedule and Quota, or "" when it may
+// be. They only limit what is added to Transmission, so a run that adds
+// nothing is never held.
+func (cmd *OnceCmd) dispatchHold(ctx *RunContext, feedCfg Feed, w *candidate, now time.Time) string {
+	if cmd.NoAction || cmd.Skip || cmd.Download || feedCfg.Action == "notify" {
+		return ""
+	}
+	if reason := feedCfg.Schedule.holdReason(now); reason != "" {
+		return reason
+	}
+	if reason := ctx.Config.Schedule.holdReason(now); reason != "" {
+		return "global " + reason
+	}
+	if !feedCfg.Quota.Enabled() && !ctx.Config.Quota.Enabled() {
+		return ""
+	}
+	if ctx.History == nil {
+		if !ctx.quotaWarned {
+			log.Warn("Quota is counted from history, so it is not enforced without --history-file")
+			ctx.quotaWarned = true
+		}
+		return ""
+	}
+	size := wantedSize(w, selectFiles(feedCfg, w))
+	if reason := feedCfg.Quota.holdReason(ctx.History, feedCfg.Name, size, now); reason != "" {
+		return reason
+	}
+	if reason := ctx.Config.Quota.holdReason(ctx.History, "", size, now); reason != "" {
+		return "global " + reason
+	}
+	return ""
+}
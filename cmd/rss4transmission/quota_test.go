@@ -0,0 +1,160 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaPolicy_Validate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		quota   QuotaPolicy
+		wantErr string
+	}{
+		{name: "none"},
+		{name: "both", quota: QuotaPolicy{Size: "200GB", Torrents: 20, Period: "7d"}},
+		{name: "bad size", quota: QuotaPolicy{Size: "lots", Period: "1d"}, wantErr: `unable to parse Size "lots"`},
+		{name: "zero size", quota: QuotaPolicy{Size: "0GB", Period: "1d"}, wantErr: "must be positive"},
+		{name: "negative torrents", quota: QuotaPolicy{Torrents: -1, Period: "1d"}, wantErr: "Torrents -1"},
+		{name: "no period", quota: QuotaPolicy{Torrents: 5}, wantErr: "need a Period"},
+		{name: "bad period", quota: QuotaPolicy{Torrents: 5, Period: "daily"}, wantErr: `unable to parse Period "daily"`},
+		{name: "period alone", quota: QuotaPolicy{Period: "1d"}, wantErr: "Period needs a Size or Torrents"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.quota.Validate()
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestQuotaPolicy_HoldReason(t *testing.T) {
+	now := time.Now()
+	h := &HistoryFile{guidIndex: map[string]int{}, Records: []HistoryRecord{
+		{Feed: "F", GUID: "a", Outcome: "dispatched", ProcessedAt: now.Add(-time.Hour), SizeBytes: 60 << 30},
+		{Feed: "F", GUID: "b", Outcome: removedOutcome, ProcessedAt: now, Dispatched: now.Add(-2 * time.Hour), SizeBytes: 60 << 30},
+		{Feed: "F", GUID: "c", Outcome: "dispatched", ProcessedAt: now.Add(-48 * time.Hour), SizeBytes: 60 << 30},
+		{Feed: "F", GUID: "d", Outcome: "skipped", ProcessedAt: now, SizeBytes: 60 << 30},
+		{Feed: "G", GUID: "e", Outcome: "dispatched", ProcessedAt: now, SizeBytes: 60 << 30},
+	}}
+
+	n, size := h.dispatchedSince("F", now.Add(-24*time.Hour))
+	assert.Equal(t, 2, n, "a removed torrent still counts, by when it was dispatched")
+	assert.Equal(t, int64(120<<30), size)
+
+	q := QuotaPolicy{Size: "200GB", Period: "1d"}
+	assert.Equal(t, "", q.holdReason(h, "F", 80<<30, now))
+	assert.Equal(t, "Quota reached: 120.00GB of 200GB per 1d used", q.holdReason(h, "F", 81<<30, now))
+	assert.Equal(t, "Quota reached: 180.00GB of 200GB per 1d used", q.holdReason(h, "", 30<<30, now), "the global quota counts every feed")
+
+	q = QuotaPolicy{Torrents: 2, Period: "1d"}
+	assert.Equal(t, "Quota reached: 2 torrents per 1d", q.holdReason(h, "F", 0, now))
+	assert.Equal(t, "", q.holdReason(h, "G", 0, now))
+}
+
+// A winner outside the Schedule or over the Quota is held pending as
+// deferred, and dispatched once they allow it.
+func TestProcessFeed_HoldsForScheduleAndQuota(t *testing.T) {
+	tx := &upgradeTransmission{}
+	ctx := tx.serve(t)
+	cmd := &OnceCmd{}
+	feed := upgradeFeed(UpgradePolicy{})
+	now := time.Now()
+	ctx.Config.Schedule = DispatchSchedule{Deny: []TimeWindow{{
+		From: now.Add(-time.Minute).Format("15:04"),
+		To:   now.Add(10 * time.Minute).Format("15:04"),
+	}}}
+
+	cmd.processFeed(ctx, "F", feed, upgradeItem("720p", hash720), upgradeExtractor)
+	assert.Empty(t, tx.torrents)
+	require.Len(t, ctx.Cache.PendingItems("F"), 1)
+	rec, _ := ctx.History.FindRecord("F", "guid-720p")
+	assert.Equal(t, "deferred", rec.Outcome)
+	assert.Contains(t, rec.Reason, "global outside Schedule until ")
+	firstReason := rec.Reason
+
+	ctx.Config.Schedule = DispatchSchedule{}
+	ctx.History.AddOrUpdateRecord(HistoryRecord{Feed: "F", GUID: "earlier", Outcome: "dispatched"})
+	feed.Quota = QuotaPolicy{Torrents: 1, Period: "1d"}
+	cmd.processFeed(ctx, "F", feed, upgradeItem("720p", hash720), upgradeExtractor)
+	assert.Empty(t, tx.torrents)
+	rec, _ = ctx.History.FindRecord("F", "guid-720p")
+	require.Len(t, ctx.Cache.PendingItems("F"), 1)
+	assert.Equal(t, firstReason, rec.Reason, "a deferred record keeps its first reason")
+
+	feed.Quota = QuotaPolicy{Torrents: 2, Period: "1d"}
+	cmd.processFeed(ctx, "F", feed, upgradeItem("720p", hash720), upgradeExtractor)
+	require.Len(t, tx.torrents, 1)
+	assert.Empty(t, ctx.Cache.PendingItems("F"))
+	rec, _ = ctx.History.FindRecord("F", "guid-720p")
+	assert.Equal(t, "dispatched", rec.Outcome)
+	assert.False(t, rec.Dispatched.IsZero())
+}
+
+// Notify-only feeds, --no-action and a run without history are never held.
+func TestDispatchHold_Exemptions(t *testing.T) {
+	ctx := &RunContext{Config: Config{Quota: QuotaPolicy{Torrents: 1, Period: "1d"}}}
+	w := &candidate{item: &FeedItem{Item: &gofeed.Item{}}}
+
+	assert.Equal(t, "", (&OnceCmd{}).dispatchHold(ctx, Feed{Name: "F"}, w, time.Now()))
+	assert.True(t, ctx.quotaWarned)
+
+	ctx.History = &HistoryFile{guidIndex: map[string]int{}, Records: []HistoryRecord{
+		{Feed: "F", Outcome: "dispatched", ProcessedAt: time.Now()},
+	}}
+	assert.Equal(t, "global Quota reached: 1 torrents per 1d", (&OnceCmd{}).dispatchHold(ctx, Feed{Name: "F"}, w, time.Now()))
+	assert.Equal(t, "", (&OnceCmd{}).dispatchHold(ctx, Feed{Name: "F", Action: "notify"}, w, time.Now()))
+	assert.Equal(t, "", (&OnceCmd{NoAction: true}).dispatchHold(ctx, Feed{Name: "F"}, w, time.Now()))
+}
+
+// The Size cap counts only the files the Files rules leave wanted.
+func TestDispatchHold_SizeCountsWantedFiles(t *testing.T) {
+	ctx := &RunContext{History: &HistoryFile{guidIndex: map[string]int{}}}
+	feedCfg := Feed{
+		Name:     "F",
+		Identity: []string{"round"},
+		Groups:   []Group{{Require: map[string][]string{}}},
+		Quota:    QuotaPolicy{Size: "3KB", Period: "1d"},
+	}
+	w := bundleCandidate(t)
+	assert.Equal(t, "Quota reached: 0.00B of 3KB per 1d used", (&OnceCmd{}).dispatchHold(ctx, feedCfg, w, time.Now()))
+
+	feedCfg.Files = FileRules{Include: []string{`\.mkv$`}, Exclude: []string{`(?i)sample`}}
+	assert.Equal(t, "", (&OnceCmd{}).dispatchHold(ctx, feedCfg, w, time.Now()))
+}
+
+// A bundle dispatched in part counts its wanted files against the quota,
+// not the whole torrent.
+func TestDispatchHold_UsedCountsWantedFiles(t *testing.T) {
+	ctx := &RunContext{History: &HistoryFile{guidIndex: map[string]int{}}}
+	feedCfg := Feed{
+		Name:     "F",
+		Identity: []string{"round"},
+		Groups:   []Group{{Require: map[string][]string{}}},
+		Files:    FileRules{Include: []string{`\.mkv$`}, Exclude: []string{`(?i)sample`}},
+		Quota:    QuotaPolicy{Size: "5KB", Period: "1d"},
+	}
+	w := bundleCandidate(t)
+	ctx.recordDispatched("F", w, selectFiles(feedCfg, w), nil)
+	rec, ok := ctx.History.FindRecord("F", "g1")
+	require.True(t, ok)
+	assert.Equal(t, int64(4000), rec.SizeBytes)
+	assert.Equal(t, int64(2000), rec.WantedBytes)
+
+	next := bundleCandidate(t)
+	next.item.Item.GUID = "g2"
+	assert.Equal(t, "", (&OnceCmd{}).dispatchHold(ctx, feedCfg, next, time.Now()), "2000B used and 2000B wanted fit in 5KB")
+}
+
+func TestQuotaPolicy_WithinHistory(t *testing.T) {
+	assert.NoError(t, (&QuotaPolicy{}).withinHistory(0))
+	assert.NoError(t, (&QuotaPolicy{Torrents: 5, Period: "30d"}).withinHistory(30))
+	assert.ErrorContains(t, (&QuotaPolicy{Torrents: 5, Period: "31d"}).withinHistory(30), "Period 31d is longer than the 30 day(s)")
+}
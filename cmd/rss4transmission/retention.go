@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hekmon/transmissionrpc/v3"
+	str2duration "github.com/xhit/go-str2duration/v2"
+)
+
+// RetentionPolicy removes a feed's torrents from Transmission once they have
+// seeded enough or a better version has replaced them. Any one rule is
+// enough; a torrent still downloading is never removed.
+type RetentionPolicy struct {
+	// Ratio removes a torrent once it has uploaded this many times its
+	// size.
+	Ratio float64 `koanf:"Ratio"`
+	// SeedTime removes a torrent once it has seeded this long, e.g. 14d.
+	SeedTime string `koanf:"SeedTime"`
+	// Superseded removes a torrent once the seen cache has a better version
+	// of every identity key it covers, and those versions have completed.
+	Superseded bool `koanf:"Superseded"`
+	// DeleteData deletes the torrent's data along with it.
+	DeleteData bool `koanf:"DeleteData"`
+}
+
+// removedOutcome is the history outcome of a torrent Retention or an Upgrade
+// removed.
+const removedOutcome = "removed"
+
+// Enabled reports whether the policy has any rule.
+func (r *RetentionPolicy) Enabled() bool {
+	return r.Ratio > 0 || r.SeedTime != "" || r.Superseded
+}
+
+// Validate parses SeedTime and checks the policy has a rule to act on.
+func (r *RetentionPolicy) Validate() error {
+	if r.Ratio < 0 {
+		return fmt.Errorf("Retention: Ratio %g must not be negative", r.Ratio)
+	}
+	if r.SeedTime != "" {
+		d, err := str2duration.ParseDuration(r.SeedTime)
+		if err != nil {
+			return fmt.Errorf("Retention: unable to parse SeedTime %q: %w", r.SeedTime, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("Retention: SeedTime %q must be positive", r.SeedTime)
+		}
+	}
+	if r.DeleteData && !r.Enabled() {
+		return fmt.Errorf("Retention: DeleteData needs Ratio, SeedTime or Superseded")
+	}
+	return nil
+}
+
+// seedTime returns the parsed SeedTime, or 0 when there is none or it does
+// not parse, which loadConfig has already rejected.
+func (r *RetentionPolicy) seedTime() time.Duration {
+	if r.SeedTime == "" {
+		return 0
+	}
+	d, err := str2duration.ParseDuration(r.SeedTime)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+type RetentionCmd struct {
+	Feed        []string `kong:"help='Limit retention to the given feed(s)'"`
+	DryRun      bool     `kong:"short='n',help='Log and record what would be removed without removing it'"`
+	HistoryFile string   `kong:"help='Path to history JSON file'"`
+}
+
+func (cmd *RetentionCmd) Run(ctx *RunContext) error {
+	if cmd.HistoryFile != "" {
+		var err error
+		if ctx.History, err = OpenHistory(cmd.HistoryFile); err != nil {
+			log.WithError(err).Warnf("Unable to open history file: %s", cmd.HistoryFile)
+			ctx.History = nil
+		}
+	}
+	once := OnceCmd{Feed: cmd.Feed}
+	return once.Retention(ctx, cmd.DryRun)
+}
+
+// Retention applies each feed's Retention policy to the torrents the seen
+// cache says it added, then saves the cache and history. With dryRun it only
+// logs what it would remove, and notes it on the history record.
+func (cmd *OnceCmd) Retention(ctx *RunContext, dryRun bool) error {
+	var feeds []Feed
+	for _, f := range ctx.Config.Feeds {
+		if cmd.feedAllowed(f.Name) && f.Retention.Enabled() {
+			feeds = append(feeds, f)
+		}
+	}
+	if len(feeds) > 0 && ctx.Tx() != nil {
+		checkRetention(ctx, feeds, dryRun)
+	}
+
+	return saveAfterPass(ctx)
+}
+
+// retentionFields are the torrent-get fields checkRetention needs.
+var retentionFields = []string{"id", "hashString", "name", "percentDone", "uploadRatio", "secondsSeeding", "downloadDir", "files"}
+
+// checkRetention removes the torrents of feeds that their Retention policy
+// says have had their time. A torrent no longer in Transmission was removed
+// some other way, and is left alone.
+func checkRetention(ctx *RunContext, feeds []Feed, dryRun bool) {
+	torrents, err := ctx.Tx().TorrentGet(context.TODO(), retentionFields, nil)
+	if err != nil {
+		log.WithError(err).Warn("Unable to list Transmission's torrents, checking retention next time")
+		return
+	}
+	for _, r := range slices.Clone(ctx.Cache.Seen) {
+		i := slices.IndexFunc(feeds, func(f Feed) bool { return f.Name == r.Feed })
+		// Only a torrent this tool added has a TorrentID: a record of one
+		// skipped, added by hand or already in Transmission has none.
+		if i < 0 || !r.Removed.IsZero() || r.TorrentID == 0 {
+			continue
+		}
+		feedCfg := feeds[i]
+		t := findTorrent(torrents, r.InfoHash, r.TorrentID)
+		if t == nil || t.ID == nil || t.PercentDone == nil || *t.PercentDone < 1 {
+			continue
+		}
+		reason, by := retentionReason(ctx.Cache, feedCfg, r, t, torrents)
+		if reason == "" {
+			continue
+		}
+		deleteData := feedCfg.Retention.DeleteData
+		if deleteData && by != nil && sharesFiles(by, t) {
+			log.Warnf("%s: %s shares files with the version replacing it, removing it without its data", r.Feed, r.Title)
+			deleteData = false
+		}
+		if deleteData {
+			reason += ", data deleted"
+		}
+
+		if dryRun {
+			log.Infof("%s: would remove %s (%s) [dry run]", r.Feed, r.Title, reason)
+			if ctx.History != nil {
+				ctx.History.SetOutcome(r.Feed, r.GUID, "", "would be removed: "+reason+" (dry run)")
+			}
+			continue
+		}
+		err := ctx.Tx().TorrentRemove(context.TODO(), transmissionrpc.TorrentRemovePayload{
+			IDs:             []int64{*t.ID},
+			DeleteLocalData: deleteData,
+		})
+		if err != nil {
+			log.WithError(err).Errorf("%s: unable to remove %s", r.Feed, r.Title)
+			continue
+		}
+		log.Infof("%s: removed %s (%s)", r.Feed, r.Title, reason)
+		ctx.Cache.MarkRemoved(r.Feed, r.GUID, time.Now())
+		if ctx.History != nil {
+			ctx.History.SetOutcome(r.Feed, r.GUID, removedOutcome, reason)
+		}
+	}
+}
+
+// retentionReason returns why feedCfg's Retention removes t, the torrent of
+// r, or "" to keep it. A torrent removed as superseded also returns the
+// completed torrent of the version replacing it, when there is one.
+func retentionReason(cache *CacheFile, feedCfg Feed, r CacheRecord, t *transmissionrpc.Torrent, torrents []transmissionrpc.Torrent) (string, *transmissionrpc.Torrent) {
+	policy := feedCfg.Retention
+	if policy.Ratio > 0 && t.UploadRatio != nil && *t.UploadRatio >= policy.Ratio {
+		return fmt.Sprintf("ratio %.2f reached", *t.UploadRatio), nil
+	}
+	if seed := policy.seedTime(); seed > 0 && t.TimeSeeding != nil && *t.TimeSeeding >= seed {
+		return fmt.Sprintf("seeded for %s", policy.SeedTime), nil
+	}
+	if !policy.Superseded {
+		return "", nil
+	}
+	// Only a better version this tool added to Transmission, and that has
+	// completed, replaces r: a skipped or downloaded record, or one still
+	// downloading, would leave nothing to seed.
+	complete := func(t *transmissionrpc.Torrent) bool {
+		return t != nil && t.PercentDone != nil && *t.PercentDone >= 1
+	}
+	better, ok := cache.Supersedes(r, feedCfg.Prefer, func(b CacheRecord) bool {
+		return b.TorrentID != 0 && (b.Complete || complete(findTorrent(torrents, b.InfoHash, b.TorrentID)))
+	})
+	if !ok {
+		return "", nil
+	}
+	var by *transmissionrpc.Torrent
+	for _, b := range better {
+		if bt := findTorrent(torrents, b.InfoHash, b.TorrentID); complete(bt) {
+			by = bt
+		}
+	}
+	titles := make([]string, len(better))
+	for i, b := range better {
+		titles[i] = b.Title
+		if titles[i] == "" {
+			titles[i] = b.GUID // recorded before titles were
+		}
+	}
+	return "superseded by " + strings.Join(titles, ", "), by
+}
+
+// findTorrent returns the torrent with infohash hash, or with id when there is
+// no hash, from torrents.
+func findTorrent(torrents []transmissionrpc.Torrent, hash string, id int64) *transmissionrpc.Torrent {
+	for i, t := range torrents {
+		if hash != "" {
+			if t.HashString != nil && strings.EqualFold(*t.HashString, hash) {
+				return &torrents[i]
+			}
+		} else if t.ID != nil && *t.ID == id {
+			return &torrents[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// retentionSetup tracks a dispatched 720p and 1080p of RD01, as torrents 1
+// and 2 of tx, in the seen cache and history.
+func retentionSetup(t *testing.T, policy RetentionPolicy) (*upgradeTransmission, *RunContext, []Feed) {
+	t.Helper()
+	tx := &upgradeTransmission{torrents: []map[string]any{
+		{"id": 1, "hashString": hash720, "percentDone": 1.0, "uploadRatio": 0.5, "secondsSeeding": 3600,
+			"downloadDir": "/d", "files": []map[string]any{{"name": "RD01.720p.mkv"}}},
+		{"id": 2, "hashString": hash1080, "percentDone": 0.4, "uploadRatio": 0.0, "secondsSeeding": 0,
+			"downloadDir": "/d", "files": []map[string]any{{"name": "RD01.1080p.mkv"}}},
+	}}
+	ctx := tx.serve(t)
+	feed := upgradeFeed(UpgradePolicy{})
+	feed.Retention = policy
+	for _, v := range []struct {
+		res, hash string
+		id        int64
+	}{{"720p", hash720, 1}, {"1080p", hash1080, 2}} {
+		labels := map[string]string{"round": "RD01", "resolution": v.res}
+		ctx.Cache.Seen = append(ctx.Cache.Seen, CacheRecord{
+			Feed: "F", GUID: "guid-" + v.res, Title: "MotoGP.RD01.Race." + v.res, AddTime: time.Now(),
+			Labels: labels, IdentityKeys: []string{"round=RD01"}, InfoHash: v.hash, TorrentID: v.id,
+		})
+		ctx.History.AddOrUpdateRecord(HistoryRecord{Feed: "F", GUID: "guid-" + v.res, Outcome: "dispatched", Labels: labels})
+	}
+	return tx, ctx, []Feed{feed}
+}
+
+func historyOutcome(t *testing.T, ctx *RunContext, guid string) (string, string) {
+	t.Helper()
+	idx, ok := ctx.History.guidIndex[historyKey("F", guid)]
+	require.True(t, ok)
+	return ctx.History.Records[idx].Outcome, ctx.History.Records[idx].Reason
+}
+
+func TestRetention_Ratio(t *testing.T) {
+	tx, ctx, feeds := retentionSetup(t, RetentionPolicy{Ratio: 2, DeleteData: true})
+	checkRetention(ctx, feeds, false)
+	assert.Empty(t, tx.removed, "ratio 0.5 is short of 2")
+
+	tx.torrents[0]["uploadRatio"] = 2.25
+	tx.torrents[1]["uploadRatio"] = 3.0 // still downloading
+	checkRetention(ctx, feeds, false)
+	assert.Equal(t, []int64{1}, tx.removed)
+	assert.Equal(t, []bool{true}, tx.withData)
+
+	outcome, reason := historyOutcome(t, ctx, "guid-720p")
+	assert.Equal(t, removedOutcome, outcome)
+	assert.Equal(t, "ratio 2.25 reached, data deleted", reason)
+	assert.False(t, ctx.Cache.Seen[0].Removed.IsZero())
+
+	checkRetention(ctx, feeds, false)
+	assert.Equal(t, []int64{1}, tx.removed, "a removed torrent is not removed again")
+}
+
+// A record of a torrent this tool did not add, such as one already in
+// Transmission or skipped, is left alone even with its infohash.
+func TestRetention_OnlyAddedTorrents(t *testing.T) {
+	tx, ctx, feeds := retentionSetup(t, RetentionPolicy{Ratio: 2, DeleteData: true})
+	tx.torrents[0]["uploadRatio"] = 2.25
+	ctx.Cache.Seen[0].TorrentID = 0
+
+	checkRetention(ctx, feeds, false)
+	assert.Empty(t, tx.removed)
+	outcome, _ := historyOutcome(t, ctx, "guid-720p")
+	assert.Equal(t, "dispatched", outcome)
+}
+
+func TestRetention_SeedTime(t *testing.T) {
+	tx, ctx, feeds := retentionSetup(t, RetentionPolicy{SeedTime: "14d"})
+	checkRetention(ctx, feeds, false)
+	assert.Empty(t, tx.removed)
+
+	tx.torrents[0]["secondsSeeding"] = 15 * 24 * 3600
+	checkRetention(ctx, feeds, false)
+	assert.Equal(t, []int64{1}, tx.removed)
+	assert.Equal(t, []bool{false}, tx.withData)
+	_, reason := historyOutcome(t, ctx, "guid-720p")
+	assert.Equal(t, "seeded for 14d", reason)
+}
+
+// The 720p goes once the 1080p replacing it has completed, keeping its data
+// when the two share a file.
+func TestRetention_Superseded(t *testing.T) {
+	tx, ctx, feeds := retentionSetup(t, RetentionPolicy{Superseded: true, DeleteData: true})
+	checkRetention(ctx, feeds, false)
+	assert.Empty(t, tx.removed, "the 1080p is still downloading")
+
+	tx.complete(2)
+	tx.torrents[1]["files"] = []map[string]any{{"name": "RD01.720p.mkv"}}
+	checkRetention(ctx, feeds, false)
+	assert.Equal(t, []int64{1}, tx.removed, "the 1080p itself is not superseded")
+	assert.Equal(t, []bool{false}, tx.withData)
+	_, reason := historyOutcome(t, ctx, "guid-720p")
+	assert.Equal(t, "superseded by MotoGP.RD01.Race.1080p", reason)
+}
+
+// A better version only counts once this tool added it to Transmission and
+// it completed: a skipped record, or one gone from Transmission before it
+// finished, leaves the 720p seeding.
+func TestRetention_SupersededNeedsCompletedVersion(t *testing.T) {
+	tx, ctx, feeds := retentionSetup(t, RetentionPolicy{Superseded: true, DeleteData: true})
+	tx.torrents = tx.torrents[:1]
+	checkRetention(ctx, feeds, false)
+	assert.Empty(t, tx.removed, "the 1080p left Transmission unfinished")
+
+	ctx.Cache.Seen[1].TorrentID = 0
+	ctx.Cache.Seen[1].Complete = true
+	checkRetention(ctx, feeds, false)
+	assert.Empty(t, tx.removed, "the 1080p was never added to Transmission")
+
+	ctx.Cache.Seen[1].TorrentID = 2
+	checkRetention(ctx, feeds, false)
+	assert.Equal(t, []int64{1}, tx.removed, "the 1080p completed before it left Transmission")
+	assert.Equal(t, []bool{true}, tx.withData)
+}
+
+func TestRetention_DryRun(t *testing.T) {
+	tx, ctx, feeds := retentionSetup(t, RetentionPolicy{Ratio: 0.5})
+	checkRetention(ctx, feeds, true)
+	assert.Empty(t, tx.removed)
+	assert.True(t, ctx.Cache.Seen[0].Removed.IsZero())
+
+	outcome, reason := historyOutcome(t, ctx, "guid-720p")
+	assert.Equal(t, "dispatched", outcome)
+	assert.Equal(t, "would be removed: ratio 0.50 reached (dry run)", reason)
+}
+
+func TestRetentionPolicy_Validate(t *testing.T) {
+	assert.NoError(t, (&RetentionPolicy{}).Validate())
+	assert.NoError(t, (&RetentionPolicy{Ratio: 1.5, SeedTime: "7d", Superseded: true, DeleteData: true}).Validate())
+	assert.Error(t, (&RetentionPolicy{Ratio: -1}).Validate())
+	assert.Error(t, (&RetentionPolicy{SeedTime: "soon"}).Validate())
+	assert.Error(t, (&RetentionPolicy{DeleteData: true}).Validate())
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A Rule is a Group's boolean expression over labels, for what Require's
+// lists of exact values cannot say:
+//
+//	round >= 5 and round <= 12
+//	episode in 1..10
+//	network != BT or resolution in [2160p, 1080p]
+//	title =~ "(?i)final" and not (session missing)
+//
+// Numeric comparisons (<, <=, >, >= and ranges) use the first number in the
+// label's value, so "RD05" compares as 5. == and != compare strings, =~ and
+// !~ match a regexp, and a list in [...] holds strings. A Multi label passes
+// a comparison when any of its values does, or with MultiMatch: all when
+// every one does.
+//
+// A comparison on a label the item does not have is neither true nor false
+// but unknown, like an absent Require key: Matches needs the rule to be true,
+// and MatchScore counts only a false rule against the group.
+
+// truth is a three-valued result: a comparison on a missing label is unknown.
+type truth int8
+
+const (
+	truthFalse truth = iota
+	truthUnknown
+	truthTrue
+)
+
+func truthOf(b bool) truth {
+	if b {
+		return truthTrue
+	}
+	return truthFalse
+}
+
+// ruleExpr is a parsed Rule.
+type ruleExpr interface {
+	eval(labels map[string]string, m multiMatch) truth
+}
+
+type ruleAnd struct{ left, right ruleExpr }
+type ruleOr struct{ left, right ruleExpr }
+type ruleNot struct{ expr ruleExpr }
+
+func (e ruleAnd) eval(labels map[string]string, m multiMatch) truth {
+	l, r := e.left.eval(labels, m), e.right.eval(labels, m)
+	return min(l, r)
+}
+
+func (e ruleOr) eval(labels map[string]string, m multiMatch) truth {
+	l, r := e.left.eval(labels, m), e.right.eval(labels, m)
+	return max(l, r)
+}
+
+func (e ruleNot) eval(labels map[string]string, m multiMatch) truth {
+	return truthTrue - e.expr.eval(labels, m)
+}
+
+// rulePresence is "label exists" (want true) or "label missing".
+type rulePresence struct {
+	label string
+	want  bool
+}
+
+func (e rulePresence) eval(labels map[string]string, _ multiMatch) truth {
+	_, ok := labels[e.label]
+	return truthOf(ok == e.want)
+}
+
+// ruleCompare tests one label's value with test, or with its negation for
+// !=, !~ and not in. A multi-value label is tested value by value, negated
+// or not, and MultiMatch then asks any or all of them to pass.
+type ruleCompare struct {
+	label  string
+	test   func(value string) bool
+	negate bool
+}
+
+func (e ruleCompare) eval(labels map[string]string, m multiMatch) truth {
+	v, ok := labels[e.label]
+	if !ok {
+		return truthUnknown
+	}
+	if e.test(v) {
+		return truthOf(!e.negate)
+	}
+	values := labelValues(v, m.labels[e.label])
+	if len(values) < 2 {
+		return truthOf(e.negate)
+	}
+	pass := func(value string) bool { return e.test(value) != e.negate }
+	if m.all {
+		return truthOf(!slices.ContainsFunc(values, func(value string) bool { return !pass(value) }))
+	}
+	return truthOf(slices.ContainsFunc(values, pass))
+}
+
+var firstNumber = regexp.MustCompile(`\d+(?:\.\d+)?`)
+
+// labelNumber returns the first number in a label value.
+func labelNumber(v string) (float64, bool) {
+	n, err := strconv.ParseFloat(firstNumber.FindString(v), 64)
+	return n, err == nil
+}
+
+// parseRule parses a Rule, with errors that point at where it went wrong.
+func parseRule(rule string) (ruleExpr, error) {
+	tokens, err := lexRule(rule)
+	if err != nil {
+		return nil, err
+	}
+	p := &ruleParser{tokens: tokens}
+	expr, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEnd {
+		return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos)
+	}
+	return expr, nil
+}
+
+type tokenKind int
+
+const (
+	tokEnd tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+)
+
+type ruleToken struct {
+	kind tokenKind
+	text string
+	pos  int // 1-based, for errors
+}
+
+func (t ruleToken) String() string {
+	switch t.kind {
+	case tokEnd:
+		return "end of rule"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// ruleOps are the operators and punctuation, longest first so that "<="
+// is not read as "<".
+var ruleOps = []string{"==", "!=", "<=", ">=", "=~", "!~", "..", "<", ">", "(", ")", "[", "]", ","}
+
+func lexRule(rule string) ([]ruleToken, error) {
+	var tokens []ruleToken
+	for i := 0; i < len(rule); {
+		c := rule[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(rule[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at position %d", i+1)
+			}
+			tokens = append(tokens, ruleToken{kind: tokString, text: rule[i+1 : i+1+end], pos: i + 1})
+			i += end + 2
+		case isRuleWordByte(c) && c != '.':
+			start := i
+			for i < len(rule) && isRuleWordByte(rule[i]) {
+				// A dot belongs to the word (5.1, a.b) unless it starts "..".
+				if rule[i] == '.' && (i+1 >= len(rule) || rule[i+1] == '.' || i == start) {
+					break
+				}
+				i++
+			}
+			tokens = append(tokens, ruleToken{kind: tokWord, text: rule[start:i], pos: start + 1})
+		default:
+			op := ""
+			for _, o := range ruleOps {
+				if strings.HasPrefix(rule[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at position %d", rune(c), i+1)
+			}
+			tokens = append(tokens, ruleToken{kind: tokOp, text: op, pos: i + 1})
+			i += len(op)
+		}
+	}
+	return append(tokens, ruleToken{kind: tokEnd, pos: len(rule) + 1}), nil
+}
+
+func isRuleWordByte(c byte) bool {
+	return c < unicode.MaxASCII && (c == '_' || c == '-' || c == '+' || c == ':' || c == '.' ||
+		unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)))
+}
+
+type ruleParser struct {
+	tokens []ruleToken
+	pos    int
+}
+
+func (p *ruleParser) peek() ruleToken { return p.tokens[p.pos] }
+
+func (p *ruleParser) next() ruleToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokEnd {
+		p.pos++
+	}
+	return t
+}
+
+// keyword reports whether the next token is the word kw, and consumes it.
+func (p *ruleParser) keyword(kw string) bool {
+	if t := p.peek(); t.kind == tokWord && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *ruleParser) op(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *ruleParser) or() (ruleExpr, error) {
+	left, err := p.and()
+	for err == nil && p.keyword("or") {
+		var right ruleExpr
+		if right, err = p.and(); err == nil {
+			left = ruleOr{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *ruleParser) and() (ruleExpr, error) {
+	left, err := p.unary()
+	for err == nil && p.keyword("and") {
+		var right ruleExpr
+		if right, err = p.unary(); err == nil {
+			left = ruleAnd{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *ruleParser) unary() (ruleExpr, error) {
+	if p.keyword("not") {
+		expr, err := p.unary()
+		return ruleNot{expr}, err
+	}
+	if p.op("(") {
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokOp || t.text != ")" {
+			return nil, fmt.Errorf("expected \")\" at position %d, got %s", t.pos, t)
+		}
+		return expr, nil
+	}
+	return p.comparison()
+}
+
+func (p *ruleParser) comparison() (ruleExpr, error) {
+	t := p.next()
+	if t.kind != tokWord || isRuleKeyword(t.text) {
+		return nil, fmt.Errorf("expected a label name at position %d, got %s", t.pos, t)
+	}
+	label := t.text
+
+	if p.keyword("exists") {
+		return rulePresence{label: label, want: true}, nil
+	}
+	if p.keyword("missing") {
+		return rulePresence{label: label, want: false}, nil
+	}
+	if p.keyword("in") {
+		return p.in(label, false)
+	}
+	if p.keyword("not") {
+		if !p.keyword("in") {
+			t := p.peek()
+			return nil, fmt.Errorf("expected \"in\" after \"not\" at position %d, got %s", t.pos, t)
+		}
+		return p.in(label, true)
+	}
+
+	opTok := p.next()
+	if opTok.kind != tokOp {
+		return nil, fmt.Errorf("expected an operator after %q at position %d, got %s", label, opTok.pos, opTok)
+	}
+	valTok := p.next()
+	if valTok.kind != tokWord && valTok.kind != tokString {
+		return nil, fmt.Errorf("expected a value after %q at position %d, got %s", opTok.text, valTok.pos, valTok)
+	}
+	value := valTok.text
+
+	switch opTok.text {
+	case "==", "!=":
+		return ruleCompare{label, func(v string) bool { return v == value }, opTok.text == "!="}, nil
+	case "=~", "!~":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp at position %d: %w", valTok.pos, err)
+		}
+		return ruleCompare{label, re.MatchString, opTok.text == "!~"}, nil
+	case "<", "<=", ">", ">=":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q needs a number at position %d, got %s", opTok.text, valTok.pos, valTok)
+		}
+		cmp := map[string]func(a float64) bool{
+			"<":  func(a float64) bool { return a < n },
+			"<=": func(a float64) bool { return a <= n },
+			">":  func(a float64) bool { return a > n },
+			">=": func(a float64) bool { return a >= n },
+		}[opTok.text]
+		return ruleCompare{label, func(v string) bool {
+			a, ok := labelNumber(v)
+			return ok && cmp(a)
+		}, false}, nil
+	}
+	return nil, fmt.Errorf("unexpected %s at position %d", opTok, opTok.pos)
+}
+
+// in parses what follows "in": a numeric range lo..hi or a list [a, b].
+func (p *ruleParser) in(label string, negate bool) (ruleExpr, error) {
+	var test func(v string) bool
+	if p.op("[") {
+		var values []string
+		for {
+			t := p.next()
+			if t.kind != tokWord && t.kind != tokString {
+				return nil, fmt.Errorf("expected a value in the list at position %d, got %s", t.pos, t)
+			}
+			values = append(values, t.text)
+			if p.op("]") {
+				break
+			}
+			if !p.op(",") {
+				t := p.peek()
+				return nil, fmt.Errorf("expected \",\" or \"]\" at position %d, got %s", t.pos, t)
+			}
+		}
+		test = func(v string) bool { return slices.Contains(values, v) }
+	} else {
+		loTok := p.next()
+		lo, err := strconv.ParseFloat(loTok.text, 64)
+		if loTok.kind != tokWord || err != nil {
+			return nil, fmt.Errorf("expected a range like 1..10 or a list like [a, b] at position %d, got %s", loTok.pos, loTok)
+		}
+		if !p.op("..") {
+			t := p.peek()
+			return nil, fmt.Errorf("expected \"..\" at position %d, got %s", t.pos, t)
+		}
+		hiTok := p.next()
+		hi, err := strconv.ParseFloat(hiTok.text, 64)
+		if hiTok.kind != tokWord || err != nil {
+			return nil, fmt.Errorf("expected the end of the range at position %d, got %s", hiTok.pos, hiTok)
+		}
+		if hi < lo {
+			return nil, fmt.Errorf("range %s..%s at position %d is empty", loTok.text, hiTok.text, loTok.pos)
+		}
+		test = func(v string) bool {
+			n, ok := labelNumber(v)
+			return ok && n >= lo && n <= hi
+		}
+	}
+	return ruleCompare{label, test, negate}, nil
+}
+
+func isRuleKeyword(word string) bool {
+	switch strings.ToLower(word) {
+	case "and", "or", "not", "in", "exists", "missing":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func ruleGroup(t *testing.T, rule string) Group {
+	t.Helper()
+	g := Group{Rule: rule}
+	if err := g.Validate(); err != nil {
+		t.Fatalf("Validate(%q): %v", rule, err)
+	}
+	return g
+}
+
+func TestRule_Comparisons(t *testing.T) {
+	labels := map[string]string{"round": "RD05", "network": "BT", "resolution": "1080p", "year": "2024"}
+	tests := []struct {
+		rule string
+		want bool
+	}{
+		{"round >= 5", true},
+		{"round > 5", false},
+		{"round < 6 and round <= 5", true},
+		{"round in 1..10", true},
+		{"round in 6..10", false},
+		{"round not in 6..10", true},
+		{"network == BT", true},
+		{"network != BT", false},
+		{"network != 'Sky Sports'", true},
+		{"resolution in [2160p, 1080p]", true},
+		{"resolution not in [2160p, 1080p]", false},
+		{`resolution =~ "^(720|1080)p$"`, true},
+		{`network !~ "(?i)bt"`, false},
+		{"network exists and session missing", true},
+		{"session exists", false},
+		{"network == Sky or round == 5", false}, // "RD05" is not the string "5"
+		{"network == Sky or round >= 5", true},
+		{"not (network == Sky) and year >= 2024", true},
+		{"NOT network == BT OR round IN 5..5", true},
+		{"year >= 2024.5", false},
+	}
+	for _, tc := range tests {
+		g := ruleGroup(t, tc.rule)
+		if got := g.Matches(labels); got != tc.want {
+			t.Errorf("%q: Matches = %v, want %v", tc.rule, got, tc.want)
+		}
+	}
+}
+
+func TestRule_ParseErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{"round >=", "expected a value"},
+		{"round >= five", "needs a number"},
+		{"round in 10..1", "is empty"},
+		{"round in 1..", "end of the range"},
+		{"round in five", "expected a range"},
+		{"round not 5", `expected "in"`},
+		{"(round >= 5", `expected ")"`},
+		{"round >= 5 network == BT", "unexpected"},
+		{"network == 'BT", "unterminated string"},
+		{"network ? BT", "unexpected '?'"},
+		{`title =~ "(["`, "invalid regexp"},
+		{"resolution in [1080p 720p]", `expected "," or "]"`},
+		{"and == BT", "expected a label name"},
+		{"network", "expected an operator"},
+	}
+	for _, tc := range tests {
+		g := Group{Rule: tc.rule}
+		err := g.Validate()
+		if err == nil {
+			t.Errorf("%q: expected an error", tc.rule)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: error %q does not mention %q", tc.rule, err, tc.want)
+		}
+	}
+}
+
+// A Rule on an absent label is unknown: it keeps Matches from passing, as an
+// absent Require key does, but MatchScore does not count it as a
+// contradiction.
+func TestRule_AbsentLabelIsUnknown(t *testing.T) {
+	g := ruleGroup(t, "round >= 5")
+	labels := map[string]string{"series": "MotoGP"}
+	if g.Matches(labels) {
+		t.Error("Matches should need the rule to be true")
+	}
+	if got := g.MatchScore(labels); got != 0 {
+		t.Errorf("MatchScore = %d, want 0 (unknown)", got)
+	}
+	if got := g.MatchScore(map[string]string{"round": "RD07"}); got != 1 {
+		t.Errorf("MatchScore = %d, want 1 (true)", got)
+	}
+	if got := g.MatchScore(map[string]string{"round": "RD02"}); got != -1 {
+		t.Errorf("MatchScore = %d, want -1 (false)", got)
+	}
+
+	// not unknown stays unknown, and false or unknown is unknown.
+	g = ruleGroup(t, "not round >= 5")
+	if got := g.MatchScore(labels); got != 0 {
+		t.Errorf("not: MatchScore = %d, want 0", got)
+	}
+	g = ruleGroup(t, "series == Indycar or round >= 5")
+	if got := g.MatchScore(labels); got != 0 {
+		t.Errorf("or: MatchScore = %d, want 0", got)
+	}
+}
+
+func TestRule_WithRequire(t *testing.T) {
+	g := Group{Require: map[string][]string{"series": {"MotoGP"}}, Rule: "round in 1..10"}
+	if err := g.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Matches(map[string]string{"series": "MotoGP", "round": "RD03"}) {
+		t.Error("Require and Rule both hold")
+	}
+	if g.Matches(map[string]string{"series": "MotoGP", "round": "RD11"}) {
+		t.Error("Rule fails")
+	}
+	if got := g.MatchScore(map[string]string{"series": "MotoGP", "round": "RD03"}); got != 2 {
+		t.Errorf("MatchScore = %d, want 2", got)
+	}
+}
+
+func TestRule_MultiValues(t *testing.T) {
+	labels := map[string]string{"audio": "de,en"}
+	multi := map[string]bool{"audio": true}
+	g := ruleGroup(t, "audio == en")
+	g.multi = multi
+	if !g.Matches(labels) {
+		t.Error("any: one value equal should match")
+	}
+	g = Group{Rule: "audio in [en, de]", MultiMatch: MultiMatchAll, multi: multi}
+	if err := g.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Matches(labels) {
+		t.Error("all: every value in the list should match")
+	}
+	if g.Matches(map[string]string{"audio": "de,en,fr"}) {
+		t.Error("all: fr is not in the list")
+	}
+}
+
+// Negations apply to each value, so under MultiMatch all every value has to
+// pass the negated test, and under any one of them does.
+func TestRule_NegatedMultiValues(t *testing.T) {
+	labels := map[string]string{"language": "en,fr"}
+	for _, tc := range []struct {
+		rule       string
+		multiMatch string
+		want       bool
+	}{
+		{"language != en", MultiMatchAll, false},
+		{"language != en", MultiMatchAny, true},
+		{"language != de", MultiMatchAll, true},
+		{`language !~ "^en$"`, MultiMatchAll, false},
+		{`language !~ "^en$"`, MultiMatchAny, true},
+		{"language not in [en, de]", MultiMatchAll, false},
+		{"language not in [en, de]", MultiMatchAny, true},
+		{"language not in [de, it]", MultiMatchAll, true},
+		{"not language == en", MultiMatchAll, true},
+	} {
+		g := Group{Rule: tc.rule, MultiMatch: tc.multiMatch, multi: map[string]bool{"language": true}}
+		if err := g.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if got := g.Matches(labels); got != tc.want {
+			t.Errorf("%s (%s) = %v, want %v", tc.rule, tc.multiMatch, got, tc.want)
+		}
+	}
+	if g := ruleGroup(t, "language != en"); g.Matches(map[string]string{"language": "en"}) {
+		t.Error("a single value equal to en does not match !=")
+	}
+}
+
+// A Group built without Validate, as tests and FileRules do, still evaluates
+// its Rule.
+func TestRule_WithoutValidate(t *testing.T) {
+	g := Group{Rule: "round >= 5"}
+	if !g.Matches(map[string]string{"round": "RD05"}) {
+		t.Error("expected the Rule to be parsed on use")
+	}
+	g = Group{Rule: "round >="}
+	if g.Matches(map[string]string{"round": "RD05"}) {
+		t.Error("a Rule that does not parse should match nothing")
+	}
+}
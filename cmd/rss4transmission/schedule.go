@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// schedulerTick is how often watch wakes to check which feeds are due. It is
+// the resolution of every Interval, not a polling rate: a wake-up with nothing
+// due does no I/O.
+const schedulerTick = 10 * time.Second
+
+// FeedSchedule is one feed's place in the watch scheduler, as the /feeds page
+// and /metrics report it.
+type FeedSchedule struct {
+	Feed     string
+	Interval time.Duration
+	// LastFetch is zero until the feed has been fetched once.
+	LastFetch time.Time
+	// NextDue is when the feed is next fetched. Before the first fetch it
+	// is zero, meaning "on the next tick".
+	NextDue   time.Time
+	LastError string
+}
+
+// feedState is what the scheduler remembers about a feed between runs.
+type feedState struct {
+	lastFetch time.Time
+	// jitter is the random delay drawn at the last fetch. It is kept rather
+	// than folded into a stored due time so that a reload which changes
+	// Interval takes effect at once: a feed moved from hourly to every two
+	// minutes must not sit out the rest of its old hour.
+	jitter    time.Duration
+	lastError string
+}
+
+// feedScheduler tracks when each feed was last fetched and when it is next
+// due. watch owns one for the life of the process; once runs without one and
+// fetches every feed.
+type feedScheduler struct {
+	mu sync.Mutex
+	// defaultInterval is --sleep, used by feeds without an Interval.
+	defaultInterval time.Duration
+	state           map[string]*feedState
+	// randJitter draws a delay in [0, max). Replaced in tests.
+	randJitter func(max time.Duration) time.Duration
+}
+
+func newFeedScheduler(defaultInterval time.Duration) *feedScheduler {
+	return &feedScheduler{
+		defaultInterval: defaultInterval,
+		state:           map[string]*feedState{},
+		randJitter: func(max time.Duration) time.Duration {
+			if max <= 0 {
+				return 0
+			}
+			return rand.N(max) //nolint:gosec // spreading load, not security
+		},
+	}
+}
+
+// interval is the feed's Interval, or the scheduler default when it has none.
+func (s *feedScheduler) interval(f *Feed) time.Duration {
+	if d := f.PollInterval(); d > 0 {
+		return d
+	}
+	return s.defaultInterval
+}
+
+// nextDue is when f is next due given its state, or the zero time when it has
+// never been fetched.
+func (s *feedScheduler) nextDue(f *Feed, st *feedState) time.Time {
+	if st == nil || st.lastFetch.IsZero() {
+		return time.Time{}
+	}
+	jitter := min(st.jitter, f.PollJitter())
+	return st.lastFetch.Add(s.interval(f) + jitter)
+}
+
+// Due reports whether f should be fetched at now.
+func (s *feedScheduler) Due(f *Feed, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !now.Before(s.nextDue(f, s.state[f.Name]))
+}
+
+// Fetched records a fetch of f at at. err is the fetch error, if any; a failed
+// fetch waits out the interval like a good one, so a broken tracker is not
+// hammered.
+func (s *feedScheduler) Fetched(f *Feed, at time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := &feedState{lastFetch: at, jitter: s.randJitter(f.PollJitter())}
+	if err != nil {
+		st.lastError = err.Error()
+	}
+	s.state[f.Name] = st
+}
+
+// Snapshot returns the schedule of every feed in feeds, in config order. A
+// feed that has been removed from the config is not reported.
+func (s *feedScheduler) Snapshot(feeds []Feed) []FeedSchedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]FeedSchedule, 0, len(feeds))
+	for _, feedCfg := range feeds {
+		// A copy: the lazy compile in PollInterval must not write to the
+		// live config from a web request.
+		f := &feedCfg
+		st := s.state[f.Name]
+		fs := FeedSchedule{
+			Feed:     f.Name,
+			Interval: s.interval(f),
+			NextDue:  s.nextDue(f, st),
+		}
+		if st != nil {
+			fs.LastFetch = st.lastFetch
+			fs.LastError = st.lastError
+		}
+		out = append(out, fs)
+	}
+	return out
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fixedJitter(d time.Duration) func(time.Duration) time.Duration {
+	return func(max time.Duration) time.Duration { return min(d, max) }
+}
+
+func TestFeedScheduler_DueFollowsInterval(t *testing.T) {
+	s := newFeedScheduler(5 * time.Minute)
+	live := &Feed{Name: "live", Interval: "2m"}
+	archive := &Feed{Name: "archive"}
+	t0 := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.True(t, s.Due(live, t0), "a feed never fetched is due at once")
+
+	s.Fetched(live, t0, nil)
+	s.Fetched(archive, t0, nil)
+	assert.False(t, s.Due(live, t0.Add(time.Minute)))
+	assert.True(t, s.Due(live, t0.Add(2*time.Minute)))
+	assert.False(t, s.Due(archive, t0.Add(2*time.Minute)), "a feed without Interval follows --sleep")
+	assert.True(t, s.Due(archive, t0.Add(5*time.Minute)))
+}
+
+func TestFeedScheduler_Jitter(t *testing.T) {
+	s := newFeedScheduler(time.Hour)
+	s.randJitter = fixedJitter(30 * time.Second)
+	f := &Feed{Name: "F", Interval: "2m", Jitter: "1m"}
+	t0 := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	s.Fetched(f, t0, nil)
+	assert.False(t, s.Due(f, t0.Add(2*time.Minute)))
+	assert.True(t, s.Due(f, t0.Add(2*time.Minute+30*time.Second)))
+}
+
+// A reload that shortens a feed's Interval takes effect at once rather than
+// after the old interval runs out.
+func TestFeedScheduler_ReloadedIntervalAppliesImmediately(t *testing.T) {
+	s := newFeedScheduler(time.Hour)
+	t0 := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.Fetched(&Feed{Name: "F", Interval: "1h"}, t0, nil)
+
+	assert.True(t, s.Due(&Feed{Name: "F", Interval: "2m"}, t0.Add(2*time.Minute)))
+}
+
+func TestFeedScheduler_Snapshot(t *testing.T) {
+	s := newFeedScheduler(time.Hour)
+	t0 := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	feeds := []Feed{{Name: "A", Interval: "10m"}, {Name: "B"}}
+	s.Fetched(&feeds[0], t0, errors.New("503 Service Unavailable"))
+	s.Fetched(&Feed{Name: "Removed"}, t0, nil)
+
+	snap := s.Snapshot(feeds)
+	require.Len(t, snap, 2, "a feed no longer configured is not reported")
+	assert.Equal(t, "A", snap[0].Feed)
+	assert.Equal(t, 10*time.Minute, snap[0].Interval)
+	assert.Equal(t, t0, snap[0].LastFetch)
+	assert.Equal(t, t0.Add(10*time.Minute), snap[0].NextDue)
+	assert.Equal(t, "503 Service Unavailable", snap[0].LastError)
+	assert.Equal(t, time.Hour, snap[1].Interval)
+	assert.True(t, snap[1].LastFetch.IsZero())
+	assert.True(t, snap[1].NextDue.IsZero())
+}
+
+// With a scheduler, Run fetches only the feeds that are due, and a run with
+// nothing due does no I/O at all.
+func TestOnceRun_ScheduledFetchesOnlyDueFeeds(t *testing.T) {
+	var mu sync.Mutex
+	hits := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		_, _ = w.Write([]byte(testRSS))
+	}))
+	defer srv.Close()
+
+	cache, err := OpenCache(filepath.Join(t.TempDir(), "seen.json"))
+	require.NoError(t, err)
+	feed := func(name, interval string) Feed {
+		return Feed{
+			Name: name, URL: srv.URL + "/" + name, Interval: interval,
+			Extractor: "e", Identity: []string{"round"},
+			Groups: []Group{{Require: map[string][]string{"round": {"never"}}}},
+		}
+	}
+	ctx := &RunContext{
+		Config: Config{
+			Feeds: []Feed{feed("fast", "2m"), feed("slow", "1h")},
+			Extractors: map[string]*ExtractorSet{"e": {Labels: map[string]LabelDef{
+				"round": {Regexp: `(RD\d+)`},
+			}}},
+			SeenCacheDays: 1,
+		},
+		Cache: cache,
+	}
+	sched := newFeedScheduler(5 * time.Minute)
+	cmd := &OnceCmd{schedule: sched}
+
+	require.NoError(t, cmd.Run(ctx))
+	assert.Equal(t, map[string]int{"/fast": 1, "/slow": 1}, hits)
+
+	require.NoError(t, cmd.Run(ctx))
+	assert.Equal(t, map[string]int{"/fast": 1, "/slow": 1}, hits, "nothing is due yet")
+
+	// Wind the clock back on the fast feed only.
+	sched.state["fast"].lastFetch = time.Now().Add(-3 * time.Minute)
+	require.NoError(t, cmd.Run(ctx))
+	assert.Equal(t, map[string]int{"/fast": 2, "/slow": 1}, hits)
+}
+
+// A feed with winners deferred by MaxDispatchPerRun waits for its next
+// scheduled fetch, which fetches the whole feed again.
+func TestOnceRun_DeferredWaitsForSchedule(t *testing.T) {
+	var mu sync.Mutex
+	var ifNoneMatch []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ifNoneMatch = append(ifNoneMatch, r.Header.Get("If-None-Match"))
+		mu.Unlock()
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(`<?xml version="1.0"?>
+<rss version="2.0"><channel><title>t</title>
+<item><title>MotoGP.RD01.Race</title><guid>g1</guid></item>
+<item><title>MotoGP.RD02.Race</title><guid>g2</guid></item>
+</channel></rss>`))
+	}))
+	defer srv.Close()
+
+	cache, err := OpenCache(filepath.Join(t.TempDir(), "seen.json"))
+	require.NoError(t, err)
+	ctx := &RunContext{
+		Config: Config{
+			Feeds: []Feed{{
+				Name: "F", URL: srv.URL, Interval: "1h", Action: "notify", MaxDispatchPerRun: 1,
+				Extractor: "e", Identity: []string{"round"},
+				Groups: []Group{{Require: map[string][]string{}}},
+			}},
+			Extractors: map[string]*ExtractorSet{"e": {Labels: map[string]LabelDef{
+				"round": {Regexp: `(RD\d+)`},
+			}}},
+			SeenCacheDays: 1,
+		},
+		Cache: cache,
+	}
+	sched := newFeedScheduler(5 * time.Minute)
+	cmd := &OnceCmd{schedule: sched}
+
+	require.NoError(t, cmd.Run(ctx))
+	require.Len(t, ctx.Cache.Seen, 1)
+	assert.Equal(t, 1, cmd.budget.Deferred())
+
+	require.NoError(t, cmd.Run(ctx))
+	assert.Equal(t, []string{""}, ifNoneMatch, "not due until its Interval")
+
+	sched.state["F"].lastFetch = time.Now().Add(-2 * time.Hour)
+	require.NoError(t, cmd.Run(ctx))
+	assert.Equal(t, []string{"", ""}, ifNoneMatch, "the deferred winner is not skipped by a 304")
+	assert.Len(t, ctx.Cache.Seen, 2)
+}
+
+func TestFeedsPage_ShowsSchedule(t *testing.T) {
+	t0 := time.Date(2026, 5, 1, 12, 0, 0, 0, time.Local)
+	schedule := func() []FeedSchedule {
+		return []FeedSchedule{
+			{Feed: "Live", Interval: 2 * time.Minute, LastFetch: t0, NextDue: t0.Add(2 * time.Minute)},
+			{Feed: "Archive", Interval: time.Hour, LastError: "tracker down"},
+		}
+	}
+	mux := http.NewServeMux()
+	registerFeedsRoutes(mux, schedule, navConfig{})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/feeds")
+	require.NoError(t, err)
+	defer resp.Body.Close() //nolint:errcheck
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	page := string(body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, page, `<span class="here">Feeds</span>`)
+	assert.Contains(t, page, "2m0s")
+	assert.Contains(t, page, "2026-05-01 12:02:00")
+	assert.Contains(t, page, "next tick", "a feed never fetched is due on the next tick")
+	assert.Contains(t, page, "tracker down")
+}
+
+func TestRenderMetrics_FeedSchedule(t *testing.T) {
+	t0 := time.Unix(1_777_000_000, 0)
+	out := renderMetrics(nil, nil, []FeedSchedule{
+		{Feed: `Moto"GP`, Interval: 2 * time.Minute, LastFetch: t0, NextDue: t0.Add(2 * time.Minute), LastError: "boom"},
+		{Feed: "Archive", Interval: time.Hour},
+	})
+
+	assert.Contains(t, out, `rss4transmission_feed_interval_seconds{feed="Moto\"GP"} 120`)
+	assert.Contains(t, out, `rss4transmission_feed_interval_seconds{feed="Archive"} 3600`)
+	assert.Contains(t, out, `rss4transmission_feed_last_fetch_timestamp_seconds{feed="Moto\"GP"} 1.777e+09`)
+	assert.Contains(t, out, `rss4transmission_feed_next_due_timestamp_seconds{feed="Moto\"GP"} 1.77700012e+09`)
+	assert.Contains(t, out, `rss4transmission_feed_last_fetch_failed{feed="Moto\"GP"} 1`)
+	assert.False(t, strings.Contains(out, `last_fetch_timestamp_seconds{feed="Archive"}`),
+		"a feed never fetched has no last-fetch sample")
+}
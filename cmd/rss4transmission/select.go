@@ -3,30 +3,258 @@ package main
 import (
 	"fmt"
 	"maps"
+	"math"
 	"slices"
+	"strconv"
 	"strings"
+
+	bytesize "github.com/inhies/go-bytesize"
 )
 
-// PreferDimension declares a preference ordering for a single label.
+// PreferDimension declares a preference ordering for a single label. With
+// Order, a value ranks by its position in the list. Without one, the dimension
+// ranks on the first number in the value: by Direction, higher or lower is
+// better, or by distance from Target, closest is better.
+//
+// Label may also name one of the pseudo-labels below, which every candidate
+// carries, so the size, the swarm, the age or the feed of a release can be
+// preferred as well as what its title says.
 type PreferDimension struct {
-	Label string   `koanf:"label"`
-	Order []string `koanf:"order"`
+	Label     string   `koanf:"label"`
+	Order     []string `koanf:"order"`
+	Direction string   `koanf:"direction"`
+	Target    string   `koanf:"target"`
+
+	multi bool // Label is Multi, set by Feed.Validate
+}
+
+// Direction values.
+const (
+	PreferHigher = "higher"
+	PreferLower  = "lower"
+)
+
+// Pseudo-labels a Prefer dimension can rank on.
+const (
+	PseudoLabelSize      = "$size"      // total size in bytes; Target takes a size like 4GB
+	PseudoLabelSeeders   = "$seeders"   // the indexer's seeder count
+	PseudoLabelPublished = "$published" // publication time, Unix seconds
+	PseudoLabelFeed      = "$feed"      // the feed's Name, for Order
+)
+
+var pseudoLabels = []string{PseudoLabelSize, PseudoLabelSeeders, PseudoLabelPublished, PseudoLabelFeed}
+
+// volatilePseudoLabels change between fetches of the same release, so they
+// rank candidates only against the others of one run, and are neither kept
+// in the seen cache nor compared against it.
+var volatilePseudoLabels = []string{PseudoLabelSeeders, PseudoLabelPublished}
+
+// Validate checks that the dimension ranks one way, and parses its Target.
+func (d *PreferDimension) Validate() error {
+	if d.Label == "" {
+		return fmt.Errorf("label is required")
+	}
+	if strings.HasPrefix(d.Label, "$") && !slices.Contains(pseudoLabels, d.Label) {
+		return fmt.Errorf("unknown pseudo-label %q, must be one of %s", d.Label, strings.Join(pseudoLabels, ", "))
+	}
+	switch d.Direction {
+	case "", PreferHigher, PreferLower:
+	default:
+		return fmt.Errorf("%s: direction must be %q or %q, got %q", d.Label, PreferHigher, PreferLower, d.Direction)
+	}
+	ways := 0
+	for _, set := range []bool{len(d.Order) > 0, d.Direction != "", d.Target != ""} {
+		if set {
+			ways++
+		}
+	}
+	if ways > 1 {
+		return fmt.Errorf("%s: set only one of order, direction and target", d.Label)
+	}
+	if d.Label == PseudoLabelFeed && len(d.Order) == 0 {
+		return fmt.Errorf("%s: needs an order of feed names", d.Label)
+	}
+	if d.Target != "" {
+		if _, err := d.target(); err != nil {
+			return fmt.Errorf("%s: invalid target %q: %w", d.Label, d.Target, err)
+		}
+	}
+	return nil
+}
+
+// target returns Target as a number: a size for $size, else a plain number.
+func (d *PreferDimension) target() (float64, error) {
+	if d.Label == PseudoLabelSize {
+		size, err := bytesize.Parse(d.Target)
+		return float64(size), err
+	}
+	return strconv.ParseFloat(d.Target, 64)
+}
+
+// numeric reports whether the dimension ranks on numbers rather than Order.
+func (d *PreferDimension) numeric() bool {
+	return d.Direction != "" || d.Target != ""
+}
+
+// numericRank ranks the first number in v: lower is better, and a value with
+// no number ranks worst. Numbers are kept to a thousandth, so versions such as
+// 2.1 and 2.2 still rank apart.
+func (d *PreferDimension) numericRank(v string) int {
+	n, ok := labelNumber(v)
+	if !ok {
+		return math.MaxInt
+	}
+	if d.Target != "" {
+		target, err := d.target()
+		if err != nil {
+			return math.MaxInt // rejected by Validate
+		}
+		n = math.Abs(n - target)
+	} else if d.Direction == PreferHigher {
+		n = -n
+	}
+	return int(math.Round(n * 1000))
+}
+
+// preferPseudoLabels returns the pseudo-labels prefer ranks on, for item:
+// the stable ones and, apart, the volatilePseudoLabels. Only those asked for
+// are returned, to keep them out of the labels of feeds that never use them.
+func preferPseudoLabels(prefer []PreferDimension, item *FeedItem) (stable, volatile map[string]string) {
+	set := func(name, value string) {
+		labels := &stable
+		if slices.Contains(volatilePseudoLabels, name) {
+			labels = &volatile
+		}
+		if *labels == nil {
+			*labels = map[string]string{}
+		}
+		(*labels)[name] = value
+	}
+	for _, dim := range prefer {
+		switch dim.Label {
+		case PseudoLabelSize:
+			if size := item.Size(); size > 0 {
+				set(dim.Label, strconv.FormatInt(size, 10))
+			}
+		case PseudoLabelSeeders:
+			if seeders, ok := itemSeeders(item); ok {
+				set(dim.Label, seeders)
+			}
+		case PseudoLabelPublished:
+			if item.Item.PublishedParsed != nil {
+				set(dim.Label, strconv.FormatInt(item.Item.PublishedParsed.Unix(), 10))
+			}
+		case PseudoLabelFeed:
+			set(dim.Label, item.Feed)
+		}
+	}
+	return stable, volatile
 }
 
-// Group is a set of Require constraints within a feed config.
+// itemSeeders returns the seeder count a Torznab indexer, or a tracker using
+// the nyaa namespace, gives for item.
+func itemSeeders(item *FeedItem) (string, bool) {
+	if v, ok := torznabAttrs(item.Item)["seeders"]; ok && v != "" {
+		return v, true
+	}
+	if exts := item.Item.Extensions["nyaa"]["seeders"]; len(exts) > 0 && exts[0].Value != "" {
+		return exts[0].Value, true
+	}
+	return "", false
+}
+
+// Group is a set of Require constraints within a feed config. Rule adds an
+// expression over labels for what Require cannot say, such as a range of
+// rounds or a value to avoid. MultiMatch says whether a Multi label satisfies
+// Require and Rule when any of its values is acceptable (the default) or only
+// when all are. Files narrows the download of the winners it matches to the
+// files it wants.
 type Group struct {
-	Require map[string][]string `koanf:"Require"`
+	Require    map[string][]string `koanf:"Require"`
+	Rule       string              `koanf:"Rule"`
+	MultiMatch string              `koanf:"MultiMatch"`
+	Files      FileRules           `koanf:"Files"`
+	Torrent    TorrentSettings     `koanf:"Torrent"`
+	OnComplete OnComplete          `koanf:"OnComplete"`
+
+	rule  ruleExpr        // parsed Rule, filled in by Validate()
+	multi map[string]bool // the feed's Multi labels, set by Feed.Validate
+}
+
+// MultiMatch values.
+const (
+	MultiMatchAny = "any"
+	MultiMatchAll = "all"
+)
+
+// Validate checks the group's MultiMatch and Torrent settings and parses its
+// Rule.
+func (g *Group) Validate() error {
+	switch g.MultiMatch {
+	case "", MultiMatchAny, MultiMatchAll:
+	default:
+		return fmt.Errorf("MultiMatch must be %q or %q, got %q", MultiMatchAny, MultiMatchAll, g.MultiMatch)
+	}
+	if err := g.Torrent.Validate(); err != nil {
+		return err
+	}
+	if g.Rule == "" {
+		g.rule = nil
+		return nil
+	}
+	rule, err := parseRule(g.Rule)
+	if err != nil {
+		return fmt.Errorf("Rule %q: %w", g.Rule, err)
+	}
+	g.rule = rule
+	return nil
+}
+
+// evalRule evaluates the group's Rule against labels; no Rule is true. A
+// group that skipped Validate has its Rule parsed here, and one that does not
+// parse, which loadConfig has already rejected, matches nothing.
+func (g *Group) evalRule(labels map[string]string) truth {
+	if g.Rule == "" {
+		return truthTrue
+	}
+	rule := g.rule
+	if rule == nil {
+		var err error
+		if rule, err = parseRule(g.Rule); err != nil {
+			log.WithError(err).Errorf("Unable to parse group Rule %q", g.Rule)
+			return truthFalse
+		}
+	}
+	return rule.eval(labels, multiMatch{labels: g.multi, all: g.MultiMatch == MultiMatchAll})
 }
 
-// Matches returns true if all Require constraints are satisfied by labels.
+// acceptable reports whether v, the value of label, satisfies one Require
+// entry.
+func (g *Group) acceptable(label, v string, acceptable []string) bool {
+	if slices.Contains(acceptable, v) {
+		return true
+	}
+	values := labelValues(v, g.multi[label])
+	if len(values) < 2 {
+		return false
+	}
+	inAcceptable := func(value string) bool { return slices.Contains(acceptable, value) }
+	if g.MultiMatch == MultiMatchAll {
+		return !slices.ContainsFunc(values, func(value string) bool { return !inAcceptable(value) })
+	}
+	return slices.ContainsFunc(values, inAcceptable)
+}
+
+// Matches returns true if all Require constraints are satisfied by labels
+// and the Rule, if any, is true.
 func (g *Group) Matches(labels map[string]string) bool {
 	for label, acceptable := range g.Require {
 		v, ok := labels[label]
-		if !ok || !slices.Contains(acceptable, v) {
+		if !ok || !g.acceptable(label, v, acceptable) {
 			return false
 		}
 	}
-	return true
+	return g.evalRule(labels) == truthTrue
 }
 
 // MatchScore returns how many Require keys are present in labels and satisfy
@@ -36,15 +264,25 @@ func (g *Group) Matches(labels map[string]string) bool {
 // extract identity-looking labels (e.g. class=MotoGP) for an item that isn't
 // theirs, and that false positive shouldn't be diluted or offset by other,
 // incidental keys matching. A key simply absent from labels doesn't
-// contradict; it's just not counted.
+// contradict; it's just not counted. The Rule counts the same way: false is
+// a contradiction, true counts one, and unknown (it tests an absent label)
+// does not count.
 func (g *Group) MatchScore(labels map[string]string) int {
 	score := 0
+	switch g.evalRule(labels) {
+	case truthFalse:
+		return -1
+	case truthTrue:
+		if g.Rule != "" {
+			score++
+		}
+	}
 	for label, acceptable := range g.Require {
 		v, ok := labels[label]
 		if !ok {
 			continue
 		}
-		if !slices.Contains(acceptable, v) {
+		if !g.acceptable(label, v, acceptable) {
 			return -1
 		}
 		score++
@@ -78,25 +316,66 @@ func MergeLabels(titleLabels, fileLabels map[string]string) map[string]string {
 
 // PreferenceRank returns a rank slice for labels against the preference
 // dimensions. Lower values are better. A missing or unrecognised label value
-// ranks as len(dim.Order) (worst possible).
+// ranks as len(dim.Order) (worst possible), or as math.MaxInt in a numeric
+// dimension. A Multi label ranks as its best value.
 func PreferenceRank(labels map[string]string, prefer []PreferDimension) []int {
 	rank := make([]int, len(prefer))
 	for i, dim := range prefer {
 		rank[i] = len(dim.Order) // default: worst rank
+		if dim.numeric() {
+			rank[i] = math.MaxInt
+		}
 		v, ok := labels[dim.Label]
 		if !ok {
 			continue
 		}
-		for j, o := range dim.Order {
-			if o == v {
+		if dim.numeric() {
+			for _, value := range labelValues(v, dim.multi) {
+				rank[i] = min(rank[i], dim.numericRank(value))
+			}
+			continue
+		}
+		if j := slices.Index(dim.Order, v); j >= 0 {
+			rank[i] = j
+			continue
+		}
+		for _, value := range labelValues(v, dim.multi) {
+			if j := slices.Index(dim.Order, value); j >= 0 && j < rank[i] {
 				rank[i] = j
-				break
 			}
 		}
 	}
 	return rank
 }
 
+// multiValueSep joins the values of a Multi label into the one string a label
+// holds, which keeps labels a plain map in the cache and history files.
+const multiValueSep = ","
+
+// joinLabelValues returns values as a Multi label's value: sorted, without
+// repeats, so the same set always makes the same identity key.
+func joinLabelValues(values []string) string {
+	values = slices.Clone(values)
+	slices.Sort(values)
+	return strings.Join(slices.Compact(values), multiValueSep)
+}
+
+// labelValues returns the values of a label: each of a Multi label's, or the
+// value itself, commas and all.
+func labelValues(v string, multi bool) []string {
+	if !multi {
+		return []string{v}
+	}
+	return strings.Split(v, multiValueSep)
+}
+
+// multiMatch is how a Rule tests Multi labels: which labels are Multi, and
+// whether all their values have to pass or any.
+type multiMatch struct {
+	labels map[string]bool
+	all    bool
+}
+
 // withDefaultLabels returns labels with any absent defaults filled in.
 // If no defaults are needed, it returns labels unchanged (no allocation).
 func withDefaultLabels(labels, defaults map[string]string) map[string]string {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"math"
 	"testing"
 )
 
@@ -349,3 +350,179 @@ func TestGroupMatchScore_EmptyRequire(t *testing.T) {
 		t.Errorf("MatchScore = %d, want 0 (nothing to require, nothing to score)", got)
 	}
 }
+
+// --- Multi labels ---
+
+func TestGroupMatches_MultiAny(t *testing.T) {
+	g := Group{Require: map[string][]string{"audio": {"en"}}, multi: map[string]bool{"audio": true}}
+	if !g.Matches(map[string]string{"audio": "de,en"}) {
+		t.Error("any: one acceptable value should satisfy Require")
+	}
+	if g.Matches(map[string]string{"audio": "de,fr"}) {
+		t.Error("any: no acceptable value should not satisfy Require")
+	}
+}
+
+func TestGroupMatches_MultiAll(t *testing.T) {
+	g := Group{Require: map[string][]string{"audio": {"en", "de"}}, MultiMatch: MultiMatchAll, multi: map[string]bool{"audio": true}}
+	if !g.Matches(map[string]string{"audio": "de,en"}) {
+		t.Error("all: every value acceptable should satisfy Require")
+	}
+	if g.Matches(map[string]string{"audio": "de,en,fr"}) {
+		t.Error("all: one unacceptable value should fail Require")
+	}
+	if g.MatchScore(map[string]string{"audio": "de,en,fr"}) != -1 {
+		t.Error("all: one unacceptable value contradicts the group")
+	}
+}
+
+// A plain label whose value happens to contain the separator still matches
+// as written.
+func TestGroupMatches_PlainValueWithComma(t *testing.T) {
+	g := Group{Require: map[string][]string{"event": {"Qatar, Lusail"}}, MultiMatch: MultiMatchAll}
+	if !g.Matches(map[string]string{"event": "Qatar, Lusail"}) {
+		t.Error("a whole-value match must win before splitting")
+	}
+}
+
+// Only a Multi label is split: any other value is one value, commas and all.
+func TestGroupMatches_OnlyMultiLabelsSplit(t *testing.T) {
+	labels := map[string]string{"session": "Race, Qualifying"}
+	g := Group{Require: map[string][]string{"session": {"Qualifying"}}}
+	if g.Matches(labels) {
+		t.Error("Require: Qualifying is not a value of its own")
+	}
+	if g := ruleGroup(t, "session != Race"); !g.Matches(labels) {
+		t.Error("Rule: the value is not Race")
+	}
+	if g := ruleGroup(t, "session == Qualifying"); g.Matches(labels) {
+		t.Error("Rule: Qualifying is not a value of its own")
+	}
+	prefer := []PreferDimension{{Label: "session", Order: []string{"Race"}}}
+	if rank := PreferenceRank(labels, prefer); rank[0] != 1 {
+		t.Errorf("rank = %d, want 1 (unlisted)", rank[0])
+	}
+}
+
+// Feed.Validate tells groups and Prefer which labels its extractor makes
+// Multi.
+func TestFeedValidate_SetsMultiLabels(t *testing.T) {
+	extractors := map[string]*ExtractorSet{"e": {Labels: map[string]LabelDef{
+		"round": {Regexp: `(RD\d+)`},
+		"audio": {Regexp: `\b(en|de|fr)\b`, Multi: true},
+	}}}
+	f := Feed{
+		Name: "F", Extractor: "e", Identity: []string{"round"},
+		Prefer: []PreferDimension{{Label: "audio", Order: []string{"en"}}, {Label: "round", Order: []string{"RD01"}}},
+		Groups: []Group{{Require: map[string][]string{"audio": {"en"}}}},
+	}
+	if err := f.Validate("F", extractors); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Groups[0].Matches(map[string]string{"audio": "de,en"}) {
+		t.Error("the group splits the Multi label")
+	}
+	if !f.Prefer[0].multi || f.Prefer[1].multi {
+		t.Errorf("Prefer multi = %v, %v; want true, false", f.Prefer[0].multi, f.Prefer[1].multi)
+	}
+}
+
+func TestGroupValidate_MultiMatch(t *testing.T) {
+	for _, mode := range []string{"", MultiMatchAny, MultiMatchAll} {
+		g := Group{MultiMatch: mode}
+		if err := g.Validate(); err != nil {
+			t.Errorf("MultiMatch %q: unexpected error %v", mode, err)
+		}
+	}
+	g := Group{MultiMatch: "some"}
+	if err := g.Validate(); err == nil {
+		t.Error("expected an error for an unknown MultiMatch")
+	}
+}
+
+func TestPreferenceRank_MultiRanksBestMember(t *testing.T) {
+	prefer := []PreferDimension{{Label: "audio", Order: []string{"en", "de", "fr"}, multi: true}}
+	rank := PreferenceRank(map[string]string{"audio": "de,fr"}, prefer)
+	if rank[0] != 1 {
+		t.Errorf("rank = %d, want 1 (de)", rank[0])
+	}
+	rank = PreferenceRank(map[string]string{"audio": "es,it"}, prefer)
+	if rank[0] != 3 {
+		t.Errorf("rank = %d, want 3 (no member listed)", rank[0])
+	}
+}
+
+func TestJoinLabelValues_SortedAndDistinct(t *testing.T) {
+	if got := joinLabelValues([]string{"fr", "en", "fr", "de"}); got != "de,en,fr" {
+		t.Errorf("got %q, want de,en,fr", got)
+	}
+}
+
+// --- numeric Prefer dimensions ---
+
+func TestPreferenceRank_NumericDirection(t *testing.T) {
+	prefer := []PreferDimension{
+		{Label: "resolution", Order: []string{"1080p", "720p"}},
+		{Label: "repack", Direction: PreferHigher},
+	}
+	repack2 := PreferenceRank(map[string]string{"resolution": "1080p", "repack": "REPACK2"}, prefer)
+	repack1 := PreferenceRank(map[string]string{"resolution": "1080p", "repack": "REPACK1"}, prefer)
+	none := PreferenceRank(map[string]string{"resolution": "1080p"}, prefer)
+	if !IsBetter(repack2, repack1) || !IsBetter(repack1, none) {
+		t.Errorf("want REPACK2 < REPACK1 < none, got %v %v %v", repack2, repack1, none)
+	}
+	if none[1] != math.MaxInt {
+		t.Errorf("missing value should rank worst, got %d", none[1])
+	}
+	hd := PreferenceRank(map[string]string{"resolution": "720p", "repack": "REPACK3"}, prefer)
+	if !IsBetter(repack1, hd) {
+		t.Error("order dimension must win before the repack count")
+	}
+
+	lower := []PreferDimension{{Label: "version", Direction: PreferLower}}
+	if !IsBetter(PreferenceRank(map[string]string{"version": "v2.1"}, lower), PreferenceRank(map[string]string{"version": "v2.2"}, lower)) {
+		t.Error("lower: v2.1 should beat v2.2")
+	}
+}
+
+func TestPreferenceRank_SizeTarget(t *testing.T) {
+	prefer := []PreferDimension{{Label: PseudoLabelSize, Target: "4GB"}}
+	near := PreferenceRank(map[string]string{PseudoLabelSize: "4100000000"}, prefer)
+	far := PreferenceRank(map[string]string{PseudoLabelSize: "2000000000"}, prefer)
+	over := PreferenceRank(map[string]string{PseudoLabelSize: "9000000000"}, prefer)
+	if !IsBetter(near, far) || !IsBetter(far, over) {
+		t.Errorf("want closest to 4GB first, got %v %v %v", near, far, over)
+	}
+}
+
+func TestPreferDimensionValidate(t *testing.T) {
+	good := []PreferDimension{
+		{Label: "resolution", Order: []string{"1080p"}},
+		{Label: "repack", Direction: PreferHigher},
+		{Label: PseudoLabelSize, Target: "4GB"},
+		{Label: PseudoLabelSize, Direction: PreferLower},
+		{Label: PseudoLabelSeeders, Direction: PreferHigher},
+		{Label: PseudoLabelPublished, Direction: PreferHigher},
+		{Label: PseudoLabelFeed, Order: []string{"TrackerA", "TrackerB"}},
+	}
+	for _, d := range good {
+		if err := d.Validate(); err != nil {
+			t.Errorf("%+v: unexpected error %v", d, err)
+		}
+	}
+	bad := []PreferDimension{
+		{Order: []string{"1080p"}},
+		{Label: "$ratio", Direction: PreferHigher},
+		{Label: "repack", Direction: "up"},
+		{Label: "repack", Direction: PreferHigher, Target: "2"},
+		{Label: "resolution", Order: []string{"1080p"}, Direction: PreferLower},
+		{Label: PseudoLabelSize, Target: "big"},
+		{Label: "version", Target: "v2"},
+		{Label: PseudoLabelFeed, Direction: PreferHigher},
+	}
+	for _, d := range bad {
+		if err := d.Validate(); err == nil {
+			t.Errorf("%+v: expected an error", d)
+		}
+	}
+}
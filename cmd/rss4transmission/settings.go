@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hekmon/transmissionrpc/v3"
+	str2duration "github.com/xhit/go-str2duration/v2"
+)
+
+// TorrentSettings are set on a torrent as it is added to Transmission. An
+// empty field leaves Transmission's own default. A Group's settings override
+// the feed's for the winners it matches.
+type TorrentSettings struct {
+	// Paused adds the torrent without starting it.
+	Paused *bool `koanf:"Paused"`
+	// Priority is the bandwidth priority: low, normal or high.
+	Priority string `koanf:"Priority"`
+	// QueuePosition is top, bottom or a position in the queue, 0 being the
+	// top.
+	QueuePosition string `koanf:"QueuePosition"`
+	// SeedRatio is the ratio to stop seeding at, "unlimited", or "global"
+	// for Transmission's own.
+	SeedRatio string `koanf:"SeedRatio"`
+	// SeedIdle is how long the torrent may seed without a peer, e.g. 2h,
+	// "unlimited", or "global" for Transmission's own.
+	SeedIdle string `koanf:"SeedIdle"`
+	// UploadLimit and DownloadLimit are speed limits in kB/s, or
+	// "unlimited".
+	UploadLimit   string `koanf:"UploadLimit"`
+	DownloadLimit string `koanf:"DownloadLimit"`
+	// PeerLimit caps the torrent's peers.
+	PeerLimit int64 `koanf:"PeerLimit"`
+}
+
+// Values of the TorrentSettings that are not numbers.
+const (
+	settingGlobal    = "global"
+	settingUnlimited = "unlimited"
+	queueTop         = "top"
+	queueBottom      = "bottom"
+)
+
+var bandwidthPriorities = map[string]int64{"low": -1, "normal": 0, "high": 1}
+
+// Validate parses every setting, so loadConfig can reject a bad one.
+func (s *TorrentSettings) Validate() error {
+	if _, err := s.addPayload(); err != nil {
+		return fmt.Errorf("Torrent: %w", err)
+	}
+	if _, _, err := s.setPayload(); err != nil {
+		return fmt.Errorf("Torrent: %w", err)
+	}
+	return nil
+}
+
+// over returns s with the settings over sets in place of its own.
+func (s TorrentSettings) over(over TorrentSettings) TorrentSettings {
+	if over.Paused != nil {
+		s.Paused = over.Paused
+	}
+	for _, f := range []struct{ dst, src *string }{
+		{&s.Priority, &over.Priority},
+		{&s.QueuePosition, &over.QueuePosition},
+		{&s.SeedRatio, &over.SeedRatio},
+		{&s.SeedIdle, &over.SeedIdle},
+		{&s.UploadLimit, &over.UploadLimit},
+		{&s.DownloadLimit, &over.DownloadLimit},
+	} {
+		if *f.src != "" {
+			*f.dst = *f.src
+		}
+	}
+	if over.PeerLimit != 0 {
+		s.PeerLimit = over.PeerLimit
+	}
+	return s
+}
+
+// torrentSettings returns the feed's Torrent settings with those of the
+// Groups matching any of labelSets over them. Where several groups set a
+// value, the first in config order wins.
+func (m *Feed) torrentSettings(labelSets []map[string]string) TorrentSettings {
+	settings := m.Torrent
+	for i := len(m.Groups) - 1; i >= 0; i-- {
+		g := m.Groups[i]
+		for _, labels := range labelSets {
+			if g.Matches(labels) {
+				settings = settings.over(g.Torrent)
+				break
+			}
+		}
+	}
+	return settings
+}
+
+// coverageLabels returns the label set of each of covs.
+func coverageLabels(covs []coverage) []map[string]string {
+	labelSets := make([]map[string]string, len(covs))
+	for i, cov := range covs {
+		labelSets[i] = cov.labels
+	}
+	return labelSets
+}
+
+// addPayload returns the settings torrent-add takes itself.
+func (s *TorrentSettings) addPayload() (transmissionrpc.TorrentAddPayload, error) {
+	var payload transmissionrpc.TorrentAddPayload
+	payload.Paused = s.Paused
+	if s.Priority != "" {
+		priority, ok := bandwidthPriorities[s.Priority]
+		if !ok {
+			return payload, fmt.Errorf("Priority must be low, normal or high, got %q", s.Priority)
+		}
+		payload.BandwidthPriority = &priority
+	}
+	if s.PeerLimit < 0 {
+		return payload, fmt.Errorf("PeerLimit %d must not be negative", s.PeerLimit)
+	}
+	if s.PeerLimit > 0 {
+		payload.PeerLimit = &s.PeerLimit
+	}
+	return payload, nil
+}
+
+// setPayload returns the settings a torrent-set has to make once the torrent
+// is added, and whether it is to move to the top or the bottom of the queue,
+// which takes a queue-move instead.
+func (s *TorrentSettings) setPayload() (payload transmissionrpc.TorrentSetPayload, queueMove string, err error) {
+	switch s.QueuePosition {
+	case "":
+	case queueTop, queueBottom:
+		queueMove = s.QueuePosition
+	default:
+		pos, err := strconv.ParseInt(s.QueuePosition, 10, 64)
+		if err != nil || pos < 0 {
+			return payload, "", fmt.Errorf("QueuePosition must be %q, %q or a position from 0, got %q", queueTop, queueBottom, s.QueuePosition)
+		}
+		payload.QueuePosition = &pos
+	}
+
+	switch s.SeedRatio {
+	case "":
+	case settingGlobal, settingUnlimited:
+		mode := transmissionrpc.SeedRatioModeGlobal
+		if s.SeedRatio == settingUnlimited {
+			mode = transmissionrpc.SeedRatioModeNoRatio
+		}
+		payload.SeedRatioMode = &mode
+	default:
+		ratio, err := strconv.ParseFloat(s.SeedRatio, 64)
+		if err != nil || ratio < 0 {
+			return payload, "", fmt.Errorf("SeedRatio must be a ratio, %q or %q, got %q", settingUnlimited, settingGlobal, s.SeedRatio)
+		}
+		mode := transmissionrpc.SeedRatioModeCustom
+		payload.SeedRatioMode = &mode
+		payload.SeedRatioLimit = &ratio
+	}
+
+	switch s.SeedIdle {
+	case "":
+	case settingGlobal, settingUnlimited:
+		// Seed idle modes number the same as the ratio modes.
+		mode := int64(transmissionrpc.SeedRatioModeGlobal)
+		if s.SeedIdle == settingUnlimited {
+			mode = int64(transmissionrpc.SeedRatioModeNoRatio)
+		}
+		payload.SeedIdleMode = &mode
+	default:
+		idle, err := str2duration.ParseDuration(s.SeedIdle)
+		if err != nil || idle < time.Minute {
+			return payload, "", fmt.Errorf("SeedIdle must be a duration of a minute or more, %q or %q, got %q", settingUnlimited, settingGlobal, s.SeedIdle)
+		}
+		mode := int64(transmissionrpc.SeedRatioModeCustom)
+		payload.SeedIdleMode = &mode
+		payload.SeedIdleLimit = &idle
+	}
+
+	if payload.UploadLimit, payload.UploadLimited, err = parseSpeedLimit("UploadLimit", s.UploadLimit); err != nil {
+		return payload, "", err
+	}
+	if payload.DownloadLimit, payload.DownloadLimited, err = parseSpeedLimit("DownloadLimit", s.DownloadLimit); err != nil {
+		return payload, "", err
+	}
+	return payload, queueMove, nil
+}
+
+// parseSpeedLimit parses a speed limit in kB/s, or "unlimited", into
+// torrent-set's limit and whether it is honored. Empty leaves both unset.
+func parseSpeedLimit(field, value string) (*int64, *bool, error) {
+	switch value {
+	case "":
+		return nil, nil, nil
+	case settingUnlimited:
+		limited := false
+		return nil, &limited, nil
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit < 0 {
+		return nil, nil, fmt.Errorf("%s must be a speed in kB/s or %q, got %q", field, settingUnlimited, value)
+	}
+	limited := true
+	return &limit, &limited, nil
+}
+
+// apply makes the settings torrent-add cannot on the torrent id has just been
+// added as. A failure is only logged: the torrent is in Transmission either
+// way.
+func (s *TorrentSettings) apply(ctx *RunContext, id int64, title string) {
+	payload, queueMove, err := s.setPayload()
+	if err != nil {
+		log.WithError(err).Errorf("Unable to apply the torrent settings of %s", title)
+		return
+	}
+	if payload.QueuePosition != nil || payload.SeedRatioMode != nil || payload.SeedIdleMode != nil ||
+		payload.UploadLimited != nil || payload.DownloadLimited != nil {
+		payload.IDs = []int64{id}
+		if err := ctx.Tx().TorrentSet(context.TODO(), payload); err != nil {
+			log.WithError(err).Warnf("Unable to apply the torrent settings of %s", title)
+		}
+	}
+	switch queueMove {
+	case queueTop:
+		err = ctx.Tx().QueueMoveTop(context.TODO(), []int64{id})
+	case queueBottom:
+		err = ctx.Tx().QueueMoveBottom(context.TODO(), []int64{id})
+	}
+	if err != nil {
+		log.WithError(err).Warnf("Unable to move %s to the %s of the queue", title, queueMove)
+	}
+}
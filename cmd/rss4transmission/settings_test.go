@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hekmon/transmissionrpc/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rpcCall is one request made to methodRecordingTransmission.
+type rpcCall struct {
+	Method    string
+	Arguments map[string]any
+}
+
+// methodRecordingTransmission is a fake Transmission that records every
+// request but the already-have and disk-space checks' reads, and adds each
+// torrent as ID 7.
+func methodRecordingTransmission(t *testing.T, calls *[]rpcCall) *RunContext {
+	t.Helper()
+	const sessionID = "test-session-id"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Transmission-Session-Id") != sessionID {
+			w.Header().Set("X-Transmission-Session-Id", sessionID)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		var req struct {
+			Method    string         `json:"method"`
+			Tag       int            `json:"tag"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &req))
+		switch req.Method {
+		case "torrent-get", "session-get", "free-space":
+		default:
+			*calls = append(*calls, rpcCall{Method: req.Method, Arguments: req.Arguments})
+		}
+
+		args := map[string]any{}
+		if req.Method == "torrent-add" {
+			args["torrent-added"] = map[string]any{"id": 7}
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]any{
+			"result": "success", "tag": req.Tag, "arguments": args,
+		}))
+	}))
+	t.Cleanup(srv.Close)
+	endpoint, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	client, err := transmissionrpc.New(endpoint, nil)
+	require.NoError(t, err)
+	return &RunContext{Cache: emptyCache(), transmission: client}
+}
+
+func TestTorrentSettings_Validate(t *testing.T) {
+	valid := []TorrentSettings{
+		{},
+		{Priority: "high", QueuePosition: "top", SeedRatio: "1.5", SeedIdle: "2h", UploadLimit: "500", DownloadLimit: "unlimited", PeerLimit: 40},
+		{QueuePosition: "3", SeedRatio: "unlimited", SeedIdle: "global"},
+	}
+	for _, s := range valid {
+		assert.NoError(t, s.Validate(), "%+v", s)
+	}
+
+	invalid := map[string]TorrentSettings{
+		"Priority":      {Priority: "urgent"},
+		"QueuePosition": {QueuePosition: "-1"},
+		"SeedRatio":     {SeedRatio: "lots"},
+		"SeedIdle":      {SeedIdle: "30s"},
+		"UploadLimit":   {UploadLimit: "1MB"},
+		"DownloadLimit": {DownloadLimit: "-5"},
+		"PeerLimit":     {PeerLimit: -1},
+	}
+	for field, s := range invalid {
+		assert.ErrorContains(t, s.Validate(), field)
+	}
+}
+
+// The first matching group to set a value wins over the feed's and over
+// later groups.
+func TestFeedTorrentSettings_GroupsOverFeed(t *testing.T) {
+	paused := true
+	feedCfg := Feed{
+		Torrent: TorrentSettings{Priority: "normal", SeedRatio: "2", Paused: &paused},
+		Groups: []Group{
+			{Require: map[string][]string{"class": {"MotoGP"}}, Torrent: TorrentSettings{Priority: "high", QueuePosition: "top"}},
+			{Require: map[string][]string{"class": {"Moto3"}}, Torrent: TorrentSettings{Priority: "low", QueuePosition: "bottom"}},
+			{Require: map[string][]string{}, Torrent: TorrentSettings{Priority: "low", SeedRatio: "1"}},
+		},
+	}
+
+	motogp := feedCfg.torrentSettings([]map[string]string{{"class": "MotoGP"}})
+	assert.Equal(t, "high", motogp.Priority)
+	assert.Equal(t, "top", motogp.QueuePosition)
+	assert.Equal(t, "1", motogp.SeedRatio, "set by the catch-all group only")
+	assert.Equal(t, &paused, motogp.Paused, "set by the feed only")
+
+	moto3 := feedCfg.torrentSettings([]map[string]string{{"class": "Moto3"}})
+	assert.Equal(t, "low", moto3.Priority)
+	assert.Equal(t, "bottom", moto3.QueuePosition)
+
+	bundle := feedCfg.torrentSettings([]map[string]string{{"class": "Moto3"}, {"class": "MotoGP"}})
+	assert.Equal(t, "high", bundle.Priority, "a bundle takes the first group any of its keys matches")
+}
+
+func TestDispatch_AppliesTorrentSettings(t *testing.T) {
+	var calls []rpcCall
+	ctx := methodRecordingTransmission(t, &calls)
+	paused := true
+	feedCfg := Feed{
+		Identity: []string{"round"},
+		Torrent:  TorrentSettings{Paused: &paused, SeedRatio: "2", SeedIdle: "90m", UploadLimit: "500", PeerLimit: 30},
+		Groups: []Group{
+			{Require: map[string][]string{"class": {"MotoGP"}}, Torrent: TorrentSettings{Priority: "high", QueuePosition: "top"}},
+		},
+	}
+	c := bundleCandidate(t)
+	c.torrentBytes = buildMultiFileTorrent("RD01", [][]string{{"a"}, {"b"}, {"c"}, {"d"}})
+
+	assert.True(t, (&OnceCmd{}).dispatch(ctx, feedCfg, "F", c, []string{"round=RD01"}))
+	require.Len(t, calls, 3)
+
+	assert.Equal(t, "torrent-add", calls[0].Method)
+	assert.Equal(t, true, calls[0].Arguments["paused"])
+	assert.Equal(t, float64(1), calls[0].Arguments["bandwidthPriority"])
+	assert.Equal(t, float64(30), calls[0].Arguments["peer-limit"])
+
+	assert.Equal(t, "torrent-set", calls[1].Method)
+	assert.Equal(t, []any{float64(7)}, calls[1].Arguments["ids"])
+	assert.Equal(t, float64(transmissionrpc.SeedRatioModeCustom), calls[1].Arguments["seedRatioMode"])
+	assert.Equal(t, float64(2), calls[1].Arguments["seedRatioLimit"])
+	assert.Equal(t, float64(90), calls[1].Arguments["seedIdleLimit"])
+	assert.Equal(t, float64(500), calls[1].Arguments["uploadLimit"])
+	assert.Equal(t, true, calls[1].Arguments["uploadLimited"])
+	assert.NotContains(t, calls[1].Arguments, "downloadLimited")
+
+	assert.Equal(t, "queue-move-top", calls[2].Method)
+	assert.Equal(t, []any{float64(7)}, calls[2].Arguments["ids"])
+}
+
+func TestDispatch_NoTorrentSettingsAddsOnly(t *testing.T) {
+	var calls []rpcCall
+	ctx := methodRecordingTransmission(t, &calls)
+	feedCfg := Feed{Identity: []string{"round"}, Groups: []Group{{Require: map[string][]string{}}}}
+	c := bundleCandidate(t)
+	c.torrentBytes = buildMultiFileTorrent("RD01", [][]string{{"a"}, {"b"}, {"c"}, {"d"}})
+
+	assert.True(t, (&OnceCmd{}).dispatch(ctx, feedCfg, "F", c, []string{"round=RD01"}))
+	require.Len(t, calls, 1)
+	assert.Equal(t, "torrent-add", calls[0].Method)
+	assert.NotContains(t, calls[0].Arguments, "paused")
+}
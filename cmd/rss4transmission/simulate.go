@@ -62,13 +62,13 @@ func (cmd *SimulateCmd) Run(ctx *RunContext) error {
 		// Phase 1: pre-filter + title label extraction.
 		var candidates []*candidate
 		for _, item := range batch {
-			fi := &FeedItem{Feed: cmd.Feed, Item: item}
+			fi := &FeedItem{Feed: cmd.Feed, Item: item, client: feedCfg.Client()}
 			if ok, _ := feedCfg.Check(item); !ok {
 				continue
 			}
 			candidates = append(candidates, &candidate{
 				item:        fi,
-				titleLabels: extractor.ExtractLabels(item.Title),
+				titleLabels: feedCfg.ItemLabels(extractor, item),
 				defaults:    extractor.Defaults(),
 			})
 		}
@@ -81,12 +81,13 @@ func (cmd *SimulateCmd) Run(ctx *RunContext) error {
 				continue
 			}
 			c.torrentBytes = torrentBytes
-			fileNames, parseErr := TorrentFileNames(torrentBytes)
+			meta, parseErr := ParseMetaInfo(torrentBytes)
 			if parseErr != nil {
 				log.WithError(parseErr).Debugf("Unable to parse torrent for %s", c.item.Item.Title)
 				continue
 			}
-			c.fileLabels = extractor.ExtractFromFiles(fileNames)
+			c.setMeta(meta)
+			c.extractFileLabels(extractor)
 		}
 
 		// Phases 3+4: select winners, write all torrent files, log and cache winners.
@@ -635,8 +635,8 @@ func (c *cacheBuster) token() string {
 // http.DefaultClient and calls NewUserConfig, which sets that client's Transport
 // to the Speedtest itself -- and it does both before it applies any option, so
 // WithDoer redirects later requests without undoing the assignment. Left alone,
-// every http.DefaultClient caller in this process (Gluetun.control,
-// fetchTorrentBytes) moves onto the VPN proxy after the first measurement.
+// every http.DefaultClient caller in this process (Gluetun.control among
+// them) moves onto the VPN proxy after the first measurement.
 // Saving and restoring the field is racy in principle, but the window spans one
 // constructor with no I/O in it.
 func newSpeedtestClient(cfg SpeedTestConfig, threads int) *speedtest.Speedtest {
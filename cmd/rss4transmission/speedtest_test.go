@@ -1078,7 +1078,7 @@ func TestCacheBuster_DoesNotMutateRequest(t *testing.T) {
 // speedtest-go's New() assigns its doer to http.DefaultClient and NewUserConfig
 // points that client's Transport at the Speedtest -- before any option runs, so
 // WithDoer does not undo it. Left alone, every http.DefaultClient user in this
-// process (Gluetun.control, fetchTorrentBytes) moves onto the VPN proxy after
+// process (Gluetun.control among them) moves onto the VPN proxy after
 // the first measurement.
 func TestNewSpeedtestClient_LeavesDefaultClientAlone(t *testing.T) {
 	before := http.DefaultClient.Transport
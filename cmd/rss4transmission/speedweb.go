@@ -131,7 +131,8 @@ type speedActions struct {
 }
 
 // registerSpeedRoutes adds GET /speedtest, GET /rotations, GET /metrics and the
-// speedtest page's two action routes to mux. All are intended for the private mux only: like GET /,
+// speedtest page's two action routes to mux. /metrics also reports the feed
+// scheduler's state when schedule is non-nil. All are intended for the private mux only: like GET /,
 // they are unauthenticated and rely on --private-listen not being publicly
 // reachable.
 //
@@ -140,6 +141,7 @@ type speedActions struct {
 // a page with nothing to show is worse than a 404.
 func registerSpeedRoutes(mux *http.ServeMux, speed func() *SpeedFile, portOpen portOpenFunc,
 	peerPort peerPortFunc, exitIP func() exitIPFunc, actions func() speedActions, nav navConfig,
+	schedule func() []FeedSchedule,
 ) {
 	// speed, actions and exitIP are getters because a config reload rebuilds
 	// the speed monitor, which replaces the store, the action funcs and the
@@ -236,7 +238,11 @@ func registerSpeedRoutes(mux *http.ServeMux, speed func() *SpeedFile, portOpen p
 
 	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
-		_, _ = w.Write([]byte(renderMetrics(liveSpeed(), portOpen)))
+		var feeds []FeedSchedule
+		if schedule != nil {
+			feeds = schedule()
+		}
+		_, _ = w.Write([]byte(renderMetrics(liveSpeed(), portOpen, feeds)))
 	})
 }
 
@@ -412,7 +418,7 @@ func buildRotationRows(speed *SpeedFile) []speedPageRotation {
 // renderMetrics emits the Prometheus text exposition format by hand. The repo
 // has no metrics dependency and this is a handful of values, so pulling in
 // client_golang would cost more than it saves.
-func renderMetrics(speed *SpeedFile, portOpen portOpenFunc) string {
+func renderMetrics(speed *SpeedFile, portOpen portOpenFunc, feeds []FeedSchedule) string {
 	var b strings.Builder
 
 	gauge := func(name, help string, value float64) {
@@ -479,5 +485,51 @@ func renderMetrics(speed *SpeedFile, portOpen portOpenFunc) string {
 		}
 	}
 
+	if len(feeds) > 0 {
+		renderFeedMetrics(&b, feeds)
+	}
+
 	return b.String()
 }
+
+// renderFeedMetrics writes one series per feed for each scheduler gauge. A feed
+// not yet fetched has no last-fetch or next-due sample, rather than a zero
+// that would read as 1970.
+func renderFeedMetrics(b *strings.Builder, feeds []FeedSchedule) {
+	series := func(name, help string, value func(FeedSchedule) (float64, bool)) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, f := range feeds {
+			if v, ok := value(f); ok {
+				fmt.Fprintf(b, "%s{feed=\"%s\"} %s\n", name, escapeLabelValue(f.Feed),
+					strconv.FormatFloat(v, 'g', -1, 64))
+			}
+		}
+	}
+
+	series("rss4transmission_feed_interval_seconds",
+		"Configured polling interval of the feed.",
+		func(f FeedSchedule) (float64, bool) { return f.Interval.Seconds(), true })
+	series("rss4transmission_feed_last_fetch_timestamp_seconds",
+		"Unix timestamp of the feed's last fetch attempt.",
+		func(f FeedSchedule) (float64, bool) { return float64(f.LastFetch.Unix()), !f.LastFetch.IsZero() })
+	series("rss4transmission_feed_next_due_timestamp_seconds",
+		"Unix timestamp the feed is next due to be fetched.",
+		func(f FeedSchedule) (float64, bool) { return float64(f.NextDue.Unix()), !f.NextDue.IsZero() })
+	series("rss4transmission_feed_last_fetch_failed",
+		"1 if the feed's last fetch attempt failed.",
+		func(f FeedSchedule) (float64, bool) {
+			if f.LastFetch.IsZero() {
+				return 0, false
+			}
+			if f.LastError != "" {
+				return 1, true
+			}
+			return 0, true
+		})
+}
+
+// escapeLabelValue escapes a Prometheus label value: backslash, double quote
+// and newline.
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
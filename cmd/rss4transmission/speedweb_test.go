@@ -13,7 +13,7 @@ import (
 func speedMux(t *testing.T, s *SpeedFile, portOpen func() (bool, bool)) *http.ServeMux {
 	t.Helper()
 	mux := http.NewServeMux()
-	registerSpeedRoutes(mux, staticSpeed(s), portOpen, nil, nil, staticActions(speedActions{}), navConfig{})
+	registerSpeedRoutes(mux, staticSpeed(s), portOpen, nil, nil, staticActions(speedActions{}), navConfig{}, nil)
 	return mux
 }
 
@@ -144,7 +144,7 @@ func TestMetrics_EmptyStore(t *testing.T) {
 
 func TestMetrics_NilStore(t *testing.T) {
 	mux := http.NewServeMux()
-	registerSpeedRoutes(mux, staticSpeed(nil), nil, nil, nil, staticActions(speedActions{}), navConfig{})
+	registerSpeedRoutes(mux, staticSpeed(nil), nil, nil, nil, staticActions(speedActions{}), navConfig{}, nil)
 	code, _ := getBody(t, mux, "/metrics")
 	if code != http.StatusOK {
 		t.Errorf("status = %d with a nil store, want 200", code)
@@ -207,7 +207,7 @@ func TestRotationsPage_FlagsUnchangedExit(t *testing.T) {
 
 func TestSpeedTestPage_NilStoreNotRegistered(t *testing.T) {
 	mux := http.NewServeMux()
-	registerSpeedRoutes(mux, staticSpeed(nil), nil, nil, nil, staticActions(speedActions{}), navConfig{})
+	registerSpeedRoutes(mux, staticSpeed(nil), nil, nil, nil, staticActions(speedActions{}), navConfig{}, nil)
 	code, _ := getBody(t, mux, "/speedtest")
 	if code != http.StatusNotFound {
 		t.Errorf("status = %d with a nil store, want 404", code)
@@ -269,7 +269,7 @@ func TestPortMonitor_LastOpenReflectsLastCheck(t *testing.T) {
 func actionMux(t *testing.T, actions speedActions) *http.ServeMux {
 	t.Helper()
 	mux := http.NewServeMux()
-	registerSpeedRoutes(mux, staticSpeed(tempSpeedFile(t)), nil, nil, nil, staticActions(actions), navConfig{})
+	registerSpeedRoutes(mux, staticSpeed(tempSpeedFile(t)), nil, nil, nil, staticActions(actions), navConfig{}, nil)
 	return mux
 }
 
@@ -400,7 +400,7 @@ func TestSpeedRotate_NotRegisteredWithoutFunc(t *testing.T) {
 func TestSpeedTestPage_RendersOnlyAvailableButtons(t *testing.T) {
 	mux := http.NewServeMux()
 	registerSpeedRoutes(mux, staticSpeed(tempSpeedFile(t)), nil, nil, nil,
-		staticActions(speedActions{Run: func() bool { return true }}), navConfig{})
+		staticActions(speedActions{Run: func() bool { return true }}), navConfig{}, nil)
 	_, body := getBody(t, mux, "/speedtest")
 	if !strings.Contains(body, `id="btn-run"`) {
 		t.Error("page is missing the run button")
@@ -411,7 +411,7 @@ func TestSpeedTestPage_RendersOnlyAvailableButtons(t *testing.T) {
 
 	mux = http.NewServeMux()
 	registerSpeedRoutes(mux, staticSpeed(tempSpeedFile(t)), nil, nil, nil,
-		staticActions(speedActions{Rotate: func() bool { return true }}), navConfig{})
+		staticActions(speedActions{Rotate: func() bool { return true }}), navConfig{}, nil)
 	_, body = getBody(t, mux, "/speedtest")
 	if !strings.Contains(body, `id="btn-rotate"`) {
 		t.Error("page is missing the rotate button")
@@ -541,7 +541,7 @@ func TestSpeedTestPage_ExitIPTileUsesGluetun(t *testing.T) {
 
 	mux := http.NewServeMux()
 	registerSpeedRoutes(mux, staticSpeed(s), nil, nil,
-		staticExitIP(func() (string, bool) { return "185.9.9.9", true }), staticActions(speedActions{}), navConfig{})
+		staticExitIP(func() (string, bool) { return "185.9.9.9", true }), staticActions(speedActions{}), navConfig{}, nil)
 	_, body := getBody(t, mux, "/speedtest")
 
 	tile := summarySection(t, body)
@@ -590,7 +590,7 @@ func TestSpeedTestPage_ExitIPTileUnknown(t *testing.T) {
 
 	mux := http.NewServeMux()
 	registerSpeedRoutes(mux, staticSpeed(s), nil, nil,
-		staticExitIP(func() (string, bool) { return "", false }), staticActions(speedActions{}), navConfig{})
+		staticExitIP(func() (string, bool) { return "", false }), staticActions(speedActions{}), navConfig{}, nil)
 	_, body := getBody(t, mux, "/speedtest")
 
 	tile := summarySection(t, body)
@@ -805,7 +805,7 @@ func TestRotationsPage_EmptyStore(t *testing.T) {
 // worse than a 404 -- the same call the /speedtest route makes.
 func TestRotationsPage_NilStoreNotRegistered(t *testing.T) {
 	mux := http.NewServeMux()
-	registerSpeedRoutes(mux, staticSpeed(nil), nil, nil, nil, staticActions(speedActions{}), navConfig{})
+	registerSpeedRoutes(mux, staticSpeed(nil), nil, nil, nil, staticActions(speedActions{}), navConfig{}, nil)
 
 	if code, _ := getBody(t, mux, "/rotations"); code != http.StatusNotFound {
 		t.Errorf("status = %d without a speed store, want 404", code)
@@ -883,7 +883,7 @@ func TestSpeedTestPage_PeerPortTilesOpen(t *testing.T) {
 	registerSpeedRoutes(mux, staticSpeed(s),
 		func() (bool, bool) { return true, true },
 		func() (int64, bool) { return 51413, true },
-		nil, staticActions(speedActions{}), navConfig{})
+		nil, staticActions(speedActions{}), navConfig{}, nil)
 	_, body := getBody(t, mux, "/speedtest")
 
 	tile := summarySection(t, body)
@@ -909,7 +909,7 @@ func TestSpeedTestPage_PeerPortTileClosed(t *testing.T) {
 	registerSpeedRoutes(mux, staticSpeed(s),
 		func() (bool, bool) { return false, true },
 		func() (int64, bool) { return 51413, true },
-		nil, staticActions(speedActions{}), navConfig{})
+		nil, staticActions(speedActions{}), navConfig{}, nil)
 	_, body := getBody(t, mux, "/speedtest")
 
 	tile := summarySection(t, body)
@@ -928,7 +928,7 @@ func TestSpeedTestPage_PeerPortTilesUnknown(t *testing.T) {
 	registerSpeedRoutes(mux, staticSpeed(s),
 		func() (bool, bool) { return false, false },
 		func() (int64, bool) { return 0, false },
-		nil, staticActions(speedActions{}), navConfig{})
+		nil, staticActions(speedActions{}), navConfig{}, nil)
 	_, body := getBody(t, mux, "/speedtest")
 
 	tile := summarySection(t, body)
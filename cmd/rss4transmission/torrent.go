@@ -1,23 +1,82 @@
 package main
 
 import (
+	"crypto/sha1" //nolint:gosec // the v1 infohash is defined as SHA-1
+	"encoding/hex"
 	"fmt"
+	"path"
 	"strconv"
+	"strings"
 )
 
-// TorrentFileNames returns the file names from a raw .torrent file. For
-// single-file torrents it returns the torrent name. For multi-file torrents it
-// returns the last path component of each file entry.
-func TorrentFileNames(data []byte) ([]string, error) {
-	val, _, err := bencodeDecode(data, 0)
-	if err != nil {
-		return nil, fmt.Errorf("invalid torrent data: %w", err)
+// MetaInfo is what a .torrent file says about its content.
+type MetaInfo struct {
+	// InfoHash is the v1 infohash: the SHA-1 of the info dict exactly as it
+	// appears in the file, as lowercase hex.
+	InfoHash string
+	Name     string
+	// Files lists every file. A single-file torrent has one entry whose
+	// Path is Name.
+	Files       []TorrentFile
+	TotalSize   int64
+	PieceLength int64
+	// Announce is every tracker URL, the announce key first and then the
+	// announce-list tiers in order, without duplicates.
+	Announce []string
+	Private  bool
+	Comment  string
+}
+
+// TorrentFile is one file in a torrent.
+type TorrentFile struct {
+	// Path is the file's path inside the torrent, "/"-separated. For a
+	// multi-file torrent it does not include the torrent's Name.
+	Path   string
+	Length int64
+}
+
+// FileNames returns the last path component of each file, which is what the
+// extractors match against.
+func (m *MetaInfo) FileNames() []string {
+	names := make([]string, 0, len(m.Files))
+	for _, f := range m.Files {
+		names = append(names, path.Base(f.Path))
 	}
-	dict, ok := val.(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("torrent root is not a dict")
+	return names
+}
+
+// ParseMetaInfo parses a raw .torrent file.
+func ParseMetaInfo(data []byte) (*MetaInfo, error) {
+	if len(data) == 0 || data[0] != 'd' {
+		return nil, fmt.Errorf("invalid torrent data: torrent root is not a dict")
 	}
-	infoRaw, ok := dict["info"]
+
+	// The root dict is walked by hand rather than through bencodeDecode so
+	// that the info dict's raw bytes are kept for the infohash: re-encoding
+	// the decoded value would not reproduce a file with unsorted keys.
+	root := map[string]interface{}{}
+	var infoBytes []byte
+	pos := 1
+	for pos < len(data) && data[pos] != 'e' {
+		key, next, err := bencodeDecodeString(data, pos)
+		if err != nil {
+			return nil, fmt.Errorf("invalid torrent data: dict key: %w", err)
+		}
+		val, end, err := bencodeDecode(data, next)
+		if err != nil {
+			return nil, fmt.Errorf("invalid torrent data: dict value for %q: %w", key, err)
+		}
+		if key == "info" {
+			infoBytes = data[next:end]
+		}
+		root[key] = val
+		pos = end
+	}
+	if pos >= len(data) {
+		return nil, fmt.Errorf("invalid torrent data: unterminated dict")
+	}
+
+	infoRaw, ok := root["info"]
 	if !ok {
 		return nil, fmt.Errorf("torrent has no info dict")
 	}
@@ -26,38 +85,112 @@ func TorrentFileNames(data []byte) ([]string, error) {
 		return nil, fmt.Errorf("torrent info is not a dict")
 	}
 
+	sum := sha1.Sum(infoBytes) //nolint:gosec // the v1 infohash is defined as SHA-1
+	m := &MetaInfo{
+		InfoHash: hex.EncodeToString(sum[:]),
+		Comment:  utf8String(root, "comment"),
+	}
+	m.PieceLength, _ = info["piece length"].(int64)
+	if private, ok := info["private"].(int64); ok && private == 1 {
+		m.Private = true
+	}
+
+	if _, ok := info["name"].(string); !ok {
+		return nil, fmt.Errorf("torrent name is not a string")
+	}
+	name := utf8String(info, "name")
+	m.Name = name
+
 	filesRaw, hasFiles := info["files"]
 	if !hasFiles {
 		// Single-file torrent.
-		name, ok := info["name"].(string)
+		length, _ := info["length"].(int64)
+		m.Files = []TorrentFile{{Path: name, Length: length}}
+	} else {
+		// Multi-file torrent.
+		files, ok := filesRaw.([]interface{})
 		if !ok {
-			return nil, fmt.Errorf("torrent name is not a string")
+			return nil, fmt.Errorf("torrent files is not a list")
+		}
+		for _, fileRaw := range files {
+			fileDict, ok := fileRaw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			parts := utf8Path(fileDict)
+			if len(parts) == 0 {
+				continue
+			}
+			length, _ := fileDict["length"].(int64)
+			m.Files = append(m.Files, TorrentFile{Path: strings.Join(parts, "/"), Length: length})
 		}
-		return []string{name}, nil
 	}
-
-	// Multi-file torrent.
-	files, ok := filesRaw.([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("torrent files is not a list")
+	for _, f := range m.Files {
+		if f.Length > 0 {
+			m.TotalSize += f.Length
+		}
 	}
-	var names []string
-	for _, fileRaw := range files {
-		fileDict, ok := fileRaw.(map[string]interface{})
-		if !ok {
-			continue
+
+	seen := map[string]bool{}
+	addTracker := func(v interface{}) {
+		if u, ok := v.(string); ok && u != "" && !seen[u] {
+			seen[u] = true
+			m.Announce = append(m.Announce, u)
 		}
-		pathRaw, ok := fileDict["path"].([]interface{})
-		if !ok || len(pathRaw) == 0 {
-			continue
+	}
+	addTracker(root["announce"])
+	if tiers, ok := root["announce-list"].([]interface{}); ok {
+		for _, tierRaw := range tiers {
+			if tier, ok := tierRaw.([]interface{}); ok {
+				for _, u := range tier {
+					addTracker(u)
+				}
+			}
 		}
-		leaf, ok := pathRaw[len(pathRaw)-1].(string)
+	}
+	return m, nil
+}
+
+// utf8String returns dict[key+".utf-8"] when present, which some clients
+// write alongside a key in a legacy encoding, else dict[key].
+func utf8String(dict map[string]interface{}, key string) string {
+	if s, ok := dict[key+".utf-8"].(string); ok {
+		return s
+	}
+	s, _ := dict[key].(string)
+	return s
+}
+
+// utf8Path returns a file entry's path components, preferring path.utf-8.
+// It returns nil if any component is not a string.
+func utf8Path(fileDict map[string]interface{}) []string {
+	raw, ok := fileDict["path.utf-8"].([]interface{})
+	if !ok {
+		raw, ok = fileDict["path"].([]interface{})
+	}
+	if !ok {
+		return nil
+	}
+	parts := make([]string, 0, len(raw))
+	for _, p := range raw {
+		s, ok := p.(string)
 		if !ok {
-			continue
+			return nil
 		}
-		names = append(names, leaf)
+		parts = append(parts, s)
+	}
+	return parts
+}
+
+// TorrentFileNames returns the file names from a raw .torrent file. For
+// single-file torrents it returns the torrent name. For multi-file torrents it
+// returns the last path component of each file entry.
+func TorrentFileNames(data []byte) ([]string, error) {
+	m, err := ParseMetaInfo(data)
+	if err != nil {
+		return nil, err
 	}
-	return names, nil
+	return m.FileNames(), nil
 }
 
 // bencodeDecode decodes a single bencoded value from data starting at pos.
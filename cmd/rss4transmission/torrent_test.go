@@ -1,7 +1,10 @@
 package main
 
 import (
+	"crypto/sha1" //nolint:gosec
+	"encoding/hex"
 	"fmt"
+	"reflect"
 	"testing"
 )
 
@@ -128,3 +131,106 @@ func TestTorrentFileNames_NestedPath(t *testing.T) {
 		t.Errorf("name = %q, want leaf file name", names[0])
 	}
 }
+
+func TestParseMetaInfo_MultiFile(t *testing.T) {
+	info := "d" +
+		bencodeString("files") + "l" +
+		"d" + bencodeString("length") + bencodeInt(700) +
+		bencodeString("path") + "l" + bencodeString("Race") + bencodeString("MotoGP.mkv") + "e" + "e" +
+		"d" + bencodeString("length") + bencodeInt(300) +
+		bencodeString("path") + "l" + bencodeString("Moto2.mkv") + "e" + "e" +
+		"e" +
+		bencodeString("name") + bencodeString("RD01") +
+		bencodeString("piece length") + bencodeInt(262144) +
+		bencodeString("pieces") + bencodeString("xxxx") +
+		bencodeString("private") + bencodeInt(1) +
+		"e"
+	data := []byte("d" +
+		bencodeString("announce") + bencodeString("http://a/announce") +
+		bencodeString("announce-list") + "l" +
+		"l" + bencodeString("http://a/announce") + bencodeString("http://b/announce") + "e" +
+		"l" + bencodeString("udp://c:80") + "e" +
+		"e" +
+		bencodeString("comment") + bencodeString("Qatar") +
+		bencodeString("info") + info +
+		"e")
+
+	m, err := ParseMetaInfo(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sum := sha1.Sum([]byte(info)) //nolint:gosec
+	if want := hex.EncodeToString(sum[:]); m.InfoHash != want {
+		t.Errorf("InfoHash = %s, want %s", m.InfoHash, want)
+	}
+	if m.Name != "RD01" || m.PieceLength != 262144 || !m.Private || m.Comment != "Qatar" {
+		t.Errorf("unexpected metainfo: %+v", m)
+	}
+	wantFiles := []TorrentFile{{Path: "Race/MotoGP.mkv", Length: 700}, {Path: "Moto2.mkv", Length: 300}}
+	if !reflect.DeepEqual(m.Files, wantFiles) {
+		t.Errorf("Files = %+v, want %+v", m.Files, wantFiles)
+	}
+	if m.TotalSize != 1000 {
+		t.Errorf("TotalSize = %d, want 1000", m.TotalSize)
+	}
+	wantAnnounce := []string{"http://a/announce", "http://b/announce", "udp://c:80"}
+	if !reflect.DeepEqual(m.Announce, wantAnnounce) {
+		t.Errorf("Announce = %v, want %v", m.Announce, wantAnnounce)
+	}
+	if names := m.FileNames(); !reflect.DeepEqual(names, []string{"MotoGP.mkv", "Moto2.mkv"}) {
+		t.Errorf("FileNames = %v", names)
+	}
+}
+
+func TestParseMetaInfo_SingleFile(t *testing.T) {
+	m, err := ParseMetaInfo(buildSingleFileTorrent("Race.mkv"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(m.Files) != 1 || m.Files[0].Path != "Race.mkv" || m.TotalSize != 1000000 {
+		t.Errorf("unexpected files: %+v, total %d", m.Files, m.TotalSize)
+	}
+	if m.Private {
+		t.Error("a torrent without the private key is public")
+	}
+	if len(m.InfoHash) != 40 {
+		t.Errorf("InfoHash = %q, want 40 hex digits", m.InfoHash)
+	}
+}
+
+// The infohash covers the info dict's bytes as written, so a file whose keys
+// are out of order still hashes to what its tracker expects.
+func TestParseMetaInfo_InfoHashUsesRawBytes(t *testing.T) {
+	info := "d" +
+		bencodeString("pieces") + bencodeString("xxxx") +
+		bencodeString("name") + bencodeString("x") +
+		bencodeString("length") + bencodeInt(1) +
+		"e"
+	m, err := ParseMetaInfo([]byte("d" + bencodeString("info") + info + "e"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sum := sha1.Sum([]byte(info)) //nolint:gosec
+	if m.InfoHash != hex.EncodeToString(sum[:]) {
+		t.Error("infohash must be computed from the raw info dict bytes")
+	}
+}
+
+func TestParseMetaInfo_PrefersUTF8Keys(t *testing.T) {
+	info := "d" +
+		bencodeString("files") + "l" +
+		"d" + bencodeString("length") + bencodeInt(1) +
+		bencodeString("path") + "l" + bencodeString("legacy.mkv") + "e" +
+		bencodeString("path.utf-8") + "l" + bencodeString("Grand Prix été.mkv") + "e" + "e" +
+		"e" +
+		bencodeString("name") + bencodeString("legacy") +
+		bencodeString("name.utf-8") + bencodeString("été") +
+		"e"
+	m, err := ParseMetaInfo([]byte("d" + bencodeString("info") + info + "e"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.Name != "été" || m.Files[0].Path != "Grand Prix été.mkv" {
+		t.Errorf("got Name %q, Path %q", m.Name, m.Files[0].Path)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const (
+	// FeedTypeRSS is a static RSS URL. It is the default.
+	FeedTypeRSS = "rss"
+	// FeedTypeTorznab is a search run against a Torznab API endpoint, such as
+	// a Jackett or Prowlarr indexer.
+	FeedTypeTorznab = "torznab"
+)
+
+// torznabModes are the Torznab functions (the t= parameter) a feed can run.
+var torznabModes = []string{"search", "tvsearch", "movie"}
+
+// torznabLabelAttrs are the torznab:attr names a Type: torznab feed exposes as
+// labels on its candidates.
+var torznabLabelAttrs = []string{"seeders", "peers", "size", "infohash", "category", "imdb", "grabs"}
+
+// TorznabQuery is the search a Type: torznab feed runs. The feed's URL is the
+// indexer's API endpoint, e.g.
+// http://jackett:9117/api/v2.0/indexers/all/results/torznab/api.
+type TorznabQuery struct {
+	APIKey     string            `koanf:"APIKey"`
+	Mode       string            `koanf:"Mode"`
+	Query      string            `koanf:"Query"`
+	Categories []string          `koanf:"Categories"`
+	Limit      int               `koanf:"Limit"`
+	Params     map[string]string `koanf:"Params"`
+}
+
+// torznabReservedParams are set from TorznabQuery's own fields, so Params may
+// not set them a second time.
+var torznabReservedParams = []string{"t", "apikey", "q", "cat", "limit", "extended"}
+
+// Validate checks the query can be turned into a request.
+func (q *TorznabQuery) Validate() error {
+	if q.Mode != "" && !slices.Contains(torznabModes, q.Mode) {
+		return fmt.Errorf("Torznab.Mode must be one of %s, got %q", strings.Join(torznabModes, ", "), q.Mode)
+	}
+	if q.Limit < 0 {
+		return fmt.Errorf("Torznab.Limit must not be negative, got %d", q.Limit)
+	}
+	for k := range q.Params {
+		if slices.Contains(torznabReservedParams, strings.ToLower(k)) {
+			return fmt.Errorf("Torznab.Params cannot set %q, it has its own field", k)
+		}
+	}
+	return nil
+}
+
+// requestURL adds the query's parameters to the API endpoint at base. Any
+// query string already on base is kept.
+func (q *TorznabQuery) requestURL(base string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse Torznab URL %q: %w", base, err)
+	}
+
+	values := u.Query()
+	mode := q.Mode
+	if mode == "" {
+		mode = "search"
+	}
+	values.Set("t", mode)
+	if q.APIKey != "" {
+		values.Set("apikey", q.APIKey)
+	}
+	if q.Query != "" {
+		values.Set("q", q.Query)
+	}
+	if len(q.Categories) > 0 {
+		values.Set("cat", strings.Join(q.Categories, ","))
+	}
+	if q.Limit > 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+	// Without extended=1 an indexer may leave out the attrs the labels and
+	// the size filter are built from.
+	values.Set("extended", "1")
+	for k, v := range q.Params {
+		values.Set(k, v)
+	}
+	u.RawQuery = values.Encode()
+	return u.String(), nil
+}
+
+// FetchURL is the URL fetched for this feed: URL itself for an RSS feed, and
+// the search request for a Torznab feed. It carries the API key, so log URL
+// rather than this.
+func (m *Feed) FetchURL() string {
+	if m.Type != FeedTypeTorznab {
+		return m.URL
+	}
+	u, err := m.Torznab.requestURL(m.URL)
+	if err != nil {
+		// loadConfig has already rejected an unparseable URL; a feed built
+		// directly fails at the fetch instead.
+		return m.URL
+	}
+	return u
+}
+
+// ItemLabels returns the labels extracted from item's title and the other
+// item fields labels name as their Source. A Torznab feed adds the item's
+// torznab attrs; a label the Extractor defines wins over an attr of the same
+// name.
+func (m *Feed) ItemLabels(extractor *ExtractorSet, item *gofeed.Item) map[string]string {
+	labels := extractor.ExtractItemLabels(item)
+	if m.Type != FeedTypeTorznab {
+		return labels
+	}
+	return MergeLabels(torznabLabels(item), labels)
+}
+
+// torznabLabels returns the item's torznab attrs that are exposed as labels.
+func torznabLabels(item *gofeed.Item) map[string]string {
+	attrs := torznabAttrs(item)
+	labels := map[string]string{}
+	for _, name := range torznabLabelAttrs {
+		if v, ok := attrs[name]; ok && v != "" {
+			labels[name] = v
+		}
+	}
+	return labels
+}
+
+// torznabAttrs returns the item's torznab:attr (or newznab:attr) elements as
+// name → value. Indexers such as Jackett and Prowlarr use them for everything
+// RSS has no element for: seeders, size, infohash, the magnet link.
+//
+// An attr can repeat (an item is usually in more than one category); the
+// first value is kept, which indexers list from the broadest category down.
+func torznabAttrs(item *gofeed.Item) map[string]string {
+	attrs := map[string]string{}
+	for _, prefix := range []string{"torznab", "newznab"} {
+		for _, ext := range item.Extensions[prefix]["attr"] {
+			name := strings.ToLower(ext.Attrs["name"])
+			if name == "" {
+				continue
+			}
+			if _, ok := attrs[name]; !ok {
+				attrs[name] = ext.Attrs["value"]
+			}
+		}
+	}
+	return attrs
+}
+
+// torznabSize returns the item's size attr. ok is false when it has none.
+func torznabSize(item *gofeed.Item) (uint64, bool) {
+	n, err := strconv.ParseUint(torznabAttrs(item)["size"], 10, 64)
+	if err != nil || n == 0 {
+		return 0, false
+	}
+	return n, true
+}
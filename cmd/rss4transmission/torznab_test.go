@@ -0,0 +1,198 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// torznabFixture is a trimmed Jackett t=tvsearch response. The enclosure
+// length of the small item is the .torrent's own size, which is what the size
+// attr exists to correct.
+const torznabFixture = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom" xmlns:torznab="http://torznab.com/schemas/2015/feed">
+<channel><title>Jackett</title>
+<item>
+  <title>MotoGP.2026.Round06.Race.1080p.WEB</title>
+  <guid>https://tracker.example/details/1</guid>
+  <enclosure url="https://tracker.example/dl/1.torrent" length="2147483648" type="application/x-bittorrent"/>
+  <torznab:attr name="category" value="5000"/>
+  <torznab:attr name="category" value="5040"/>
+  <torznab:attr name="size" value="2147483648"/>
+  <torznab:attr name="seeders" value="57"/>
+  <torznab:attr name="peers" value="61"/>
+  <torznab:attr name="grabs" value="312"/>
+  <torznab:attr name="imdb" value="0111161"/>
+  <torznab:attr name="infohash" value="0123456789ABCDEF0123456789ABCDEF01234567"/>
+  <torznab:attr name="downloadvolumefactor" value="0"/>
+</item>
+<item>
+  <title>MotoGP.2026.Round06.Race.720p.WEB</title>
+  <guid>https://tracker.example/details/2</guid>
+  <enclosure url="https://tracker.example/dl/2.torrent" length="40000" type="application/x-bittorrent"/>
+  <torznab:attr name="size" value="400000000"/>
+  <torznab:attr name="seeders" value="3"/>
+</item>
+</channel></rss>`
+
+func TestTorznabQuery_RequestURL(t *testing.T) {
+	q := TorznabQuery{
+		APIKey:     "key",
+		Mode:       "tvsearch",
+		Query:      "MotoGP 2026",
+		Categories: []string{"5000", "5040"},
+		Limit:      50,
+		Params:     map[string]string{"season": "2026", "ep": "6"},
+	}
+	raw, err := q.requestURL("http://jackett:9117/api/v2.0/indexers/all/results/torznab/api?configured=true")
+	require.NoError(t, err)
+
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+	assert.Equal(t, "/api/v2.0/indexers/all/results/torznab/api", u.Path)
+	values := u.Query()
+	assert.Equal(t, "true", values.Get("configured"), "a query string already on URL must be kept")
+	assert.Equal(t, "tvsearch", values.Get("t"))
+	assert.Equal(t, "key", values.Get("apikey"))
+	assert.Equal(t, "MotoGP 2026", values.Get("q"))
+	assert.Equal(t, "5000,5040", values.Get("cat"))
+	assert.Equal(t, "50", values.Get("limit"))
+	assert.Equal(t, "1", values.Get("extended"))
+	assert.Equal(t, "2026", values.Get("season"))
+	assert.Equal(t, "6", values.Get("ep"))
+}
+
+func TestTorznabQuery_DefaultsToSearch(t *testing.T) {
+	raw, err := (&TorznabQuery{}).requestURL("http://indexer/api")
+	require.NoError(t, err)
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+	assert.Equal(t, "search", u.Query().Get("t"))
+	assert.False(t, u.Query().Has("q"))
+}
+
+func TestTorznabQuery_Validate(t *testing.T) {
+	assert.NoError(t, (&TorznabQuery{Mode: "tvsearch"}).Validate())
+	assert.Error(t, (&TorznabQuery{Mode: "caps"}).Validate())
+	assert.Error(t, (&TorznabQuery{Limit: -1}).Validate())
+	assert.Error(t, (&TorznabQuery{Params: map[string]string{"APIKey": "x"}}).Validate(),
+		"Params must not set a parameter that has its own field")
+}
+
+func TestFeedValidate_Type(t *testing.T) {
+	extractors := map[string]*ExtractorSet{"e": {Labels: map[string]LabelDef{}}}
+	f := Feed{Extractor: "e", Identity: []string{"round"}, Groups: []Group{{}}}
+
+	f.Type = "torznab"
+	assert.NoError(t, f.Validate("f", extractors))
+	f.Torznab.Mode = "bogus"
+	assert.Error(t, f.Validate("f", extractors))
+
+	f = Feed{Extractor: "e", Identity: []string{"round"}, Groups: []Group{{}}, Type: "atom"}
+	assert.Error(t, f.Validate("f", extractors))
+}
+
+func TestFeedItemLabels_TorznabAttrsAlongsideExtractor(t *testing.T) {
+	rss, err := gofeed.NewParser().ParseString(torznabFixture)
+	require.NoError(t, err)
+	extractor := &ExtractorSet{Labels: map[string]LabelDef{
+		"resolution": {Regexp: `(1080p|720p)`},
+		// An Extractor label wins over the attr of the same name.
+		"seeders": {Regexp: `(WEB)`},
+	}}
+
+	torznab := Feed{Type: FeedTypeTorznab}
+	labels := torznab.ItemLabels(extractor, rss.Items[0])
+	assert.Equal(t, "1080p", labels["resolution"])
+	assert.Equal(t, "WEB", labels["seeders"])
+	assert.Equal(t, "61", labels["peers"])
+	assert.Equal(t, "312", labels["grabs"])
+	assert.Equal(t, "0111161", labels["imdb"])
+	assert.Equal(t, "2147483648", labels["size"])
+	assert.Equal(t, "5000", labels["category"], "the first of a repeated attr is kept")
+	assert.Equal(t, "0123456789ABCDEF0123456789ABCDEF01234567", labels["infohash"])
+	assert.NotContains(t, labels, "downloadvolumefactor", "only the listed attrs become labels")
+
+	rssFeed := Feed{}
+	assert.NotContains(t, rssFeed.ItemLabels(extractor, rss.Items[0]), "peers",
+		"an RSS feed's labels come from the Extractor alone")
+}
+
+func TestFeedCheck_PrefersTorznabSize(t *testing.T) {
+	rss, err := gofeed.NewParser().ParseString(torznabFixture)
+	require.NoError(t, err)
+
+	f := &Feed{MinSize: "1GB"}
+	ok, _ := f.Check(rss.Items[0])
+	assert.True(t, ok)
+	ok, reason := f.Check(rss.Items[1])
+	assert.False(t, ok, "the size attr, not the enclosure length, is the item's size")
+	assert.Equal(t, "below minimum size", reason)
+	assert.Equal(t, int64(400000000), extractSize(rss.Items[1]))
+}
+
+// A Torznab feed runs its search against the indexer and its candidates carry
+// the attrs as labels all the way into history.
+func TestOnceRun_TorznabFeed(t *testing.T) {
+	var got url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+		w.Header().Set("Content-Type", "application/rss+xml")
+		_, _ = w.Write([]byte(torznabFixture))
+	}))
+	defer srv.Close()
+
+	cache, err := OpenCache(filepath.Join(t.TempDir(), "seen.json"))
+	require.NoError(t, err)
+	extractor := &ExtractorSet{Labels: map[string]LabelDef{
+		"round":      {Regexp: `Round(\d+)`},
+		"resolution": {Regexp: `(1080p|720p)`},
+	}}
+	feedCfg := Feed{
+		Name:      "Indexer",
+		Type:      FeedTypeTorznab,
+		URL:       srv.URL + "/api",
+		Torznab:   TorznabQuery{APIKey: "secret", Mode: "tvsearch", Query: "MotoGP"},
+		Extractor: "motogp",
+		Identity:  []string{"round"},
+		Groups:    []Group{{Require: map[string][]string{"category": {"5000"}}}},
+	}
+	ctx := &RunContext{
+		Config: Config{
+			Feeds:         []Feed{feedCfg},
+			Extractors:    map[string]*ExtractorSet{"motogp": extractor},
+			SeenCacheDays: 1,
+		},
+		Cache:   cache,
+		History: &HistoryFile{guidIndex: map[string]int{}},
+	}
+
+	require.NoError(t, (&OnceCmd{NoAction: true}).Run(ctx))
+
+	require.NotNil(t, got)
+	assert.Equal(t, "tvsearch", got.Get("t"))
+	assert.Equal(t, "MotoGP", got.Get("q"))
+	assert.Equal(t, "secret", got.Get("apikey"))
+
+	byTitle := map[string]HistoryRecord{}
+	for _, r := range ctx.History.GetRecords() {
+		byTitle[r.Title] = r
+	}
+	match := byTitle["MotoGP.2026.Round06.Race.1080p.WEB"]
+	assert.Equal(t, "no-action mode", match.Reason, "Require on the category attr must match")
+	assert.Equal(t, "57", match.Labels["seeders"])
+	assert.Equal(t, "06", match.Labels["round"])
+	assert.Equal(t, int64(2147483648), match.SizeBytes)
+
+	// The 720p item has no category attr, so it is never the one picked.
+	other := byTitle["MotoGP.2026.Round06.Race.720p.WEB"]
+	assert.Equal(t, "skipped", other.Outcome)
+	assert.NotEqual(t, "no-action mode", other.Reason)
+	assert.Equal(t, "3", other.Labels["seeders"])
+}
@@ -32,7 +32,7 @@ func TestNav_SpeedPagesLinkTransmission(t *testing.T) {
 	sf := &SpeedFile{}
 	mux := http.NewServeMux()
 	registerSpeedRoutes(mux, staticSpeed(sf), nil, nil, nil, staticActions(speedActions{}),
-		navConfig{Transmission: navOn()})
+		navConfig{Transmission: navOn()}, nil)
 
 	for _, page := range []string{"/speedtest", "/rotations"} {
 		_, body := getBody(t, mux, page)
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hekmon/transmissionrpc/v3"
+)
+
+// UpgradePolicy decides what becomes of a torrent once a better version of
+// it has been dispatched. Without one, every better version is downloaded and
+// the old one is left where it is.
+type UpgradePolicy struct {
+	// Cutoff is the version that is good enough, as a value for some of the
+	// feed's Prefer labels. Once the seen cache has a key at or above it, no
+	// further upgrade of that key is dispatched.
+	Cutoff map[string]string `koanf:"Cutoff"`
+	// Remove takes the superseded torrent out of Transmission once its
+	// replacement has completed: "torrent" keeps its data, "data" deletes it
+	// too. Empty leaves it alone.
+	Remove string `koanf:"Remove"`
+}
+
+// Remove values.
+const (
+	UpgradeRemoveTorrent = "torrent"
+	UpgradeRemoveData    = "data"
+)
+
+// skipReasonCutoff is the history reason for a better version of a key that
+// has already reached the Cutoff.
+const skipReasonCutoff = "upgrade cutoff reached"
+
+// Validate checks Remove and the Cutoff values.
+func (u *UpgradePolicy) Validate(prefer []PreferDimension) error {
+	switch u.Remove {
+	case "", UpgradeRemoveTorrent, UpgradeRemoveData:
+	default:
+		return fmt.Errorf("Upgrade: Remove must be %q or %q, got %q", UpgradeRemoveTorrent, UpgradeRemoveData, u.Remove)
+	}
+	return validatePreferValues("Upgrade: Cutoff", u.Cutoff, prefer)
+}
+
+// validatePreferValues checks that each label of values is a Prefer
+// dimension, with a value that dimension can rank. field names values in
+// errors.
+func validatePreferValues(field string, values map[string]string, prefer []PreferDimension) error {
+	for label, value := range values {
+		i := slices.IndexFunc(prefer, func(d PreferDimension) bool { return d.Label == label })
+		if i < 0 {
+			return fmt.Errorf("%s label %q is not in Prefer", field, label)
+		}
+		dim := prefer[i]
+		if dim.numeric() {
+			if _, ok := labelNumber(value); !ok {
+				return fmt.Errorf("%s %s %q has no number to rank", field, label, value)
+			}
+		} else if !slices.Contains(dim.Order, value) {
+			return fmt.Errorf("%s %s %q is not in its Prefer order", field, label, value)
+		}
+	}
+	return nil
+}
+
+// cutoffReached reports whether a cached version ranked cachedRank is at or
+// above the Cutoff. Prefer dimensions the Cutoff leaves out rank as the
+// worst, so only the ones it names have to be met.
+func (u *UpgradePolicy) cutoffReached(cachedRank []int, prefer []PreferDimension) bool {
+	if len(u.Cutoff) == 0 {
+		return false
+	}
+	return !IsBetter(PreferenceRank(u.Cutoff, prefer), cachedRank)
+}
+
+// cacheBlocks returns why the cache rules out a candidate ranked rank for
+// key: it already has an equal or better version, or one at the Cutoff. It
+// returns "" when the candidate is new or an upgrade.
+func cacheBlocks(feedCfg Feed, cache *CacheFile, key string, rank []int) string {
+	cachedRank, ok := cache.BestRankForKey(key, feedCfg.Prefer)
+	if !ok {
+		return ""
+	}
+	if !IsBetter(rank, cachedRank) {
+		return skipReasonCacheBetter
+	}
+	if feedCfg.Upgrade.cutoffReached(cachedRank, feedCfg.Prefer) {
+		return skipReasonCutoff
+	}
+	return ""
+}
+
+// PendingUpgrade is a dispatched upgrade waiting for its torrent to complete
+// before the torrents it supersedes are removed. It is kept in the seen cache
+// so a restart does not forget it.
+type PendingUpgrade struct {
+	Feed       string              `json:"Feed"`
+	Title      string              `json:"Title"`
+	InfoHash   string              `json:"InfoHash,omitempty"`
+	TorrentID  int64               `json:"TorrentID,omitempty"`
+	DeleteData bool                `json:"DeleteData,omitempty"`
+	AddTime    time.Time           `json:"AddTime"`
+	Replaces   []SupersededTorrent `json:"Replaces"`
+}
+
+// SupersededTorrent is a torrent a PendingUpgrade is to remove. Feed and
+// GUID name its cache record, to mark it removed.
+type SupersededTorrent struct {
+	Feed      string `json:"Feed,omitempty"`
+	GUID      string `json:"GUID,omitempty"`
+	Title     string `json:"Title"`
+	InfoHash  string `json:"InfoHash,omitempty"`
+	TorrentID int64  `json:"TorrentID,omitempty"`
+}
+
+// queueUpgrade records, for a winner just added to Transmission, the cached
+// torrents of the feed it supersedes, when the feed's Upgrade policy removes
+// them. A winner Transmission already had, and so gave no torrent ID, is not
+// this tool's to upgrade with. Call it before w is added to the cache, so w
+// does not supersede itself.
+func queueUpgrade(ctx *RunContext, feedCfg Feed, feedName string, w *candidate) {
+	if feedCfg.Upgrade.Remove == "" || w.item.TorrentID == 0 {
+		return
+	}
+	ranks := map[string][]int{}
+	for _, cov := range w.coverages(feedCfg.Identity) {
+		rank := PreferenceRank(cov.labels, feedCfg.Prefer)
+		if r, ok := ranks[cov.identityKey]; !ok || IsBetter(rank, r) {
+			ranks[cov.identityKey] = rank
+		}
+	}
+	var replaces []SupersededTorrent
+	for _, r := range ctx.Cache.Superseded(feedName, ranks, feedCfg.Prefer) {
+		if r.InfoHash != "" && strings.EqualFold(r.InfoHash, w.item.InfoHash()) {
+			continue
+		}
+		title := r.Title
+		if title == "" {
+			title = r.GUID // recorded before titles were
+		}
+		replaces = append(replaces, SupersededTorrent{
+			Feed: r.Feed, GUID: r.GUID, Title: title, InfoHash: r.InfoHash, TorrentID: r.TorrentID,
+		})
+	}
+	if len(replaces) == 0 {
+		return
+	}
+	log.Infof("%s: %s upgrades %d torrent(s), removing them once it completes", feedName, w.item.Item.Title, len(replaces))
+	ctx.Cache.AddUpgrade(PendingUpgrade{
+		Feed:       feedName,
+		Title:      w.item.Item.Title,
+		InfoHash:   w.item.InfoHash(),
+		TorrentID:  w.item.TorrentID,
+		DeleteData: feedCfg.Upgrade.Remove == UpgradeRemoveData,
+		AddTime:    time.Now(),
+		Replaces:   replaces,
+	})
+}
+
+// upgradeFields are the torrent-get fields checkUpgrades needs.
+var upgradeFields = []string{"id", "hashString", "name", "percentDone", "downloadDir", "files"}
+
+// checkUpgrades removes the torrents each pending upgrade supersedes once
+// the upgrade has completed in Transmission. An upgrade that is no longer in
+// Transmission was removed by hand, and its old torrents are left alone. Old
+// data is kept, whatever the policy, when the two torrents share a file on
+// disk, as a REPACK under the same name does.
+func checkUpgrades(ctx *RunContext) {
+	pending := ctx.Cache.Upgrades
+	if len(pending) == 0 || ctx.Tx() == nil {
+		return
+	}
+	torrents, err := ctx.Tx().TorrentGet(context.TODO(), upgradeFields, nil)
+	if err != nil {
+		log.WithError(err).Warn("Unable to list Transmission's torrents, checking upgrades next run")
+		return
+	}
+	var keep []PendingUpgrade
+	for _, u := range pending {
+		upgrade := findTorrent(torrents, u.InfoHash, u.TorrentID)
+		if upgrade == nil {
+			log.Warnf("%s: upgrade %s is no longer in Transmission, keeping the torrents it would replace", u.Feed, u.Title)
+			continue
+		}
+		if upgrade.PercentDone == nil || *upgrade.PercentDone < 1 {
+			keep = append(keep, u)
+			continue
+		}
+		for _, old := range u.Replaces {
+			t := findTorrent(torrents, old.InfoHash, old.TorrentID)
+			if t == nil || t.ID == nil {
+				log.Debugf("%s: superseded %s is not in Transmission", u.Feed, old.Title)
+				continue
+			}
+			deleteData := u.DeleteData
+			if deleteData && sharesFiles(upgrade, t) {
+				log.Warnf("%s: %s shares files with its upgrade %s, removing it without its data", u.Feed, old.Title, u.Title)
+				deleteData = false
+			}
+			err := ctx.Tx().TorrentRemove(context.TODO(), transmissionrpc.TorrentRemovePayload{
+				IDs:             []int64{*t.ID},
+				DeleteLocalData: deleteData,
+			})
+			if err != nil {
+				log.WithError(err).Errorf("%s: unable to remove %s, superseded by %s", u.Feed, old.Title, u.Title)
+				continue
+			}
+			log.Infof("%s: removed %s (data deleted: %v), superseded by %s", u.Feed, old.Title, deleteData, u.Title)
+			if old.GUID == "" {
+				continue // queued before upgrades named their records
+			}
+			reason := "superseded by " + u.Title
+			if deleteData {
+				reason += ", data deleted"
+			}
+			ctx.Cache.MarkRemoved(old.Feed, old.GUID, time.Now())
+			if ctx.History != nil {
+				ctx.History.SetOutcome(old.Feed, old.GUID, removedOutcome, reason)
+			}
+		}
+	}
+	ctx.Cache.SetUpgrades(keep)
+}
+
+// sharesFiles reports whether a and b have a file at the same path on disk.
+func sharesFiles(a, b *transmissionrpc.Torrent) bool {
+	paths := func(t *transmissionrpc.Torrent) []string {
+		var dir string
+		if t.DownloadDir != nil {
+			dir = *t.DownloadDir
+		}
+		var out []string
+		for _, f := range t.Files {
+			out = append(out, path.Join(dir, f.Name))
+		}
+		return out
+	}
+	bPaths := paths(b)
+	return slices.ContainsFunc(paths(a), func(p string) bool { return slices.Contains(bPaths, p) })
+}
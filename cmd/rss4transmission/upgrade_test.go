@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hekmon/transmissionrpc/v3"
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// upgradeTransmission is a fake Transmission that keeps the torrents added
+// to it, by the infohash of their magnet link, and records removals. It
+// answers free-space for the paths in free only.
+type upgradeTransmission struct {
+	torrents []map[string]any
+	removed  []int64
+	withData []bool
+	free     map[string]int64
+}
+
+func (u *upgradeTransmission) serve(t *testing.T) *RunContext {
+	t.Helper()
+	const sessionID = "test-session-id"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Transmission-Session-Id") != sessionID {
+			w.Header().Set("X-Transmission-Session-Id", sessionID)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		var req struct {
+			Method    string         `json:"method"`
+			Tag       int            `json:"tag"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &req))
+
+		args := map[string]any{}
+		result := "success"
+		switch req.Method {
+		case "torrent-get":
+			args["torrents"] = u.torrents
+		case "torrent-add":
+			magnet, _ := req.Arguments["filename"].(string)
+			hash, _, _ := strings.Cut(strings.TrimPrefix(magnet, "magnet:?xt=urn:btih:"), "&")
+			id := len(u.torrents) + 1
+			u.torrents = append(u.torrents, map[string]any{
+				"id": id, "hashString": hash, "percentDone": 0.0,
+				"downloadDir": "/downloads", "files": []map[string]any{{"name": hash + ".mkv"}},
+			})
+			args["torrent-added"] = map[string]any{"id": id}
+		case "torrent-remove":
+			for _, id := range req.Arguments["ids"].([]any) {
+				u.removed = append(u.removed, int64(id.(float64)))
+			}
+			u.withData = append(u.withData, req.Arguments["delete-local-data"] == true)
+		case "session-get":
+			args["download-dir"] = "/downloads"
+		case "free-space":
+			p, _ := req.Arguments["path"].(string)
+			free, ok := u.free[p]
+			if !ok {
+				result = "No such file or directory"
+				break
+			}
+			args["path"] = p
+			args["size-bytes"] = free
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]any{
+			"result": result, "tag": req.Tag, "arguments": args,
+		}))
+	}))
+	t.Cleanup(srv.Close)
+	endpoint, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	client, err := transmissionrpc.New(endpoint, nil)
+	require.NoError(t, err)
+	return &RunContext{
+		Cache:        emptyCache(),
+		History:      &HistoryFile{guidIndex: map[string]int{}},
+		transmission: client,
+	}
+}
+
+func (u *upgradeTransmission) complete(id int) {
+	u.torrents[id-1]["percentDone"] = 1.0
+}
+
+var upgradeExtractor = &ExtractorSet{Labels: map[string]LabelDef{
+	"round":      {Regexp: `(RD\d+)`},
+	"resolution": {Regexp: `(\d{3,4}p)`},
+}}
+
+func upgradeFeed(policy UpgradePolicy) Feed {
+	return Feed{
+		Name:     "F",
+		Identity: []string{"round"},
+		Prefer:   []PreferDimension{{Label: "resolution", Order: []string{"2160p", "1080p", "720p"}}},
+		Groups:   []Group{{Require: map[string][]string{}}},
+		Upgrade:  policy,
+	}
+}
+
+func upgradeItem(resolution, hash string) *gofeed.Feed {
+	return &gofeed.Feed{Items: []*gofeed.Item{{
+		Title: "MotoGP.RD01.Race." + resolution,
+		GUID:  "guid-" + resolution,
+		Link:  "magnet:?xt=urn:btih:" + hash + "&dn=RD01",
+	}}}
+}
+
+var (
+	hash720  = strings.Repeat("a", 40)
+	hash1080 = strings.Repeat("b", 40)
+	hash2160 = strings.Repeat("c", 40)
+)
+
+// The 720p torrent is removed, with its data, only once the 1080p that
+// supersedes it has completed.
+func TestUpgrade_RemovesSupersededAfterCompletion(t *testing.T) {
+	tx := &upgradeTransmission{}
+	ctx := tx.serve(t)
+	cmd := &OnceCmd{}
+	feed := upgradeFeed(UpgradePolicy{Remove: UpgradeRemoveData})
+
+	cmd.processFeed(ctx, "F", feed, upgradeItem("720p", hash720), upgradeExtractor)
+	tx.complete(1)
+	assert.Empty(t, ctx.Cache.Upgrades, "a first version upgrades nothing")
+	assert.Equal(t, int64(1), ctx.Cache.Seen[0].TorrentID)
+	assert.Equal(t, "MotoGP.RD01.Race.720p", ctx.Cache.Seen[0].Title)
+
+	cmd.processFeed(ctx, "F", feed, upgradeItem("1080p", hash1080), upgradeExtractor)
+	require.Len(t, tx.torrents, 2)
+	require.Len(t, ctx.Cache.Upgrades, 1)
+	u := ctx.Cache.Upgrades[0]
+	assert.Equal(t, hash1080, u.InfoHash)
+	assert.Equal(t, []SupersededTorrent{{
+		Feed: "F", GUID: "guid-720p", Title: "MotoGP.RD01.Race.720p", InfoHash: hash720, TorrentID: 1,
+	}}, u.Replaces)
+
+	checkUpgrades(ctx)
+	assert.Empty(t, tx.removed, "the upgrade has not completed")
+	assert.Len(t, ctx.Cache.Upgrades, 1)
+
+	tx.complete(2)
+	checkUpgrades(ctx)
+	assert.Equal(t, []int64{1}, tx.removed)
+	assert.Equal(t, []bool{true}, tx.withData)
+	assert.Empty(t, ctx.Cache.Upgrades)
+	assert.False(t, ctx.Cache.Seen[0].Removed.IsZero())
+	outcome, reason := historyOutcome(t, ctx, "guid-720p")
+	assert.Equal(t, removedOutcome, outcome)
+	assert.Equal(t, "superseded by MotoGP.RD01.Race.1080p, data deleted", reason)
+}
+
+// Old data is kept when the upgrade writes the same file, and an upgrade
+// removed by hand leaves the old torrent alone.
+func TestCheckUpgrades_SharedFilesAndVanishedUpgrade(t *testing.T) {
+	tx := &upgradeTransmission{torrents: []map[string]any{
+		{"id": 1, "hashString": hash720, "percentDone": 1.0, "downloadDir": "/d", "files": []map[string]any{{"name": "race.mkv"}}},
+		{"id": 2, "hashString": hash1080, "percentDone": 1.0, "downloadDir": "/d", "files": []map[string]any{{"name": "race.mkv"}}},
+	}}
+	ctx := tx.serve(t)
+	ctx.Cache.Upgrades = []PendingUpgrade{
+		{Feed: "F", Title: "repack", InfoHash: hash1080, DeleteData: true,
+			Replaces: []SupersededTorrent{{Title: "original", InfoHash: hash720}}},
+		{Feed: "F", Title: "gone", InfoHash: hash2160, DeleteData: true,
+			Replaces: []SupersededTorrent{{Title: "original", InfoHash: hash720}}},
+	}
+
+	checkUpgrades(ctx)
+	assert.Equal(t, []int64{1}, tx.removed, "only the completed upgrade removes")
+	assert.Equal(t, []bool{false}, tx.withData)
+	assert.Empty(t, ctx.Cache.Upgrades)
+}
+
+// Once the cache has a key at the Cutoff, a better version is not
+// dispatched; below it, it is.
+func TestSelectWinners_UpgradeCutoff(t *testing.T) {
+	feed := upgradeFeed(UpgradePolicy{Cutoff: map[string]string{"resolution": "1080p"}})
+	cand := makeCandidate("uhd", map[string]string{"round": "RD01", "resolution": "2160p"}, nil)
+
+	cache := emptyCache()
+	cache.AddItem(&FeedItem{Feed: "F", Item: &gofeed.Item{GUID: "hd"}},
+		map[string]string{"round": "RD01", "resolution": "1080p"}, []string{"round=RD01"})
+	winners, skipped := selectWinners([]*candidate{cand}, feed, cache)
+	assert.Empty(t, winners)
+	require.Len(t, skipped, 1)
+	assert.Equal(t, skipReasonCutoff, skipped[0].reason)
+
+	cache = emptyCache()
+	cache.AddItem(&FeedItem{Feed: "F", Item: &gofeed.Item{GUID: "sd"}},
+		map[string]string{"round": "RD01", "resolution": "720p"}, []string{"round=RD01"})
+	winners, _ = selectWinners([]*candidate{cand}, feed, cache)
+	assert.Len(t, winners, 1, "720p is below the Cutoff, so 2160p is an upgrade")
+}
+
+// A bundle is only superseded when every key it covers is bettered, and only
+// the feed's own torrents this tool added and has not removed are.
+func TestCacheFile_Superseded(t *testing.T) {
+	prefer := []PreferDimension{{Label: "resolution", Order: []string{"1080p", "720p"}}}
+	sd := map[string]string{"resolution": "720p"}
+	c := emptyCache()
+	c.Seen = []CacheRecord{
+		{Feed: "F", GUID: "single", InfoHash: hash720, TorrentID: 1, IdentityKeys: []string{"round=RD01"}, Labels: sd},
+		{Feed: "F", GUID: "bundle", InfoHash: hash2160, TorrentID: 2, IdentityKeys: []string{"round=RD01", "round=RD02"}, Labels: sd},
+		{Feed: "F", GUID: "not-added", InfoHash: hash720, IdentityKeys: []string{"round=RD01"}, Labels: sd},
+		{Feed: "F", GUID: "removed", TorrentID: 3, IdentityKeys: []string{"round=RD01"}, Labels: sd, Removed: time.Now()},
+		{Feed: "G", GUID: "other-feed", TorrentID: 4, IdentityKeys: []string{"round=RD01"}, Labels: sd},
+		{Feed: "F", GUID: "same", InfoHash: hash1080, TorrentID: 5, IdentityKeys: []string{"round=RD01"}, Labels: map[string]string{"resolution": "1080p"}},
+	}
+	got := c.Superseded("F", map[string][]int{"round=RD01": {0}}, prefer)
+	require.Len(t, got, 1)
+	assert.Equal(t, "single", got[0].GUID)
+}
+
+func TestUpgradePolicy_Validate(t *testing.T) {
+	prefer := []PreferDimension{
+		{Label: "resolution", Order: []string{"1080p", "720p"}},
+		{Label: "repack", Direction: PreferHigher},
+	}
+	good := []UpgradePolicy{
+		{},
+		{Remove: UpgradeRemoveTorrent},
+		{Remove: UpgradeRemoveData, Cutoff: map[string]string{"resolution": "1080p", "repack": "REPACK1"}},
+	}
+	for _, u := range good {
+		assert.NoError(t, u.Validate(prefer), "%+v", u)
+	}
+	bad := []UpgradePolicy{
+		{Remove: "all"},
+		{Cutoff: map[string]string{"network": "NBC"}},
+		{Cutoff: map[string]string{"resolution": "480p"}},
+		{Cutoff: map[string]string{"repack": "REPACK"}},
+	}
+	for _, u := range bad {
+		assert.Error(t, u.Validate(prefer), "%+v", u)
+	}
+}
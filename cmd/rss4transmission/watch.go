@@ -24,7 +24,11 @@ type WatchCmd struct {
 	Feed            []string `kong:"help='Limit scraping to the given feed(s)'"`
 	Download        bool     `kong:"short='d',help='Download torrent file instead of torrenting',xor='action'"`
 	DownloadPath    string   `kong:"short='p',help='Path to download torrent files to ($PWD)'"`
-	Sleep           int      `kong:"short='s',default='300',help='Seconds to sleep between scraping'"`
+	Sleep           int      `kong:"short='s',default='300',help='Seconds between fetches of a feed with no Interval'"`
+	Backfill        int      `kong:"default='0',help='Minutes between backfill searches for feeds with a Backfill block (0 disables)'"`
+	Retention       int      `kong:"default='15',help='Minutes between retention checks for feeds with a Retention block (0 disables)'"`
+	RetentionDryRun bool     `kong:"help='Log and record what retention would remove without removing it'"`
+	Completion      int      `kong:"default='1',help='Minutes between checks for dispatched torrents that have completed (0 disables)'"`
 	HistoryFile     string   `kong:"help='Path to history JSON file'"`
 	PrivateListen   string   `kong:"help='Address to serve torrent history on (internal only), as host:port or bare port (disabled if empty)'"`
 	PublicListen    string   `kong:"help='Address to serve /cancel, /start, /notify-complete, and /healthz on (host:port or bare port); splits listeners so history stays on the private listener'"`
@@ -265,6 +269,8 @@ type liveState struct {
 	// getter has to be able to answer nil rather than a func that always says
 	// "unknown".
 	ExitIP func() exitIPFunc
+	// Schedule is the feed scheduler's state for every configured feed.
+	Schedule func() []FeedSchedule
 }
 
 // setupWebServers wires and starts the HTTP listener(s) for /cancel, /start,
@@ -275,7 +281,7 @@ type liveState struct {
 // complexity down.
 func setupWebServers(cmd *WatchCmd, ctx *RunContext, live liveState, removeT removeFunc,
 	getProgress progressFunc, retryHistory retryFunc, feedConfigured func(string) bool,
-	feedGroups func(string) []Group, forgetHistory forgetFunc, accessLog *logrus.Logger,
+	feedGroups func(string) []Group, forgetHistory forgetFunc, completed completedFunc, accessLog *logrus.Logger,
 ) {
 	// Every gate below is a predicate rather than a bool: the routes are
 	// registered once and decide per request, so a config reload can turn a
@@ -285,6 +291,7 @@ func setupWebServers(cmd *WatchCmd, ctx *RunContext, live liveState, removeT rem
 	ntfy := func() NtfyConfig { return live.Config().Ntfy }
 	tx := func() Transmission { return live.Config().Transmission }
 	nav := navConfig{
+		Feeds:        func() bool { return live.Schedule != nil },
 		Speedtest:    func() bool { return live.Speed() != nil },
 		Transmission: func() bool { return transmissionProxyTarget(tx()) != nil },
 	}
@@ -301,7 +308,7 @@ func setupWebServers(cmd *WatchCmd, ctx *RunContext, live liveState, removeT rem
 		}
 		cancelMux := newCancelMux(ctx.CancelStore, notif, removeT, getProgress,
 			ctx.StartStore, retryHistory, ctx.History, accessLog)
-		registerNotifyCompleteRoute(cancelMux, ntfy, notif, accessLog)
+		registerNotifyCompleteRoute(cancelMux, ntfy, notif, completed, accessLog)
 		go startWebServer("public", cancelMux, addr)
 
 		if cmd.PrivateListen != "" {
@@ -313,7 +320,8 @@ func setupWebServers(cmd *WatchCmd, ctx *RunContext, live liveState, removeT rem
 				log.Warnf("--private-listen is set but --history-file was not provided; history page will return 404")
 			}
 			privMux := newWebMux(ctx.History, retryHistory, feedConfigured, feedGroups, forgetHistory, nav)
-			registerSpeedRoutes(privMux, live.Speed, ctx.PeerPortOpen, ctx.PeerPort, live.ExitIP, live.Actions, nav)
+			registerSpeedRoutes(privMux, live.Speed, ctx.PeerPortOpen, ctx.PeerPort, live.ExitIP, live.Actions, nav, live.Schedule)
+			registerFeedsRoutes(privMux, live.Schedule, nav)
 			registerTransmissionRoutes(privMux, tx, nav)
 			go startWebServer("private", privMux, histAddr)
 		}
@@ -327,7 +335,8 @@ func setupWebServers(cmd *WatchCmd, ctx *RunContext, live liveState, removeT rem
 			log.Warnf("--private-listen is set but --history-file was not provided; history page will return 404")
 		}
 		mux := newWebMux(ctx.History, retryHistory, feedConfigured, feedGroups, forgetHistory, nav)
-		registerSpeedRoutes(mux, live.Speed, ctx.PeerPortOpen, ctx.PeerPort, live.ExitIP, live.Actions, nav)
+		registerSpeedRoutes(mux, live.Speed, ctx.PeerPortOpen, ctx.PeerPort, live.ExitIP, live.Actions, nav, live.Schedule)
+		registerFeedsRoutes(mux, live.Schedule, nav)
 		registerTransmissionRoutes(mux, tx, nav)
 		registerCancelRoutes(mux, ctx.CancelStore, notif, removeT, getProgress, accessLog)
 		ctx.CancelRoutesEnabled = true
@@ -335,7 +344,7 @@ func setupWebServers(cmd *WatchCmd, ctx *RunContext, live liveState, removeT rem
 			registerStartRoutes(mux, ctx.StartStore, notif, retryHistory, ctx.History, accessLog)
 			ctx.StartRoutesEnabled = true
 		}
-		registerNotifyCompleteRoute(mux, ntfy, notif, accessLog)
+		registerNotifyCompleteRoute(mux, ntfy, notif, completed, accessLog)
 		go startWebServer("private", mux, addr)
 	}
 }
@@ -367,7 +376,11 @@ func (cmd *WatchCmd) Run(ctx *RunContext) error {
 	reloader := newConfigReloader(ctx)
 	_ = reloader.registerWatch(reloader.onWatchEvent)
 
-	ticker := time.NewTicker(time.Duration(ctx.Cli.Watch.Sleep) * time.Second)
+	// The ticker only wakes the scheduler; each feed is fetched when its own
+	// Interval (or --sleep) says it is due.
+	sleep := time.Duration(ctx.Cli.Watch.Sleep) * time.Second
+	ticker := time.NewTicker(min(schedulerTick, sleep))
+	schedule := newFeedScheduler(sleep)
 
 	// watch just calls `once` in a loop
 	once := OnceCmd{
@@ -375,6 +388,7 @@ func (cmd *WatchCmd) Run(ctx *RunContext) error {
 		Download:        ctx.Cli.Watch.Download,
 		DownloadPath:    ctx.Cli.Watch.DownloadPath,
 		TorrentCacheDir: ctx.Cli.Watch.TorrentCacheDir,
+		schedule:        schedule,
 	}
 
 	if cmd.HistoryFile != "" {
@@ -447,6 +461,21 @@ func (cmd *WatchCmd) Run(ctx *RunContext) error {
 		return ctx.History.RemoveRecord(feed, guid), nil
 	}
 
+	// completed is signalled by /notify-complete, for the loop below to check
+	// completions on its next tick. One pending signal is as good as many.
+	// A torrent the hook has announced is remembered, so polling does not
+	// announce it again.
+	completed := make(chan struct{}, 1)
+	notifyCompleted := func(id int64, name string, announced bool) {
+		if announced {
+			ctx.announced.add(id, name)
+		}
+		select {
+		case completed <- struct{}{}:
+		default:
+		}
+	}
+
 	// feedConfigured checks against the live (possibly reloaded) config, so
 	// the history page's Torrent button reflects the config as it stands at
 	// render time, not as it was when the server started.
@@ -489,6 +518,17 @@ func (cmd *WatchCmd) Run(ctx *RunContext) error {
 			defer reloader.mu.Unlock()
 			return ctx.ExitIP
 		},
+		// Only the feeds --feed lets this process fetch: the rest would
+		// sit at "next tick" forever.
+		Schedule: func() []FeedSchedule {
+			var feeds []Feed
+			for _, f := range reloader.liveConfig(ctx).Feeds {
+				if once.feedAllowed(f.Name) {
+					feeds = append(feeds, f)
+				}
+			}
+			return schedule.Snapshot(feeds)
+		},
 	}
 
 	accessLog := openAccessLog(cmd.AccessLog)
@@ -510,16 +550,74 @@ func (cmd *WatchCmd) Run(ctx *RunContext) error {
 	}
 
 	setupWebServers(cmd, ctx, live, removeT, getProgress, retryHistory,
-		feedConfigured, feedGroups, forgetHistory, accessLog)
+		feedConfigured, feedGroups, forgetHistory, notifyCompleted, accessLog)
 
 	go ctx.PortMonitor.Run()
 
-	// Run once and then sleep between later runs...
+	// Backfill, retention and completion checks ride the same ticker, so none
+	// runs alongside a regular run, and all are serialised with config
+	// reloads by the same lock. The OnComplete actions completion checks
+	// queue are left to the worker below.
+	backfill := newBackfillTracker()
+	backfillEvery := time.Duration(cmd.Backfill) * time.Minute
+	var lastBackfill time.Time
+	retentionEvery := time.Duration(cmd.Retention) * time.Minute
+	var lastRetention time.Time
+	completionEvery := time.Duration(cmd.Completion) * time.Minute
+	var lastCompletion time.Time
+
+	// OnComplete actions run in a worker of their own: a command or a copy
+	// may take minutes, and holding the reload lock that long would stall
+	// runs, reloads and the web UI. It takes the lock only to pick the due
+	// actions, record how each went and save.
+	postWork := make(chan struct{}, 1)
+	once.postWork = postWork
+	go func() {
+		for range postWork {
+			runPostJobsShared(ctx, time.Now(), &reloader.mu)
+			reloader.mu.Lock()
+			if err := saveAfterPass(ctx); err != nil {
+				log.WithError(err).Error("Unable to save after OnComplete actions")
+			}
+			reloader.mu.Unlock()
+		}
+	}()
+
+	// Run once and then wake every tick to fetch whatever is due...
 	for ; true; <-ticker.C {
 		reloader.mu.Lock()
 		if err := once.Run(ctx); err != nil {
 			return err
 		}
+		if backfillEvery > 0 && time.Since(lastBackfill) >= backfillEvery {
+			lastBackfill = time.Now()
+			if err := once.Backfill(ctx, backfill); err != nil {
+				return err
+			}
+		}
+		// A call to /notify-complete checks at once. Polling sends the
+		// completed notification, except for a torrent the hook has already
+		// announced.
+		triggered := false
+		select {
+		case <-completed:
+			triggered = true
+		default:
+		}
+		if triggered || (completionEvery > 0 && time.Since(lastCompletion) >= completionEvery) {
+			lastCompletion = time.Now()
+			if err := once.Completions(ctx, completionEvery > 0); err != nil {
+				return err
+			}
+		} else {
+			once.startPostJobs(ctx)
+		}
+		if retentionEvery > 0 && time.Since(lastRetention) >= retentionEvery {
+			lastRetention = time.Now()
+			if err := once.Retention(ctx, cmd.RetentionDryRun); err != nil {
+				return err
+			}
+		}
 		reloader.mu.Unlock()
 	}
 	return nil
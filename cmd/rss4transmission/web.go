@@ -50,11 +50,12 @@ var navTmpl string
 // navConfig says which optional nav items exist. The shared nav partial only
 // links a page that is currently live, so a link never leads to a 404.
 //
-// Both fields are predicates rather than bools because every route is
+// The fields are predicates rather than bools because every route is
 // registered once at startup and gated per request. A config reload can turn a
 // page on or off, and the nav bar must agree with the gate on the next render.
 // A nil field means the page is off.
 type navConfig struct {
+	Feeds        func() bool
 	Speedtest    func() bool
 	Transmission func() bool
 }
@@ -64,6 +65,7 @@ type navConfig struct {
 // render time, so the templates still compile once.
 func (n navConfig) navFuncs() template.FuncMap {
 	return template.FuncMap{
+		"feedsEnabled":        func() bool { return n.Feeds != nil && n.Feeds() },
 		"speedtestEnabled":    func() bool { return n.Speedtest != nil && n.Speedtest() },
 		"transmissionEnabled": func() bool { return n.Transmission != nil && n.Transmission() },
 	}
@@ -105,12 +107,18 @@ type retryFunc func(rec HistoryRecord) (int64, error)
 // history record was found and removed.
 type forgetFunc func(feed, guid string) (bool, error)
 
+// completedFunc is told of a torrent /notify-complete was called for, by its
+// Transmission ID and name, and whether the completed notification for it
+// went out.
+type completedFunc func(id int64, name string, announced bool)
+
 // cancelPageData is passed to the cancel confirmation template.
 type cancelPageData struct {
 	Title         string
 	FeedName      string
 	Labels        map[string]string
 	Files         []string
+	SkippedFiles  []string // paths file rules left out of the download
 	SizeFormatted string
 	Downloaded    string // bytes downloaded so far, formatted (e.g. "234.5 MB"), or "Unknown"
 	Percent       string // percent done (e.g. "12.3%"), or "Unknown"
@@ -344,10 +352,25 @@ func newWebMux(history *HistoryFile, retry retryFunc, feedConfigured func(name s
 				return "notified"
 			case "error":
 				return "error"
+			case "deferred":
+				return "deferred"
+			case waitingOutcome:
+				return "waiting"
+			case removedOutcome:
+				return "removed"
 			default:
 				return "skipped"
 			}
 		},
+		"countOutcome": func(rows []historyRow, outcome string) int {
+			n := 0
+			for _, r := range rows {
+				if r.Outcome == outcome {
+					n++
+				}
+			}
+			return n
+		},
 		"feedConfigured": feedConfigured,
 		"sub":            func(a, b int) int { return a - b },
 	}
@@ -517,13 +540,17 @@ func liveSecret(notif func() NotificationsConfig) ([]byte, bool) {
 }
 
 // registerNotifyCompleteRoute adds POST /notify-complete to mux. The route is
-// always registered and answers 404 while ntfy is not configured, so turning
-// ntfy on in the config file does not need a restart.
+// always registered and answers 404 while ntfy is not configured and there is
+// no completed, so turning ntfy on in the config file does not need a
+// restart. completed, when given, is called for every accepted request with
+// the torrent's ID and name and whether the completed notification went out,
+// so watch checks completions, runs the OnComplete actions and does not
+// announce the torrent again.
 //
 // When the live HMACSecret is non-empty the endpoint requires
 // Authorization: Bearer <HMACSecret>. accessLog is optional.
-func registerNotifyCompleteRoute(mux *http.ServeMux, ntfy func() NtfyConfig, notif func() NotificationsConfig, accessLog *logrus.Logger) {
-	mux.HandleFunc("POST /notify-complete", makeNotifyCompleteHandler(ntfy, notif, accessLog))
+func registerNotifyCompleteRoute(mux *http.ServeMux, ntfy func() NtfyConfig, notif func() NotificationsConfig, completed completedFunc, accessLog *logrus.Logger) {
+	mux.HandleFunc("POST /notify-complete", makeNotifyCompleteHandler(ntfy, notif, completed, accessLog))
 }
 
 // notifyCompleteRequest is the JSON body accepted by POST /notify-complete.
@@ -533,13 +560,14 @@ type notifyCompleteRequest struct {
 	ID   int64  `json:"id"`
 }
 
-func makeNotifyCompleteHandler(ntfy func() NtfyConfig, notif func() NotificationsConfig, accessLog *logrus.Logger) http.HandlerFunc {
+func makeNotifyCompleteHandler(ntfy func() NtfyConfig, notif func() NotificationsConfig, completed completedFunc, accessLog *logrus.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var ntfyCfg NtfyConfig
 		if ntfy != nil {
 			ntfyCfg = ntfy()
 		}
-		if ntfyCfg.BaseURL == "" || ntfyCfg.Topic == "" {
+		sendNtfy := ntfyCfg.BaseURL != "" && ntfyCfg.Topic != ""
+		if !sendNtfy && completed == nil {
 			http.NotFound(w, r)
 			return
 		}
@@ -584,6 +612,20 @@ func makeNotifyCompleteHandler(ntfy func() NtfyConfig, notif func() Notification
 			http.Error(w, "name is required", http.StatusBadRequest)
 			return
 		}
+		if !sendNtfy {
+			if completed != nil {
+				completed(req.ID, req.Name, false)
+			}
+			if accessLog != nil {
+				accessLog.WithFields(logrus.Fields{
+					"endpoint": "/notify-complete",
+					"result":   "ok",
+					"name":     req.Name,
+				}).Info("notify-complete access")
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
 		ctx := &NtfyTemplateContext{
 			Title:     req.Name,
 			Dir:       req.Dir,
@@ -591,7 +633,11 @@ func makeNotifyCompleteHandler(ntfy func() NtfyConfig, notif func() Notification
 			Size:      formatGB(0), // no size info available from Transmission hook
 		}
 		client := NewNtfyClient(ntfyCfg)
-		if err := client.SendTorrentCompleted(ctx); err != nil {
+		err := client.SendTorrentCompleted(ctx)
+		if completed != nil {
+			completed(req.ID, req.Name, err == nil)
+		}
+		if err != nil {
 			if accessLog != nil {
 				accessLog.WithFields(logrus.Fields{
 					"endpoint": "/notify-complete",
@@ -694,6 +740,7 @@ func makeGetCancelHandler(store *Store, notif func() NotificationsConfig, getPro
 			FeedName:      meta.FeedName,
 			Labels:        meta.Labels,
 			Files:         meta.Files,
+			SkippedFiles:  meta.SkippedFiles,
 			SizeFormatted: formatGB(meta.SizeBytes),
 			Downloaded:    downloaded,
 			Percent:       percent,
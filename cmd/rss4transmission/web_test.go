@@ -44,7 +44,7 @@ func TestFaviconHandler_ServesSVG(t *testing.T) {
 
 func TestNewCancelMux_FaviconReachable(t *testing.T) {
 	cfg := makeCancelCfg("", "")
-	mux := newCancelMux(nil, cfg, nil, nil, nil, nil, nil, nil)
+	mux := newCancelMux(nil, staticNotif(cfg), nil, nil, nil, nil, nil, nil)
 
 	req := httptest.NewRequest("GET", "/favicon.svg", nil)
 	rr := httptest.NewRecorder()
@@ -133,6 +133,31 @@ func TestGetCancelHandler_RendersForm(t *testing.T) {
 	assert.Contains(t, body, "My.Show.S01E01.mkv", "file name should appear in form")
 }
 
+func TestGetCancelHandler_RendersSkippedFiles(t *testing.T) {
+	store := NewStore(time.Hour)
+	store.Register("test-id", 42, CancelMetadata{
+		Title:        "MotoGP RD01",
+		Files:        []string{"MotoGP.mkv", "Moto2.mkv"},
+		SkippedFiles: []string{"RD01/Moto2.mkv"},
+	})
+
+	cfg := makeCancelCfg("secret", "https://example.com")
+	expires, sig := GenerateToken([]byte("secret"), "test-id", time.Hour)
+
+	mux := newWebMux(nil, nil, nil, nil, nil, navConfig{})
+	registerCancelRoutes(mux, store, staticNotif(cfg), makeRemoveFunc(new(bool)), noProgressFunc(), nil)
+
+	req := httptest.NewRequest("GET",
+		fmt.Sprintf("/cancel?id=test-id&expires=%d&sig=%s", expires, sig), nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	assert.Contains(t, body, "Not downloaded")
+	assert.Contains(t, body, "RD01/Moto2.mkv", "the deselected file should be listed")
+}
+
 func TestGetCancelHandler_RendersProgress(t *testing.T) {
 	store := NewStore(time.Hour)
 	store.Register("test-id", 42, CancelMetadata{Title: "Show"})
@@ -541,6 +566,67 @@ func TestHistoryPage_NotifiedOutcomeFilterPillPresentAndChecked(t *testing.T) {
 		"the notified outcome must have its own filter checkbox, checked by default, or notified records are hidden on load")
 }
 
+func TestHistoryPage_DeferredOutcomeCountedAndFilterable(t *testing.T) {
+	h := emptyHistory()
+	h.AddOrUpdateRecord(NewHistoryRecord("myfeed",
+		makeGofeedItemWithEnclosure("Waiting", "guid-1", "https://example.com/my.torrent"),
+		"deferred", deferReasonBudget, nil))
+	h.AddOrUpdateRecord(NewHistoryRecord("myfeed",
+		makeGofeedItemWithEnclosure("Done", "guid-2", "https://example.com/done.torrent"),
+		"dispatched", "", nil))
+
+	mux := newWebMux(h, nil, nil, nil, nil, navConfig{})
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	assert.Contains(t, body, `class="outcome deferred"`)
+	assert.Contains(t, body, `id="o-deferred" value="deferred" checked`)
+	assert.Contains(t, body, `2 record(s), 1 deferred &mdash;`)
+	assert.Contains(t, body, `var DEFERRED =  1 ;`)
+}
+
+func TestHistoryPage_WaitingOutcomeShowsUntil(t *testing.T) {
+	h := emptyHistory()
+	h.AddOrUpdateRecord(NewHistoryRecord("myfeed",
+		makeGofeedItemWithEnclosure("Held", "guid-1", "https://example.com/held.torrent"),
+		waitingOutcome, "waiting until 2026-10-17 15:30", nil))
+
+	mux := newWebMux(h, nil, nil, nil, nil, navConfig{})
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	assert.Contains(t, body, `class="outcome waiting"`)
+	assert.Contains(t, body, `waiting until 2026-10-17 15:30`)
+	assert.Contains(t, body, `id="o-waiting" value="waiting" checked`)
+	assert.Contains(t, body, `1 record(s), 1 waiting for a better release`)
+	assert.Contains(t, body, `class="btn-torrent"`, "a held item can be torrented by hand")
+}
+
+func TestHistoryPage_ShowsCompletionAndActions(t *testing.T) {
+	h := emptyHistory()
+	h.AddOrUpdateRecord(NewHistoryRecord("myfeed",
+		makeGofeedItemWithEnclosure("Done", "guid-1", "https://example.com/done.torrent"),
+		"dispatched", "", nil))
+	require.True(t, h.MarkComplete("myfeed", "guid-1", time.Date(2026, 10, 17, 15, 30, 0, 0, time.UTC)))
+	require.True(t, h.SetActionStatus("myfeed", "guid-1", postActionWebhook, "done"))
+
+	mux := newWebMux(h, nil, nil, nil, nil, navConfig{})
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	assert.Contains(t, body, `completed 2026-10-17 15:30`)
+	assert.Contains(t, body, `webhook: done`)
+}
+
 func TestHistoryPage_RendersForgetButtonForSkipped(t *testing.T) {
 	h := emptyHistory()
 	rec := NewHistoryRecord("myfeed",
@@ -1561,7 +1647,7 @@ func makeNotifyCompleteMux(t *testing.T, ntfyCfg NtfyConfig, cancelCfg Notificat
 	t.Helper()
 	require.NoError(t, ntfyCfg.Validate())
 	mux := http.NewServeMux()
-	registerNotifyCompleteRoute(mux, staticNtfy(ntfyCfg), staticNotif(cancelCfg), nil)
+	registerNotifyCompleteRoute(mux, staticNtfy(ntfyCfg), staticNotif(cancelCfg), nil, nil)
 	return mux
 }
 
@@ -1663,7 +1749,7 @@ func TestNotifyComplete_NotRegisteredWhenNtfyUnconfigured(t *testing.T) {
 	mux := http.NewServeMux()
 	ntfyCfg := NtfyConfig{} // no BaseURL/Topic
 	require.NoError(t, ntfyCfg.Validate())
-	registerNotifyCompleteRoute(mux, staticNtfy(ntfyCfg), staticNotif(NotificationsConfig{}), nil)
+	registerNotifyCompleteRoute(mux, staticNtfy(ntfyCfg), staticNotif(NotificationsConfig{}), nil, nil)
 
 	req := httptest.NewRequest("POST", "/notify-complete", nil)
 	rr := httptest.NewRecorder()
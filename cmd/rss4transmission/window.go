@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DispatchSchedule limits the times of day winners are dispatched, such as
+// an ISP's off-peak hours. Outside them a winner is held back and dispatched
+// at the first fetch once they allow it again.
+type DispatchSchedule struct {
+	// Allow are the windows dispatching is allowed in. Empty allows any
+	// time Deny does not cover.
+	Allow []TimeWindow `koanf:"Allow"`
+	// Deny are the windows dispatching is not allowed in, over Allow.
+	Deny []TimeWindow `koanf:"Deny"`
+}
+
+// TimeWindow is a span of local time on some days of the week. A window
+// whose To is before its From runs past midnight, and belongs to the day it
+// starts on.
+type TimeWindow struct {
+	// Days are the days the window is on, as mon or monday. Empty means
+	// every day.
+	Days []string `koanf:"Days"`
+	// From and To are the times it starts and ends, as 15:04. Neither
+	// means the whole day.
+	From string `koanf:"From"`
+	To   string `koanf:"To"`
+}
+
+// scheduleHorizon is how far ahead holdReason looks for the next time a
+// schedule allows dispatching.
+const scheduleHorizon = 8 * 24 * time.Hour
+
+// Enabled reports whether the schedule has any window.
+func (s *DispatchSchedule) Enabled() bool {
+	return len(s.Allow) > 0 || len(s.Deny) > 0
+}
+
+// Validate checks each window.
+func (s *DispatchSchedule) Validate() error {
+	for i, w := range s.Allow {
+		if _, err := w.parse(); err != nil {
+			return fmt.Errorf("Schedule: Allow[%d]: %w", i, err)
+		}
+	}
+	for i, w := range s.Deny {
+		if _, err := w.parse(); err != nil {
+			return fmt.Errorf("Schedule: Deny[%d]: %w", i, err)
+		}
+	}
+	if s.Enabled() && s.nextAllowed(time.Now()).IsZero() {
+		return fmt.Errorf("Schedule: Deny leaves no time to dispatch in")
+	}
+	return nil
+}
+
+// Allows reports whether the schedule allows dispatching at t.
+func (s *DispatchSchedule) Allows(t time.Time) bool {
+	return s.parse().allows(t)
+}
+
+// nextAllowed returns the first minute from t the schedule allows
+// dispatching in, or the zero time when there is none within
+// scheduleHorizon.
+func (s *DispatchSchedule) nextAllowed(t time.Time) time.Time {
+	p := s.parse()
+	for m := t.Truncate(time.Minute); m.Before(t.Add(scheduleHorizon)); m = m.Add(time.Minute) {
+		if p.allows(m) {
+			return m
+		}
+	}
+	return time.Time{}
+}
+
+// holdReason returns why the schedule holds a winner back at now, or ""
+// when it allows dispatching.
+func (s *DispatchSchedule) holdReason(now time.Time) string {
+	if s.Allows(now) {
+		return ""
+	}
+	if next := s.nextAllowed(now); !next.IsZero() {
+		return "outside Schedule until " + next.Format("2006-01-02 15:04")
+	}
+	return "outside Schedule"
+}
+
+// parsedSchedule is a DispatchSchedule with its windows parsed.
+type parsedSchedule struct {
+	allow, deny []parsedWindow
+}
+
+// parse parses the windows. A window that does not parse, which loadConfig
+// has already rejected, is left out.
+func (s *DispatchSchedule) parse() parsedSchedule {
+	var p parsedSchedule
+	for _, w := range s.Allow {
+		if pw, err := w.parse(); err == nil {
+			p.allow = append(p.allow, pw)
+		}
+	}
+	for _, w := range s.Deny {
+		if pw, err := w.parse(); err == nil {
+			p.deny = append(p.deny, pw)
+		}
+	}
+	return p
+}
+
+func (p parsedSchedule) allows(t time.Time) bool {
+	if len(p.allow) > 0 && !slices.ContainsFunc(p.allow, func(w parsedWindow) bool { return w.contains(t) }) {
+		return false
+	}
+	return !slices.ContainsFunc(p.deny, func(w parsedWindow) bool { return w.contains(t) })
+}
+
+// parsedWindow is a TimeWindow in minutes of the day.
+type parsedWindow struct {
+	days     map[time.Weekday]bool // nil means every day
+	from, to int
+}
+
+// weekdays maps the day names, in full and as their first three letters, to
+// the day.
+var weekdays = func() map[string]time.Weekday {
+	m := map[string]time.Weekday{}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		m[name] = d
+		m[name[:3]] = d
+	}
+	return m
+}()
+
+func (w TimeWindow) parse() (parsedWindow, error) {
+	var p parsedWindow
+	for _, d := range w.Days {
+		day, ok := weekdays[strings.ToLower(d)]
+		if !ok {
+			return p, fmt.Errorf("unknown day %q", d)
+		}
+		if p.days == nil {
+			p.days = map[time.Weekday]bool{}
+		}
+		p.days[day] = true
+	}
+	if w.From == "" && w.To == "" {
+		p.to = 24 * 60
+		return p, nil
+	}
+	if w.From == "" || w.To == "" {
+		return p, fmt.Errorf("From and To go together")
+	}
+	var err error
+	if p.from, err = minuteOfDay(w.From); err != nil {
+		return p, fmt.Errorf("unable to parse From %q: %w", w.From, err)
+	}
+	if p.to, err = minuteOfDay(w.To); err != nil {
+		return p, fmt.Errorf("unable to parse To %q: %w", w.To, err)
+	}
+	if p.from == p.to {
+		return p, fmt.Errorf("From and To are both %s", w.From)
+	}
+	return p, nil
+}
+
+func minuteOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// contains reports whether t, in its own location, is in the window.
+func (p parsedWindow) contains(t time.Time) bool {
+	on := func(d time.Weekday) bool { return p.days == nil || p.days[d] }
+	m := t.Hour()*60 + t.Minute()
+	if p.from < p.to {
+		return on(t.Weekday()) && m >= p.from && m < p.to
+	}
+	return (on(t.Weekday()) && m >= p.from) || (on((t.Weekday()+6)%7) && m < p.to)
+}
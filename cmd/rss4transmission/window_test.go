@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// at is 2026-10-16, a Friday, at hh:mm local time, plus days.
+func at(days, hh, mm int) time.Time {
+	return time.Date(2026, 10, 16+days, hh, mm, 0, 0, time.Local)
+}
+
+func TestDispatchSchedule_Allows(t *testing.T) {
+	s := DispatchSchedule{
+		Allow: []TimeWindow{
+			{From: "01:00", To: "07:00"},
+			{Days: []string{"fri"}, From: "22:00", To: "02:00"},
+			{Days: []string{"Sunday"}},
+		},
+		Deny: []TimeWindow{{Days: []string{"sun"}, From: "12:00", To: "13:00"}},
+	}
+	for _, tc := range []struct {
+		when time.Time
+		want bool
+	}{
+		{at(0, 0, 59), false},
+		{at(0, 1, 0), true},
+		{at(0, 6, 59), true},
+		{at(0, 7, 0), false},
+		{at(0, 23, 0), true},  // Friday's window runs past midnight
+		{at(1, 0, 30), true},  // into Saturday
+		{at(1, 23, 0), false}, // but Saturday has none of its own
+		{at(2, 9, 0), true},   // all of Sunday
+		{at(2, 12, 30), false},
+	} {
+		assert.Equal(t, tc.want, s.Allows(tc.when), tc.when.Format(time.RFC1123))
+	}
+
+	assert.True(t, (&DispatchSchedule{}).Allows(at(0, 12, 0)), "no windows allow any time")
+}
+
+func TestDispatchSchedule_HoldReason(t *testing.T) {
+	s := DispatchSchedule{Deny: []TimeWindow{{Days: []string{"mon", "tue", "wed", "thu", "fri"}, From: "09:00", To: "17:00"}}}
+	assert.Equal(t, "", s.holdReason(at(0, 8, 59)))
+	assert.Equal(t, "outside Schedule until 2026-10-16 17:00", s.holdReason(at(0, 9, 30)))
+}
+
+func TestDispatchSchedule_Validate(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		schedule DispatchSchedule
+		wantErr  string
+	}{
+		{name: "none"},
+		{name: "ok", schedule: DispatchSchedule{Allow: []TimeWindow{{Days: []string{"Mon", "friday"}, From: "22:00", To: "00:00"}}}},
+		{name: "unknown day", schedule: DispatchSchedule{Allow: []TimeWindow{{Days: []string{"someday"}}}}, wantErr: `Allow[0]: unknown day "someday"`},
+		{name: "From alone", schedule: DispatchSchedule{Deny: []TimeWindow{{From: "09:00"}}}, wantErr: "Deny[0]: From and To go together"},
+		{name: "bad time", schedule: DispatchSchedule{Allow: []TimeWindow{{From: "9am", To: "17:00"}}}, wantErr: `unable to parse From "9am"`},
+		{name: "empty window", schedule: DispatchSchedule{Allow: []TimeWindow{{From: "09:00", To: "09:00"}}}, wantErr: "both 09:00"},
+		{name: "never", schedule: DispatchSchedule{Deny: []TimeWindow{{}}}, wantErr: "no time to dispatch"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.schedule.Validate()
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}